@@ -0,0 +1,172 @@
+package phpserialize
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"strconv"
+)
+
+// PHPArray is an ordered PHP array. Unlike map[string]interface{}, it keeps the
+// insertion order of its entries and whether each key is an integer or a string,
+// so it re-serializes exactly as PHP wrote it. Unmarshal returns PHPArray for
+// every array when WithOrderedArrays(true) is set.
+type PHPArray []PHPArrayEntry
+
+// PHPArrayEntry is one key/value pair of a PHPArray.
+// Key is an int64 or a string.
+type PHPArrayEntry struct {
+	Key   interface{}
+	Value interface{}
+}
+
+// Len returns the number of entries
+func (a PHPArray) Len() int {
+	return len(a)
+}
+
+// Get returns the value stored under key, applying PHP's key normalization
+// (so "5" and 5 address the same entry)
+func (a PHPArray) Get(key interface{}) (interface{}, bool) {
+	k, err := normalizeArrayKey(key)
+	if err != nil {
+		return nil, false
+	}
+	for _, e := range a {
+		if e.Key == k {
+			return e.Value, true
+		}
+	}
+	return nil, false
+}
+
+// Set replaces the value stored under key, or appends a new entry at the end
+func (a *PHPArray) Set(key interface{}, value interface{}) error {
+	k, err := normalizeArrayKey(key)
+	if err != nil {
+		return err
+	}
+	for i, e := range *a {
+		if e.Key == k {
+			(*a)[i].Value = value
+			return nil
+		}
+	}
+	*a = append(*a, PHPArrayEntry{Key: k, Value: value})
+	return nil
+}
+
+// Delete removes the entry stored under key, keeping the order of the others
+func (a *PHPArray) Delete(key interface{}) {
+	k, err := normalizeArrayKey(key)
+	if err != nil {
+		return
+	}
+	for i, e := range *a {
+		if e.Key == k {
+			*a = append((*a)[:i], (*a)[i+1:]...)
+			return
+		}
+	}
+}
+
+// Keys returns the keys in order
+func (a PHPArray) Keys() []interface{} {
+	keys := make([]interface{}, len(a))
+	for i, e := range a {
+		keys[i] = e.Key
+	}
+	return keys
+}
+
+// normalizeArrayKey converts a Go key to a PHP array key the way PHP does:
+// integers become int64, and decimal strings such as "5" (but not "05") become integers
+func normalizeArrayKey(key interface{}) (interface{}, error) {
+	switch k := key.(type) {
+	case string:
+		if n, err := strconv.ParseInt(k, 10, 64); err == nil && strconv.FormatInt(n, 10) == k {
+			return n, nil
+		}
+		return k, nil
+	case int64:
+		return k, nil
+	}
+
+	v := reflect.ValueOf(key)
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int(), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if v.Uint() > 1<<63-1 {
+			return nil, fmt.Errorf("array key %d exceeds PHP int range", v.Uint())
+		}
+		return int64(v.Uint()), nil
+	case reflect.String:
+		return normalizeArrayKey(v.String())
+	}
+	return nil, fmt.Errorf("invalid array key type %T", key)
+}
+
+// marshalArray serializes a PHPArray in entry order
+func marshalArray(buf *bytes.Buffer, arr PHPArray, cfg *marshalConfig, depth int) error {
+	buf.WriteString(fmt.Sprintf("a:%d:{", len(arr)))
+	for _, e := range arr {
+		switch k := e.Key.(type) {
+		case string:
+			buf.WriteString(fmt.Sprintf("s:%d:\"%s\";", len(k), k))
+		default:
+			v := reflect.ValueOf(e.Key)
+			switch v.Kind() {
+			case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+				buf.WriteString(fmt.Sprintf("i:%d;", v.Int()))
+			default:
+				return fmt.Errorf("%w: cannot serialize array key type %T", ErrUnsupportedType, e.Key)
+			}
+		}
+		if err := marshalValue(buf, e.Value, cfg, depth+1); err != nil {
+			return err
+		}
+	}
+	buf.WriteString("}")
+	return nil
+}
+
+// unmarshalOrderedArray reads the entries of an array whose `a:count:{` header
+// has been consumed, keeping key order and types
+func unmarshalOrderedArray(r *stringReader, cfg *unmarshalConfig, depth int, slot int, count int) (interface{}, error) {
+	// The slice is registered up front and filled in place, so references
+	// to the array share its entries. Its length is bounded by the input
+	// left; a stream holding more entries than that grows it as it goes.
+	arr := make(PHPArray, r.maxEntries(count))
+	r.vars[slot] = arr
+
+	for i := 0; i < count; i++ {
+		// Read key with incremented depth
+		key, err := unmarshalKey(r, cfg, depth+1)
+		if err != nil {
+			return nil, err
+		}
+
+		// Read value with incremented depth
+		value, err := unmarshalValue(r, cfg, depth+1)
+		if err != nil {
+			return nil, prependPath(err, key)
+		}
+		if i < len(arr) {
+			arr[i] = PHPArrayEntry{Key: key, Value: value}
+		} else {
+			arr = append(arr, PHPArrayEntry{Key: key, Value: value})
+			r.vars[slot] = arr
+		}
+	}
+
+	// Read closing brace
+	brace, err := r.read()
+	if err != nil {
+		return nil, err
+	}
+	if brace != '}' {
+		return nil, expectError(r.pos-1, "'}'", "for array", brace)
+	}
+	return arr, nil
+}
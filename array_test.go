@@ -0,0 +1,141 @@
+package phpserialize
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestPHPArray tests order-preserving arrays
+func TestPHPArray(t *testing.T) {
+	data := `a:3:{i:5;s:1:"a";s:1:"x";a:2:{i:1;i:1;i:0;i:0;}s:2:"05";b:1;}`
+
+	result, err := Unmarshal(data, WithOrderedArrays(true))
+	if err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	arr, ok := result.(PHPArray)
+	if !ok {
+		t.Fatalf("Expected PHPArray, got %T", result)
+	}
+	if arr.Len() != 3 || arr[0].Key != int64(5) || arr[1].Key != "x" || arr[2].Key != "05" {
+		t.Errorf("Unexpected keys: %v", arr.Keys())
+	}
+	if _, ok := arr[1].Value.(PHPArray); !ok {
+		t.Errorf("Expected nested PHPArray, got %T", arr[1].Value)
+	}
+
+	// Round-trip keeps order and key types
+	out, err := Marshal(result)
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	if out != data {
+		t.Errorf("Expected %q, got %q", data, out)
+	}
+
+	// Default Unmarshal is unchanged
+	if _, ok := MustUnmarshal(data).(map[string]interface{}); !ok {
+		t.Error("Expected map without WithOrderedArrays")
+	}
+}
+
+// TestPHPArrayMethods tests PHP key normalization in the helpers
+func TestPHPArrayMethods(t *testing.T) {
+	var arr PHPArray
+	if err := arr.Set("5", "five"); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	_ = arr.Set("name", "x")
+	_ = arr.Set(uint8(5), "FIVE")
+	_ = arr.Set("05", "string key")
+
+	if arr.Len() != 3 {
+		t.Fatalf("Expected 3 entries, got %v", arr)
+	}
+	if v, ok := arr.Get(5); !ok || v != "FIVE" {
+		t.Errorf("Expected FIVE at 5, got %v", v)
+	}
+	if arr[0].Key != int64(5) {
+		t.Errorf("Expected numeric string key to become int64, got %T", arr[0].Key)
+	}
+	if err := arr.Set(1.5, "x"); err == nil {
+		t.Error("Expected error for float key")
+	}
+
+	arr.Delete("name")
+	out, err := Marshal(arr)
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	expected := `a:2:{i:5;s:4:"FIVE";s:2:"05";s:10:"string key";}`
+	if out != expected {
+		t.Errorf("Expected %q, got %q", expected, out)
+	}
+}
+
+// TestPHPArrayReferences tests that references share ordered arrays
+func TestPHPArrayReferences(t *testing.T) {
+	data := `a:2:{i:0;a:1:{i:0;i:1;}i:1;R:2;}`
+	result, err := Unmarshal(data, WithOrderedArrays(true))
+	if err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	out, err := Marshal(result)
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	if out != data {
+		t.Errorf("Expected %q, got %q", data, out)
+	}
+
+	var typed map[int]map[int]int
+	if err := UnmarshalTo(data, &typed, WithOrderedArrays(true)); err != nil {
+		t.Fatalf("UnmarshalTo failed: %v", err)
+	}
+	if typed[1][0] != 1 {
+		t.Errorf("Unexpected typed value: %v", typed)
+	}
+}
+
+// TestPHPArrayForgedCount tests that an array count larger than the input
+// does not allocate for the entries it claims
+func TestPHPArrayForgedCount(t *testing.T) {
+	for _, data := range []string{`a:999999999999999:{}`, `a:100000000:{i:0;N;}`} {
+		if _, err := Unmarshal(data, WithOrderedArrays(true)); err == nil {
+			t.Errorf("Expected error for %s", data)
+		}
+	}
+
+	// A stream grows the array past the preallocated entries
+	list := make(PHPArray, streamChunkSize)
+	for i := range list {
+		list[i] = PHPArrayEntry{Key: int64(i), Value: int64(i)}
+	}
+	got, err := NewDecoder(strings.NewReader(MustMarshal(list)), WithOrderedArrays(true)).Decode()
+	if err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+	if arr, ok := got.(PHPArray); !ok || !reflect.DeepEqual(arr, list) {
+		t.Errorf("Expected %d entries back, got %T", len(list), got)
+	}
+}
+
+// TestPHPArrayInvalidKeys tests that keys other than integers and strings are
+// rejected instead of being converted
+func TestPHPArrayInvalidKeys(t *testing.T) {
+	for _, data := range []string{`a:1:{N;i:1;}`, `a:1:{b:1;i:1;}`, `a:1:{d:1.5;i:1;}`, `a:1:{a:0:{}i:1;}`, `O:1:"A":1:{N;i:1;}`} {
+		for _, ordered := range []bool{false, true} {
+			_, err := Unmarshal(data, WithOrderedArrays(ordered))
+			var se *SyntaxError
+			if !errors.As(err, &se) {
+				t.Errorf("%s: expected a SyntaxError, got %v", data, err)
+				continue
+			}
+			if se.Expected != "int or string key" || se.Offset != int64(strings.IndexByte(data, '{')+1) {
+				t.Errorf("%s: expected an int or string key at the key, got %v", data, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package phpserialize
+
+import (
+	"bytes"
+	"unsafe"
+)
+
+// zeroCopyOption implements Option for aliasing decoded strings
+type zeroCopyOption struct {
+	enabled bool
+}
+
+func (o zeroCopyOption) applyMarshal(*marshalConfig) {
+	// No effect on marshal
+}
+
+func (o zeroCopyOption) applyUnmarshal(cfg *unmarshalConfig) {
+	cfg.zeroCopy = o.enabled
+}
+
+// WithZeroCopy makes UnmarshalBytes return strings that share memory with the
+// input slice instead of copying it. The input must not be modified while any
+// decoded value is in use, since the strings would change with it.
+func WithZeroCopy(enabled bool) Option {
+	return zeroCopyOption{enabled: enabled}
+}
+
+// MarshalAppend serializes a Go value and appends it to dst, returning the
+// extended slice. Reusing dst across calls avoids allocating on every call.
+func MarshalAppend(dst []byte, value interface{}, options ...Option) ([]byte, error) {
+	config := newMarshalConfig(options)
+	if config.versionErr != nil {
+		return dst, config.versionErr
+	}
+
+	buf := bytes.NewBuffer(dst)
+	if err := marshalValue(buf, value, config, 0); err != nil {
+		return dst, err
+	}
+	return buf.Bytes(), nil
+}
+
+// UnmarshalBytes converts PHP serialized data held in a byte slice to Go values.
+// The input is copied once, or not at all with WithZeroCopy(true).
+func UnmarshalBytes(data []byte, options ...Option) (interface{}, error) {
+	config := newUnmarshalConfig(options)
+	if config.versionErr != nil {
+		return nil, config.versionErr
+	}
+	reader := &stringReader{data: bytesString(data, config.zeroCopy), pos: 0}
+	value, err := unmarshalValue(reader, config, 0)
+	return value, config.finishError(err, len(data))
+}
+
+// bytesString converts data to a string, sharing its memory when alias is set
+func bytesString(data []byte, alias bool) string {
+	if !alias || len(data) == 0 {
+		return string(data)
+	}
+	return unsafe.String(unsafe.SliceData(data), len(data))
+}
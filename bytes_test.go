@@ -0,0 +1,70 @@
+package phpserialize
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+	"unsafe"
+)
+
+// TestMarshalAppend tests appending serialized data to an existing slice
+func TestMarshalAppend(t *testing.T) {
+	dst := make([]byte, 0, 64)
+	dst = append(dst, "prefix|"...)
+
+	out, err := MarshalAppend(dst, []interface{}{1, "a"})
+	if err != nil {
+		t.Fatalf("MarshalAppend failed: %v", err)
+	}
+	if want := `prefix|a:2:{i:0;i:1;i:1;s:1:"a";}`; string(out) != want {
+		t.Errorf("Expected %s, got %s", want, out)
+	}
+	if &out[0] != &dst[:1][0] {
+		t.Error("Expected output to reuse the capacity of dst")
+	}
+
+	out, err = MarshalAppend(out[:0], map[string]int{"b": 2, "a": 1}, WithKeyOrder(KeyOrderSorted))
+	if err != nil || string(out) != `a:2:{s:1:"a";i:1;s:1:"b";i:2;}` {
+		t.Errorf("Unexpected output %s, error %v", out, err)
+	}
+
+	if _, err := MarshalAppend(nil, make(chan int)); err == nil {
+		t.Error("Expected error for unsupported type")
+	}
+}
+
+// TestUnmarshalBytes tests decoding from a byte slice with and without aliasing
+func TestUnmarshalBytes(t *testing.T) {
+	data := []byte(`a:2:{s:4:"name";s:5:"Alice";i:0;s:3:"bob";}`)
+	want := MustUnmarshal(string(data))
+
+	copied, err := UnmarshalBytes(data)
+	if err != nil {
+		t.Fatalf("UnmarshalBytes failed: %v", err)
+	}
+	aliased, err := UnmarshalBytes(data, WithZeroCopy(true))
+	if err != nil {
+		t.Fatalf("UnmarshalBytes failed: %v", err)
+	}
+	if !reflect.DeepEqual(copied, want) || !reflect.DeepEqual(aliased, want) {
+		t.Fatalf("Expected %#v, got %#v and %#v", want, copied, aliased)
+	}
+
+	// Aliased strings point into the input; copied ones do not
+	name := aliased.(map[string]interface{})["name"].(string)
+	start := uintptr(unsafe.Pointer(&data[0]))
+	if p := uintptr(unsafe.Pointer(unsafe.StringData(name))); p < start || p >= start+uintptr(len(data)) {
+		t.Error("Expected zero-copy string to alias the input")
+	}
+	copy(data[bytes.Index(data, []byte("Alice")):], "Carol")
+	if name != "Carol" {
+		t.Errorf("Expected aliased string to follow the input, got %q", name)
+	}
+	if s := copied.(map[string]interface{})["name"]; s != "Alice" {
+		t.Errorf("Expected copied string to be unaffected, got %q", s)
+	}
+
+	if _, err := UnmarshalBytes([]byte(`s:5:"abc";`), WithZeroCopy(true)); err == nil {
+		t.Error("Expected error for truncated string")
+	}
+}
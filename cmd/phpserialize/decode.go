@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/stlong5/phpserialize"
+)
+
+// jsonFlags are the json_encode flags used for readable output
+const jsonFlags = phpserialize.JSONUnescapedSlashes | phpserialize.JSONUnescapedUnicode
+
+func runDecode(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fs := newFlagSet("decode", "[file ...]", stderr)
+	format := fs.String("format", "json", "output format: json, tagged (lossless JSON), var_dump, print_r or var_export")
+	pretty := fs.Bool("pretty", false, "indent JSON output")
+	flags := addDecodeFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	inputs, err := readInputs(fs, stdin)
+	if err != nil {
+		return fail(stderr, "decode", err)
+	}
+	for _, in := range inputs {
+		out, err := decode(in.data, *format, *pretty, flags.options)
+		if err != nil {
+			return fail(stderr, "decode", fmt.Errorf("%s: %w", in.name, err))
+		}
+		fmt.Fprintln(stdout, out)
+	}
+	return 0
+}
+
+// decode renders serialized data in the given format
+func decode(data, format string, pretty bool, options []phpserialize.Option) (string, error) {
+	switch format {
+	case "json", "tagged":
+		mode := phpserialize.JSONPlain
+		if format == "tagged" {
+			mode = phpserialize.JSONTagged
+		}
+		flags := jsonFlags
+		if pretty {
+			flags |= phpserialize.JSONPrettyPrint
+		}
+		out, err := phpserialize.ToJSON(data, mode, append(options[:len(options):len(options)], phpserialize.WithJSONFlags(flags))...)
+		if err != nil {
+			return "", err
+		}
+		if pretty && mode == phpserialize.JSONTagged {
+			return indentJSON(out)
+		}
+		return string(out), nil
+	case "var_dump", "print_r", "var_export":
+		value, err := phpserialize.Unmarshal(data, append(options[:len(options):len(options)], phpserialize.WithOrderedArrays(true))...)
+		if err != nil {
+			return "", err
+		}
+		var buf strings.Builder
+		switch format {
+		case "var_dump":
+			err = phpserialize.Dump(&buf, value)
+		case "print_r":
+			err = phpserialize.PrintR(&buf, value)
+		default:
+			err = phpserialize.VarExport(&buf, value)
+		}
+		return strings.TrimSuffix(buf.String(), "\n"), err
+	}
+	return "", fmt.Errorf("unknown format %q", format)
+}
+
+// indentJSON indents JSON the way JSONPrettyPrint does
+func indentJSON(data []byte) (string, error) {
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, data, "", "    "); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+func runEncode(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fs := newFlagSet("encode", "[file ...]", stderr)
+	tagged := fs.Bool("tagged", false, "read tagged JSON as written by decode -format tagged")
+	flags := addDecodeFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	mode := phpserialize.JSONPlain
+	if *tagged {
+		mode = phpserialize.JSONTagged
+	}
+	inputs, err := readInputs(fs, stdin)
+	if err != nil {
+		return fail(stderr, "encode", err)
+	}
+	for _, in := range inputs {
+		out, err := phpserialize.FromJSON([]byte(in.data), mode, flags.options...)
+		if err != nil {
+			return fail(stderr, "encode", fmt.Errorf("%s: %w", in.name, err))
+		}
+		// No newline, so the output can be stored as is
+		io.WriteString(stdout, out)
+	}
+	return 0
+}
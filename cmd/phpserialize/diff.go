@@ -0,0 +1,39 @@
+package main
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/stlong5/phpserialize"
+)
+
+// runDiff exits like diff(1): 0 when the values are equal, 1 when they
+// differ and 2 on errors
+func runDiff(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fs := newFlagSet("diff", "<old> <new>", stderr)
+	flags := addDecodeFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return 2
+	}
+
+	inputs, err := readInputs(fs, stdin)
+	if err != nil {
+		fail(stderr, "diff", err)
+		return 2
+	}
+	changes, err := phpserialize.Diff(inputs[0].data, inputs[1].data, flags.options...)
+	if err != nil {
+		fail(stderr, "diff", err)
+		return 2
+	}
+	if len(changes) == 0 {
+		return 0
+	}
+	fmt.Fprintf(stdout, "--- %s\n+++ %s\n", inputs[0].name, inputs[1].name)
+	io.WriteString(stdout, phpserialize.FormatDiff(changes))
+	return 1
+}
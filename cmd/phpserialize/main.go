@@ -0,0 +1,172 @@
+// Command phpserialize works with PHP serialized data from the command line.
+//
+// Usage:
+//
+//	phpserialize <command> [flags] [file ...]
+//
+// The commands are:
+//
+//	decode       print serialized data as JSON or like var_dump, print_r or var_export
+//	diff         show the changes between two serialized values
+//	encode       convert JSON to serialized data
+//	validate     check that files hold valid serialized data
+//	repair       fix string lengths broken by a search-and-replace
+//	query        print the value at a path such as users.0.name
+//	replace-sql  replace text in a MySQL dump, fixing serialized values
+//
+// Input is read from the files, or from standard input when none is given or
+// the name is "-", and output is written to standard output. The decoding
+// commands accept --max-depth and --allowed-classes, which correspond to the
+// WithMaxDepth and WithAllowedClasses options of the library.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/stlong5/phpserialize"
+)
+
+// command is a subcommand; run returns the process exit code
+type command struct {
+	summary string
+	run     func(args []string, stdin io.Reader, stdout, stderr io.Writer) int
+}
+
+var commands = map[string]command{
+	"decode":      {"print serialized data as JSON or like var_dump, print_r or var_export", runDecode},
+	"diff":        {"show the changes between two serialized values", runDiff},
+	"encode":      {"convert JSON to serialized data", runEncode},
+	"validate":    {"check that files hold valid serialized data", runValidate},
+	"repair":      {"fix string lengths broken by a search-and-replace", runRepair},
+	"query":       {"print the value at a path such as users.0.name", runQuery},
+	"replace-sql": {"replace text in a MySQL dump, fixing serialized values", runReplaceSQL},
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// run dispatches to the subcommand named by args[0]
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	if len(args) == 0 || args[0] == "-h" || args[0] == "-help" || args[0] == "--help" || args[0] == "help" {
+		usage(stderr)
+		return 2
+	}
+	cmd, ok := commands[args[0]]
+	if !ok {
+		fmt.Fprintf(stderr, "phpserialize: unknown command %q\n", args[0])
+		usage(stderr)
+		return 2
+	}
+	return cmd.run(args[1:], stdin, stdout, stderr)
+}
+
+func usage(w io.Writer) {
+	fmt.Fprintln(w, "Usage: phpserialize <command> [flags] [file ...]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Commands:")
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(w, "  %-12s %s\n", name, commands[name].summary)
+	}
+}
+
+// newFlagSet returns the flag set of a subcommand, reporting errors to stderr
+func newFlagSet(name, args string, stderr io.Writer) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintf(stderr, "Usage: phpserialize %s [flags] %s\n", name, args)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// decodeFlags holds the flags that map onto decoding options
+type decodeFlags struct {
+	options []phpserialize.Option
+}
+
+// addDecodeFlags registers --max-depth and --allowed-classes on fs
+func addDecodeFlags(fs *flag.FlagSet) *decodeFlags {
+	f := &decodeFlags{}
+	fs.Func("max-depth", "maximum nesting depth (default 4096, like PHP)", func(s string) error {
+		depth, err := strconv.Atoi(s)
+		if err != nil || depth < 0 {
+			return fmt.Errorf("invalid depth %q", s)
+		}
+		f.options = append(f.options, phpserialize.WithMaxDepth(depth))
+		return nil
+	})
+	fs.Func("allowed-classes", "comma-separated classes that may be decoded; empty allows none (default all)", func(s string) error {
+		var classes []string
+		for _, class := range strings.Split(s, ",") {
+			if class = strings.TrimSpace(class); class != "" {
+				classes = append(classes, class)
+			}
+		}
+		f.options = append(f.options, phpserialize.WithAllowedClasses(classes))
+		return nil
+	})
+	return f
+}
+
+// input is the contents of one input file
+type input struct {
+	name string
+	data string
+}
+
+// readInputs reads the files named by the remaining arguments, or stdin
+func readInputs(fs *flag.FlagSet, stdin io.Reader) ([]input, error) {
+	names := fs.Args()
+	if len(names) == 0 {
+		names = []string{"-"}
+	}
+	inputs := make([]input, 0, len(names))
+	for _, name := range names {
+		var data []byte
+		var err error
+		if name == "-" {
+			name = "<stdin>"
+			data, err = io.ReadAll(stdin)
+		} else {
+			data, err = os.ReadFile(name)
+		}
+		if err != nil {
+			return nil, err
+		}
+		inputs = append(inputs, input{name: name, data: string(data)})
+	}
+	return inputs, nil
+}
+
+// openInput opens the file named by the remaining arguments, or stdin
+func openInput(fs *flag.FlagSet, stdin io.Reader) (io.ReadCloser, error) {
+	switch fs.NArg() {
+	case 0:
+		return io.NopCloser(stdin), nil
+	case 1:
+		if fs.Arg(0) == "-" {
+			return io.NopCloser(stdin), nil
+		}
+		return os.Open(fs.Arg(0))
+	}
+	return nil, fmt.Errorf("too many arguments")
+}
+
+// fail reports an error for the subcommand and returns the exit code
+func fail(stderr io.Writer, name string, err error) int {
+	fmt.Fprintf(stderr, "phpserialize %s: %v\n", name, err)
+	return 1
+}
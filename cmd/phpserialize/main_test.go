@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// runCommand runs the command line with the given input
+func runCommand(t *testing.T, input string, args ...string) (code int, stdout, stderr string) {
+	t.Helper()
+	var out, errOut bytes.Buffer
+	code = run(args, strings.NewReader(input), &out, &errOut)
+	return code, out.String(), errOut.String()
+}
+
+// TestUsage tests unknown and missing commands
+func TestUsage(t *testing.T) {
+	if code, _, stderr := runCommand(t, ""); code != 2 || !strings.Contains(stderr, "replace-sql") {
+		t.Errorf("Expected usage with exit code 2, got %d: %s", code, stderr)
+	}
+	if code, _, stderr := runCommand(t, "", "nope"); code != 2 || !strings.Contains(stderr, `unknown command "nope"`) {
+		t.Errorf("Expected unknown command error, got %d: %s", code, stderr)
+	}
+}
+
+// TestReplaceSQL tests the replace-sql command
+func TestReplaceSQL(t *testing.T) {
+	dump := "INSERT INTO `t` VALUES ('a:1:{i:0;s:14:\\\"http://old.dev\\\";}','http://old.dev/x');\n"
+	want := "INSERT INTO `t` VALUES ('a:1:{i:0;s:15:\\\"https://new.dev\\\";}','https://new.dev/x');\n"
+
+	code, stdout, stderr := runCommand(t, dump, "replace-sql", "-old", "http://old.dev", "-new", "https://new.dev")
+	if code != 0 {
+		t.Fatalf("Expected exit code 0, got %d: %s", code, stderr)
+	}
+	if stdout != want {
+		t.Errorf("Expected %s, got %s", want, stdout)
+	}
+	if !strings.Contains(stderr, "2 literals changed") {
+		t.Errorf("Expected summary on stderr, got %q", stderr)
+	}
+
+	code, stdout, _ = runCommand(t, dump, "replace-sql", "-regexp", "-old", `http://(old)\.dev`, "-new", "https://new.dev")
+	if code != 0 || stdout != want {
+		t.Errorf("Expected regexp replacement, got %d: %s", code, stdout)
+	}
+
+	broken := "INSERT INTO `t` VALUES ('a:1:{i:0;s:9:\\\"http://old.dev\\\";}');\n"
+	code, _, stderr = runCommand(t, broken, "replace-sql", "-old", "http://old.dev", "-new", "https://new.dev")
+	if code != 0 || !strings.Contains(stderr, "offset 24: replaced as plain text") ||
+		!strings.Contains(stderr, "1 literals looked serialized but did not parse") {
+		t.Errorf("Expected fallback report on stderr, got %d: %q", code, stderr)
+	}
+
+	if code, _, _ := runCommand(t, dump, "replace-sql"); code != 2 {
+		t.Errorf("Expected exit code 2 without -old, got %d", code)
+	}
+}
+
+// TestDecodeEncode tests converting to JSON and back
+func TestDecodeEncode(t *testing.T) {
+	data := `a:2:{s:4:"name";s:3:"Ann";s:4:"tags";a:1:{i:0;s:1:"x";}}`
+
+	code, stdout, stderr := runCommand(t, data, "decode")
+	if code != 0 || stdout != `{"name":"Ann","tags":["x"]}`+"\n" {
+		t.Errorf("Unexpected JSON output %d: %s%s", code, stdout, stderr)
+	}
+
+	code, stdout, _ = runCommand(t, data, "decode", "-format", "var_dump")
+	want := "array(2) {\n  [\"name\"]=>\n  string(3) \"Ann\"\n  [\"tags\"]=>\n  array(1) {\n    [0]=>\n    string(1) \"x\"\n  }\n}\n"
+	if code != 0 || stdout != want {
+		t.Errorf("Expected\n%s\ngot %d\n%s", want, code, stdout)
+	}
+
+	code, stdout, _ = runCommand(t, data, "decode", "-format", "var_export")
+	want = "array (\n  'name' => 'Ann',\n  'tags' => \n  array (\n    0 => 'x',\n  ),\n)\n"
+	if code != 0 || stdout != want {
+		t.Errorf("Expected\n%s\ngot %d\n%s", want, code, stdout)
+	}
+
+	_, tagged, _ := runCommand(t, data, "decode", "-format", "tagged", "-pretty")
+	code, stdout, stderr = runCommand(t, tagged, "encode", "-tagged")
+	if code != 0 || stdout != data {
+		t.Errorf("Expected tagged round trip to %s, got %d: %s%s", data, code, stdout, stderr)
+	}
+
+	code, stdout, _ = runCommand(t, `{"a":[1,2.5]}`, "encode")
+	if code != 0 || stdout != `a:1:{s:1:"a";a:2:{i:0;i:1;i:1;d:2.5;}}` {
+		t.Errorf("Unexpected encode output %d: %s", code, stdout)
+	}
+}
+
+// TestDecodeFlags tests --max-depth and --allowed-classes
+func TestDecodeFlags(t *testing.T) {
+	data := `a:1:{i:0;a:1:{i:0;O:4:"User":0:{}}}`
+	if code, _, stderr := runCommand(t, data, "decode", "--max-depth", "2"); code != 1 || !strings.Contains(stderr, "max depth") {
+		t.Errorf("Expected depth error, got %d: %s", code, stderr)
+	}
+	if code, _, stderr := runCommand(t, data, "decode", "--allowed-classes", "Post, Comment"); code != 1 || !strings.Contains(stderr, `class "User" not allowed`) {
+		t.Errorf("Expected class error, got %d: %s", code, stderr)
+	}
+	if code, _, stderr := runCommand(t, data, "decode", "--allowed-classes", "User"); code != 0 {
+		t.Errorf("Expected success, got %d: %s", code, stderr)
+	}
+}
+
+// TestValidate tests exit codes and PHP-style errors
+func TestValidate(t *testing.T) {
+	if code, stdout, _ := runCommand(t, `a:1:{i:0;b:1;}`, "validate"); code != 0 || stdout != "" {
+		t.Errorf("Expected valid data to pass silently, got %d: %s", code, stdout)
+	}
+	code, stdout, _ := runCommand(t, `a:1:{i:0;s:5:"abc";}`, "validate")
+	if code != 1 || !strings.HasPrefix(stdout, "<stdin>: Error at offset 9 of 20 bytes\n") {
+		t.Errorf("Expected PHP-style error, got %d: %s", code, stdout)
+	}
+}
+
+// TestRepairQuery tests the repair and query commands
+func TestRepairQuery(t *testing.T) {
+	code, stdout, stderr := runCommand(t, `a:1:{s:3:"url";s:5:"https://x";}`, "repair")
+	if code != 0 || stdout != `a:1:{s:3:"url";s:9:"https://x";}` || !strings.Contains(stderr, "1 strings fixed") {
+		t.Errorf("Unexpected repair output %d: %s %s", code, stdout, stderr)
+	}
+
+	data := `a:1:{s:5:"users";a:1:{i:0;O:4:"User":1:{s:7:"` + "\x00*\x00name" + `";s:3:"Ann";}}}`
+	code, stdout, _ = runCommand(t, data, "query", "users.0.name")
+	if code != 0 || stdout != "\"Ann\"\n" {
+		t.Errorf("Unexpected query output %d: %s", code, stdout)
+	}
+	if code, _, stderr := runCommand(t, data, "query", "users.1"); code != 1 || !strings.Contains(stderr, "users.1 not found") {
+		t.Errorf("Expected not found, got %d: %s", code, stderr)
+	}
+}
+
+// TestDiff tests the diff command and its exit codes
+func TestDiff(t *testing.T) {
+	dir := t.TempDir()
+	old := filepath.Join(dir, "old.txt")
+	new := filepath.Join(dir, "new.txt")
+	if err := os.WriteFile(old, []byte(`a:2:{s:1:"a";i:1;s:1:"b";i:5;}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(new, []byte(`a:2:{s:1:"a";i:1;s:1:"b";s:1:"5";}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	code, stdout, stderr := runCommand(t, "", "diff", old, new)
+	want := "--- " + old + "\n+++ " + new + "\n-b: int(5)\n+b: string(1) \"5\"\n"
+	if code != 1 || stdout != want {
+		t.Errorf("Expected exit code 1 and\n%s\ngot %d\n%s%s", want, code, stdout, stderr)
+	}
+	if code, stdout, _ := runCommand(t, `a:2:{s:1:"a";i:1;s:1:"b";i:5;}`, "diff", "-", old); code != 0 || stdout != "" {
+		t.Errorf("Expected no output for equal values, got %d: %s", code, stdout)
+	}
+	if code, _, _ := runCommand(t, "", "diff", old); code != 2 {
+		t.Errorf("Expected exit code 2 with one file, got %d", code)
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/stlong5/phpserialize"
+)
+
+func runQuery(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fs := newFlagSet("query", "<path> [file ...]", stderr)
+	format := fs.String("format", "json", "output format: json, tagged (lossless JSON), var_dump, print_r or var_export")
+	flags := addDecodeFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return 2
+	}
+	path := fs.Arg(0)
+	if err := fs.Parse(fs.Args()[1:]); err != nil {
+		return 2
+	}
+
+	inputs, err := readInputs(fs, stdin)
+	if err != nil {
+		return fail(stderr, "query", err)
+	}
+	code := 0
+	if path == "." {
+		path = ""
+	}
+	options := append(flags.options[:len(flags.options):len(flags.options)], phpserialize.WithOrderedArrays(true))
+	for _, in := range inputs {
+		value, err := phpserialize.Get(in.data, path, options...)
+		if errors.Is(err, phpserialize.ErrPathNotFound) {
+			fmt.Fprintf(stderr, "%s: %s not found\n", in.name, path)
+			code = 1
+			continue
+		}
+		if err != nil {
+			return fail(stderr, "query", fmt.Errorf("%s: %w", in.name, err))
+		}
+		data, err := phpserialize.Marshal(value)
+		if err != nil {
+			return fail(stderr, "query", err)
+		}
+		out, err := decode(data, *format, false, nil)
+		if err != nil {
+			return fail(stderr, "query", fmt.Errorf("%s: %w", in.name, err))
+		}
+		fmt.Fprintln(stdout, out)
+	}
+	return code
+}
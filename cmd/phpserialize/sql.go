@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/stlong5/phpserialize"
+)
+
+func runReplaceSQL(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fs := newFlagSet("replace-sql", "[dump.sql]", stderr)
+	old := fs.String("old", "", "text to replace")
+	new := fs.String("new", "", "replacement text")
+	useRegexp := fs.Bool("regexp", false, "treat -old as a regular expression and -new as its template")
+	keys := fs.Bool("keys", false, "also replace in array keys and property names")
+	classNames := fs.Bool("class-names", false, "also replace in class names")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *old == "" {
+		fmt.Fprintln(stderr, "phpserialize replace-sql: -old is required")
+		fs.Usage()
+		return 2
+	}
+
+	options := []phpserialize.Option{
+		phpserialize.WithReplaceKeys(*keys),
+		phpserialize.WithReplaceClassNames(*classNames),
+	}
+	replace := func(s string) string { return strings.ReplaceAll(s, *old, *new) }
+	if *useRegexp {
+		re, err := regexp.Compile(*old)
+		if err != nil {
+			return fail(stderr, "replace-sql", err)
+		}
+		replace = func(s string) string { return re.ReplaceAllString(s, *new) }
+	}
+
+	in, err := openInput(fs, stdin)
+	if err != nil {
+		return fail(stderr, "replace-sql", err)
+	}
+	defer in.Close()
+
+	changed, fallbacks, err := phpserialize.ReplaceSQLDumpFunc(stdout, in, replace, options...)
+	if err != nil {
+		return fail(stderr, "replace-sql", err)
+	}
+	for _, fb := range fallbacks {
+		fmt.Fprintf(stderr, "offset %d: replaced as plain text: %v\n", fb.Offset, fb.Err)
+	}
+	fmt.Fprintf(stderr, "%d literals changed\n", changed)
+	if len(fallbacks) > 0 {
+		fmt.Fprintf(stderr, "%d literals looked serialized but did not parse\n", len(fallbacks))
+	}
+	return 0
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/stlong5/phpserialize"
+)
+
+func runValidate(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fs := newFlagSet("validate", "[file ...]", stderr)
+	flags := addDecodeFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	inputs, err := readInputs(fs, stdin)
+	if err != nil {
+		return fail(stderr, "validate", err)
+	}
+	// The error reads like PHP's unserialize() notice, with details after it
+	options := append(flags.options[:len(flags.options):len(flags.options)], phpserialize.WithPHPErrors(true))
+	code := 0
+	for _, in := range inputs {
+		_, err := phpserialize.Unmarshal(in.data, options...)
+		if err != nil {
+			fmt.Fprintf(stdout, "%s: %v\n", in.name, err)
+			var se *phpserialize.SyntaxError
+			if errors.As(err, &se) {
+				fmt.Fprintf(stdout, "%s: %s at position %d", in.name, se.Msg, se.Offset)
+				if se.Path != "" {
+					fmt.Fprintf(stdout, " (path %s)", se.Path)
+				}
+				fmt.Fprintln(stdout)
+			}
+			code = 1
+		}
+	}
+	return code
+}
+
+func runRepair(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fs := newFlagSet("repair", "[file]", stderr)
+	quiet := fs.Bool("q", false, "do not list the fixes")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() > 1 {
+		fs.Usage()
+		return 2
+	}
+
+	inputs, err := readInputs(fs, stdin)
+	if err != nil {
+		return fail(stderr, "repair", err)
+	}
+	repaired, fixes, err := phpserialize.Repair(inputs[0].data)
+	if err != nil {
+		return fail(stderr, "repair", err)
+	}
+	io.WriteString(stdout, repaired)
+	if !*quiet {
+		for _, fix := range fixes {
+			fmt.Fprintf(stderr, "offset %d: string length %d -> %d\n", fix.Offset, fix.Declared, fix.Actual)
+		}
+		fmt.Fprintf(stderr, "%d strings fixed\n", len(fixes))
+	}
+	return 0
+}
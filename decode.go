@@ -0,0 +1,583 @@
+package phpserialize
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// UnmarshalTo un-serializes PHP data into the Go value pointed to by v.
+// Structs are populated by their `php` field tags (falling back to a case-insensitive
+// field name match), and typed slices, arrays, maps, pointers and basic types are
+// converted from the corresponding PHP types. Conversion errors name the path of
+// the value that failed, e.g. "users.0.id".
+func UnmarshalTo(data string, v interface{}, options ...Option) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return fmt.Errorf("UnmarshalTo requires a non-nil pointer, got %T", v)
+	}
+
+	config := newUnmarshalConfig(options)
+	if config.versionErr != nil {
+		return config.versionErr
+	}
+	reader := &stringReader{data: data, pos: 0}
+	return config.finishError(decodeInto(reader, config, 0, rv.Elem(), ""), len(data))
+}
+
+// decodeInto un-serializes the next value directly into dst
+func decodeInto(r *stringReader, cfg *unmarshalConfig, depth int, dst reflect.Value, path string) error {
+	if cfg.maxDepth > 0 && depth >= cfg.maxDepth {
+		return syntaxPath(maxDepthError(r.pos, cfg.maxDepth), path)
+	}
+
+	typeChar, err := r.peek()
+	if err != nil {
+		return syntaxPath(err, path)
+	}
+
+	// Types implementing Unmarshaler receive the raw bytes of the value
+	if typeChar != 'r' && typeChar != 'R' && !(typeChar == 'N' && dst.Kind() == reflect.Ptr) {
+		if u, ok := unmarshalerOf(dst); ok {
+			start, slot := r.pos, len(r.vars)
+			if _, err := unmarshalValue(r, cfg, depth); err != nil {
+				return syntaxPath(err, path)
+			}
+			if err := u.UnmarshalPHP([]byte(r.slice(start, r.pos))); err != nil {
+				return fmt.Errorf("at position %d: %w", start, pathError(path, err))
+			}
+			r.vars[slot] = dst.Interface()
+			return nil
+		}
+	}
+
+	// Pointers are allocated as needed and decoded through; references
+	// are resolved below so that they can share the referenced pointer
+	if dst.Kind() == reflect.Ptr && typeChar != 'r' && typeChar != 'R' {
+		if typeChar == 'N' {
+			if _, err := unmarshalValue(r, cfg, depth); err != nil {
+				return syntaxPath(err, path)
+			}
+			dst.Set(reflect.Zero(dst.Type()))
+			return nil
+		}
+		if dst.IsNil() {
+			dst.Set(reflect.New(dst.Type().Elem()))
+		}
+		slot := len(r.vars)
+		if err := decodeInto(r, cfg, depth, dst.Elem(), path); err != nil {
+			return err
+		}
+		if slot < len(r.vars) {
+			r.vars[slot] = dst.Interface()
+		}
+		return nil
+	}
+
+	if (typeChar == 'a' || typeChar == 'O') && !isEmptyInterface(dst) {
+		return decodeArrayInto(r, cfg, depth, dst, path)
+	}
+
+	start := r.pos
+	value, err := unmarshalValue(r, cfg, depth)
+	if err != nil {
+		return syntaxPath(err, path)
+	}
+	if err := assignValue(dst, value, path); err != nil {
+		return fmt.Errorf("at position %d: %w", start, err)
+	}
+	return nil
+}
+
+// unmarshalerOf returns the Unmarshaler implemented by dst or by a pointer to it,
+// allocating dst when it is a nil pointer
+func unmarshalerOf(dst reflect.Value) (Unmarshaler, bool) {
+	if dst.Kind() != reflect.Ptr && dst.CanAddr() {
+		if u, ok := dst.Addr().Interface().(Unmarshaler); ok {
+			return u, true
+		}
+	}
+	if dst.Kind() == reflect.Ptr && dst.Type().Implements(unmarshalerType) {
+		if dst.IsNil() {
+			dst.Set(reflect.New(dst.Type().Elem()))
+		}
+		return dst.Interface().(Unmarshaler), true
+	}
+	return nil, false
+}
+
+var unmarshalerType = reflect.TypeOf((*Unmarshaler)(nil)).Elem()
+
+// decodeArrayInto un-serializes an array or object into a struct, map, slice or array
+func decodeArrayInto(r *stringReader, cfg *unmarshalConfig, depth int, dst reflect.Value, path string) (err error) {
+	start := r.pos
+	defer func() {
+		if err != nil {
+			markValueStart(err, start)
+		}
+	}()
+
+	typeChar, err := r.read()
+	if err != nil {
+		return syntaxPath(err, path)
+	}
+	colon, err := r.read()
+	if err != nil {
+		return syntaxPath(err, path)
+	}
+	if colon != ':' {
+		return syntaxPath(expectError(r.pos-1, "':'", fmt.Sprintf("after type '%c'", typeChar), colon), path)
+	}
+
+	slot := len(r.vars)
+	r.vars = append(r.vars, nil)
+
+	var count int
+	if typeChar == 'O' {
+		if _, err := readClassName(r, cfg, typeChar); err != nil {
+			return syntaxPath(err, path)
+		}
+		count, err = readCount(r, "property count", "object properties")
+	} else {
+		count, err = readCount(r, "array count", "array")
+	}
+	if err != nil {
+		return syntaxPath(err, path)
+	}
+
+	target, err := newArrayTarget(dst, r.maxEntries(count))
+	if err != nil {
+		return fmt.Errorf("at position %d: %w", start, pathError(path, err))
+	}
+
+	for i := 0; i < count; i++ {
+		key, err := unmarshalKey(r, cfg, depth+1)
+		if err != nil {
+			return syntaxPath(err, path)
+		}
+		if name, ok := key.(string); ok && typeChar == 'O' {
+			key = bareName(name)
+		}
+
+		keyPos := r.pos
+		elem, ok, err := target.entry(key)
+		if err != nil {
+			return fmt.Errorf("at position %d: %w", keyPos, pathError(joinPath(path, key), err))
+		}
+		if !ok {
+			// Unknown entries are skipped but still take their slots
+			if _, err := unmarshalValue(r, cfg, depth+1); err != nil {
+				return syntaxPath(err, joinPath(path, key))
+			}
+			continue
+		}
+		if err := decodeInto(r, cfg, depth+1, elem, joinPath(path, key)); err != nil {
+			return err
+		}
+		target.commit()
+	}
+	target.finish()
+
+	// Read closing brace
+	brace, err := r.read()
+	if err != nil {
+		return syntaxPath(err, path)
+	}
+	if brace != '}' {
+		return syntaxPath(expectError(r.pos-1, "'}'", "for array", brace), path)
+	}
+
+	r.vars[slot] = dst.Interface()
+	return nil
+}
+
+// arrayTarget receives the entries of a PHP array or object decoded into a Go value
+type arrayTarget struct {
+	dst     reflect.Value
+	index   int
+	mapKey  reflect.Value
+	mapElem reflect.Value
+}
+
+func newArrayTarget(dst reflect.Value, count int) (*arrayTarget, error) {
+	switch dst.Kind() {
+	case reflect.Struct, reflect.Array:
+	case reflect.Map:
+		switch dst.Type().Key().Kind() {
+		case reflect.String,
+			reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		default:
+			return nil, fmt.Errorf("cannot unmarshal array into map with key type %s", dst.Type().Key())
+		}
+		if dst.IsNil() {
+			dst.Set(reflect.MakeMapWithSize(dst.Type(), count))
+		}
+	case reflect.Slice:
+		dst.Set(reflect.MakeSlice(dst.Type(), 0, count))
+	default:
+		return nil, fmt.Errorf("cannot unmarshal array into Go value of type %s", dst.Type())
+	}
+	return &arrayTarget{dst: dst}, nil
+}
+
+// entry returns the Go value the entry with the given key is decoded into.
+// It reports false for entries that have no destination.
+func (t *arrayTarget) entry(key interface{}) (reflect.Value, bool, error) {
+	switch t.dst.Kind() {
+	case reflect.Struct:
+		f, ok := findStructField(t.dst.Type(), keyString(key))
+		if !ok {
+			return reflect.Value{}, false, nil
+		}
+		field, ok := fieldByIndexAlloc(t.dst, f.index)
+		return field, ok, nil
+
+	case reflect.Map:
+		mapKey, err := convertMapKey(key, t.dst.Type().Key())
+		if err != nil {
+			return reflect.Value{}, false, err
+		}
+		t.mapKey = mapKey
+		t.mapElem = reflect.New(t.dst.Type().Elem()).Elem()
+		return t.mapElem, true, nil
+
+	case reflect.Slice:
+		t.dst.Set(reflect.Append(t.dst, reflect.Zero(t.dst.Type().Elem())))
+		return t.dst.Index(t.dst.Len() - 1), true, nil
+
+	case reflect.Array:
+		if t.index >= t.dst.Len() {
+			return reflect.Value{}, false, nil
+		}
+		t.index++
+		return t.dst.Index(t.index - 1), true, nil
+	}
+	return reflect.Value{}, false, nil
+}
+
+// commit stores the entry returned by the last call to entry
+func (t *arrayTarget) commit() {
+	if t.dst.Kind() == reflect.Map {
+		t.dst.SetMapIndex(t.mapKey, t.mapElem)
+	}
+}
+
+// finish zeroes the trailing elements of a Go array that had no PHP entry
+func (t *arrayTarget) finish() {
+	if t.dst.Kind() == reflect.Array {
+		for i := t.index; i < t.dst.Len(); i++ {
+			t.dst.Index(i).Set(reflect.Zero(t.dst.Type().Elem()))
+		}
+	}
+}
+
+// assignValue stores an un-serialized value into dst, converting it to dst's type
+func assignValue(dst reflect.Value, value interface{}, path string) error {
+	if value == nil {
+		dst.Set(reflect.Zero(dst.Type()))
+		return nil
+	}
+
+	src := reflect.ValueOf(value)
+	if src.Type().AssignableTo(dst.Type()) {
+		dst.Set(src)
+		return nil
+	}
+
+	switch dst.Kind() {
+	case reflect.Ptr:
+		// Values decoded into pointers are kept as pointers in the reference table
+		if src.Kind() == reflect.Ptr && src.Type().Elem().AssignableTo(dst.Type().Elem()) {
+			dst.Set(reflect.New(dst.Type().Elem()))
+			dst.Elem().Set(src.Elem())
+			return nil
+		}
+		elem := reflect.New(dst.Type().Elem())
+		if err := assignValue(elem.Elem(), value, path); err != nil {
+			return err
+		}
+		dst.Set(elem)
+		return nil
+	case reflect.Interface:
+		if src.Type().Implements(dst.Type()) {
+			dst.Set(src)
+			return nil
+		}
+	}
+
+	if src.Kind() == reflect.Ptr {
+		if src.IsNil() {
+			dst.Set(reflect.Zero(dst.Type()))
+			return nil
+		}
+		return assignValue(dst, src.Elem().Interface(), path)
+	}
+
+	switch v := value.(type) {
+	case bool:
+		if dst.Kind() == reflect.Bool {
+			dst.SetBool(v)
+			return nil
+		}
+
+	case int64:
+		switch dst.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			if dst.OverflowInt(v) {
+				return pathError(path, fmt.Errorf("integer %d overflows Go value of type %s", v, dst.Type()))
+			}
+			dst.SetInt(v)
+			return nil
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+			if v < 0 || dst.OverflowUint(uint64(v)) {
+				return pathError(path, fmt.Errorf("integer %d overflows Go value of type %s", v, dst.Type()))
+			}
+			dst.SetUint(uint64(v))
+			return nil
+		case reflect.Float32, reflect.Float64:
+			dst.SetFloat(float64(v))
+			return nil
+		}
+
+	case float64:
+		switch dst.Kind() {
+		case reflect.Float32, reflect.Float64:
+			if dst.Kind() == reflect.Float32 && !math.IsInf(v, 0) && !math.IsNaN(v) && dst.OverflowFloat(v) {
+				return pathError(path, fmt.Errorf("float %v overflows Go value of type %s", v, dst.Type()))
+			}
+			dst.SetFloat(v)
+			return nil
+		}
+
+	case string:
+		switch {
+		case dst.Kind() == reflect.String:
+			dst.SetString(v)
+			return nil
+		case dst.Kind() == reflect.Slice && dst.Type().Elem().Kind() == reflect.Uint8:
+			dst.SetBytes([]byte(v))
+			return nil
+		}
+
+	case []interface{}:
+		if isArrayDestination(dst) {
+			target, err := newArrayTarget(dst, len(v))
+			if err != nil {
+				return pathError(path, err)
+			}
+			for i, elemValue := range v {
+				if err := assignEntry(target, int64(i), elemValue, path); err != nil {
+					return err
+				}
+			}
+			target.finish()
+			return nil
+		}
+
+	case map[string]interface{}:
+		if isArrayDestination(dst) {
+			return assignEntries(dst, v, path)
+		}
+
+	case PHPObject:
+		if isArrayDestination(dst) {
+			props := make(map[string]interface{}, len(v.Properties))
+			for key := range v.Properties {
+				name := bareName(key)
+				props[name], _ = v.Get(name)
+			}
+			return assignEntries(dst, props, path)
+		}
+
+	case PHPArray:
+		if isArrayDestination(dst) {
+			target, err := newArrayTarget(dst, len(v))
+			if err != nil {
+				return pathError(path, err)
+			}
+			for _, e := range v {
+				if err := assignEntry(target, e.Key, e.Value, path); err != nil {
+					return err
+				}
+			}
+			target.finish()
+			return nil
+		}
+	}
+
+	return pathError(path, fmt.Errorf("cannot unmarshal %s into Go value of type %s", phpTypeName(value), dst.Type()))
+}
+
+// assignEntries stores the entries of a decoded PHP array or object, integer keys first in order
+func assignEntries(dst reflect.Value, entries map[string]interface{}, path string) error {
+	target, err := newArrayTarget(dst, len(entries))
+	if err != nil {
+		return pathError(path, err)
+	}
+
+	keys := make([]interface{}, 0, len(entries))
+	for k := range entries {
+		if n, err := strconv.ParseInt(k, 10, 64); err == nil && strconv.FormatInt(n, 10) == k {
+			keys = append(keys, n)
+		} else {
+			keys = append(keys, k)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, aInt := keys[i].(int64)
+		b, bInt := keys[j].(int64)
+		switch {
+		case aInt && bInt:
+			return a < b
+		case aInt != bInt:
+			return aInt
+		}
+		return keys[i].(string) < keys[j].(string)
+	})
+
+	for _, key := range keys {
+		if err := assignEntry(target, key, entries[keyString(key)], path); err != nil {
+			return err
+		}
+	}
+	target.finish()
+	return nil
+}
+
+func assignEntry(target *arrayTarget, key interface{}, value interface{}, path string) error {
+	elem, ok, err := target.entry(key)
+	if err != nil {
+		return pathError(joinPath(path, key), err)
+	}
+	if !ok {
+		return nil
+	}
+	if err := assignValue(elem, value, joinPath(path, key)); err != nil {
+		return err
+	}
+	target.commit()
+	return nil
+}
+
+// findStructField finds the field for a PHP key, preferring an exact name match
+func findStructField(t reflect.Type, name string) (structField, bool) {
+	info := cachedStructInfo(t)
+	for _, f := range info.fields {
+		if f.name == name {
+			return f, true
+		}
+	}
+	for _, f := range info.fields {
+		if strings.EqualFold(f.name, name) {
+			return f, true
+		}
+	}
+	return structField{}, false
+}
+
+// fieldByIndexAlloc returns a struct field, allocating nil embedded pointers on the way.
+// It reports false when the field sits behind a nil pointer to an unexported struct.
+func fieldByIndexAlloc(v reflect.Value, index []int) (reflect.Value, bool) {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				if !v.CanSet() {
+					return reflect.Value{}, false
+				}
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v, true
+}
+
+// convertMapKey converts a PHP array key to a Go map key
+func convertMapKey(key interface{}, t reflect.Type) (reflect.Value, error) {
+	k := reflect.New(t).Elem()
+	s := keyString(key)
+	switch t.Kind() {
+	case reflect.String:
+		k.SetString(s)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil || k.OverflowInt(n) {
+			return reflect.Value{}, fmt.Errorf("cannot unmarshal key %q into Go value of type %s", s, t)
+		}
+		k.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(s, 10, 64)
+		if err != nil || k.OverflowUint(n) {
+			return reflect.Value{}, fmt.Errorf("cannot unmarshal key %q into Go value of type %s", s, t)
+		}
+		k.SetUint(n)
+	}
+	return k, nil
+}
+
+func isEmptyInterface(v reflect.Value) bool {
+	return v.Kind() == reflect.Interface && v.NumMethod() == 0
+}
+
+func isArrayDestination(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Struct, reflect.Map, reflect.Slice, reflect.Array:
+		return true
+	}
+	return false
+}
+
+// keyString formats an array key the way Unmarshal does for map keys
+func keyString(key interface{}) string {
+	switch k := key.(type) {
+	case string:
+		return k
+	case int64:
+		return strconv.FormatInt(k, 10)
+	}
+	return fmt.Sprintf("%v", key)
+}
+
+// joinPath appends a key to a dotted path such as "users.0.name"
+func joinPath(path string, key interface{}) string {
+	if path == "" {
+		return keyString(key)
+	}
+	return path + "." + keyString(key)
+}
+
+// pathError adds the path of the failing value to a conversion error
+func pathError(path string, err error) error {
+	if path == "" {
+		return err
+	}
+	return fmt.Errorf("%w at path %q", err, path)
+}
+
+// phpTypeName names the PHP type of an un-serialized value for error messages
+func phpTypeName(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "bool"
+	case int64:
+		return "int"
+	case float64:
+		return "float"
+	case string:
+		return "string"
+	case []interface{}, map[string]interface{}, PHPArray:
+		return "array"
+	case PHPObject, PHPCustomObject:
+		return "object"
+	case PHPEnum:
+		return "enum"
+	}
+	return fmt.Sprintf("%T", value)
+}
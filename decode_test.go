@@ -0,0 +1,123 @@
+package phpserialize
+
+import (
+	"strings"
+	"testing"
+)
+
+type testOrder struct {
+	ID       int64              `php:"id"`
+	Customer *testAddress       `php:"customer"`
+	Items    []string           `php:"items"`
+	Totals   map[string]float64 `php:"totals"`
+	Codes    map[int]string     `php:"codes"`
+	Paid     bool               `php:"paid"`
+	Note     string
+	Pair     [2]int `php:"pair"`
+}
+
+// TestUnmarshalTo tests decoding into typed Go destinations
+func TestUnmarshalTo(t *testing.T) {
+	data := `a:9:{s:2:"id";i:7;s:8:"customer";a:1:{s:4:"city";s:4:"Oslo";}` +
+		`s:5:"items";a:2:{i:0;s:1:"a";i:1;s:1:"b";}s:6:"totals";a:2:{s:3:"net";d:10.5;s:5:"gross";i:12;}` +
+		`s:5:"codes";a:2:{i:3;s:1:"x";i:9;s:1:"y";}s:4:"paid";b:1;s:4:"note";s:2:"hi";` +
+		`s:4:"pair";a:1:{i:0;i:4;}s:7:"unknown";a:1:{i:0;i:1;}}`
+
+	var order testOrder
+	if err := UnmarshalTo(data, &order); err != nil {
+		t.Fatalf("UnmarshalTo failed: %v", err)
+	}
+
+	if order.ID != 7 || !order.Paid || order.Note != "hi" {
+		t.Errorf("Unexpected scalars: %+v", order)
+	}
+	if order.Customer == nil || order.Customer.City != "Oslo" {
+		t.Errorf("Unexpected customer: %+v", order.Customer)
+	}
+	if len(order.Items) != 2 || order.Items[1] != "b" {
+		t.Errorf("Unexpected items: %v", order.Items)
+	}
+	if order.Totals["net"] != 10.5 || order.Totals["gross"] != 12 {
+		t.Errorf("Unexpected totals: %v", order.Totals)
+	}
+	if order.Codes[3] != "x" || order.Codes[9] != "y" {
+		t.Errorf("Unexpected codes: %v", order.Codes)
+	}
+	if order.Pair != [2]int{4, 0} {
+		t.Errorf("Unexpected pair: %v", order.Pair)
+	}
+}
+
+// TestUnmarshalToObject tests decoding objects and references into structs
+func TestUnmarshalToObject(t *testing.T) {
+	type node struct {
+		Name string `php:"name"`
+		Next *node  `php:"next"`
+	}
+	data := "a:2:{i:0;O:4:\"Node\":2:{s:10:\"\x00Node\x00name\";s:1:\"a\";s:4:\"next\";N;}i:1;r:2;}"
+
+	var nodes []*node
+	if err := UnmarshalTo(data, &nodes); err != nil {
+		t.Fatalf("UnmarshalTo failed: %v", err)
+	}
+	if len(nodes) != 2 || nodes[0].Name != "a" {
+		t.Fatalf("Unexpected nodes: %+v", nodes)
+	}
+	if nodes[0] != nodes[1] {
+		t.Error("Expected r: to share the decoded pointer")
+	}
+
+	// Into interface{} behaves like Unmarshal
+	var generic interface{}
+	if err := UnmarshalTo(`a:1:{i:0;s:1:"x";}`, &generic); err != nil {
+		t.Fatalf("UnmarshalTo failed: %v", err)
+	}
+	if s, ok := generic.([]interface{}); !ok || s[0] != "x" {
+		t.Errorf("Unexpected generic value: %#v", generic)
+	}
+
+	// Basic types and pointers
+	var n *int
+	if err := UnmarshalTo(`i:5;`, &n); err != nil || n == nil || *n != 5 {
+		t.Errorf("Expected *int 5, got %v (%v)", n, err)
+	}
+	var b []byte
+	if err := UnmarshalTo(`s:3:"abc";`, &b); err != nil || string(b) != "abc" {
+		t.Errorf("Expected []byte abc, got %q (%v)", b, err)
+	}
+}
+
+// TestUnmarshalToErrors tests that conversion errors name the failing path
+func TestUnmarshalToErrors(t *testing.T) {
+	var order testOrder
+	err := UnmarshalTo(`a:1:{s:5:"items";a:2:{i:0;s:1:"a";i:1;i:2;}}`, &order)
+	if err == nil || !strings.Contains(err.Error(), `"items.1"`) {
+		t.Errorf("Expected path items.1 in error, got %v", err)
+	}
+
+	var small struct {
+		N int8 `php:"n"`
+	}
+	err = UnmarshalTo(`a:1:{s:1:"n";i:300;}`, &small)
+	if err == nil || !strings.Contains(err.Error(), "overflows") {
+		t.Errorf("Expected overflow error, got %v", err)
+	}
+
+	err = UnmarshalTo(`a:1:{s:5:"codes";a:1:{s:1:"x";s:1:"y";}}`, &order)
+	if err == nil || !strings.Contains(err.Error(), `"codes.x"`) {
+		t.Errorf("Expected key error at codes.x, got %v", err)
+	}
+
+	if err := UnmarshalTo(`i:1;`, order); err == nil {
+		t.Error("Expected error for non-pointer destination")
+	}
+
+	var list []int
+	if err := UnmarshalTo(`a:999999999999999:{}`, &list); err == nil {
+		t.Error("Expected error for a forged array count")
+	}
+	var m map[string]int
+	if err := UnmarshalTo(`a:100000000:{}`, &m); err == nil {
+		t.Error("Expected error for a forged array count")
+	}
+}
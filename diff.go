@@ -0,0 +1,268 @@
+package phpserialize
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// ChangeKind classifies a difference reported by Diff
+type ChangeKind int
+
+const (
+	// Added means the path only exists in the new data
+	Added ChangeKind = iota
+	// Removed means the path only exists in the old data
+	Removed
+	// Modified means the value changed but kept its type
+	Modified
+	// TypeChanged means the value changed type, e.g. from int to string
+	TypeChanged
+	// ClassChanged means an object changed class; its properties are compared as well
+	ClassChanged
+	// Reordered means an array or object holds its common keys in another order
+	Reordered
+)
+
+// String returns the name of the kind
+func (k ChangeKind) String() string {
+	switch k {
+	case Added:
+		return "added"
+	case Removed:
+		return "removed"
+	case Modified:
+		return "modified"
+	case TypeChanged:
+		return "type changed"
+	case ClassChanged:
+		return "class changed"
+	case Reordered:
+		return "reordered"
+	}
+	return "ChangeKind(" + strconv.Itoa(int(k)) + ")"
+}
+
+// Change is one difference between two serialized values. Old and New hold
+// the decoded values at Path, nil for the side where the path is missing;
+// for Reordered they are []string holding the keys both sides share, in the
+// order of each side.
+type Change struct {
+	Kind ChangeKind
+	Path string // array keys and property names, written like for Get
+	Old  interface{}
+	New  interface{}
+}
+
+// Diff decodes two serialized values and lists how b differs from a, in the
+// order the paths appear in a followed by those only in b. Properties are
+// compared by their serialized names, so a change of visibility shows up as
+// a removed and an added property.
+func Diff(a, b string, options ...Option) ([]Change, error) {
+	options = append(options[:len(options):len(options)], WithOrderedArrays(true))
+	oldValue, err := Unmarshal(a, options...)
+	if err != nil {
+		return nil, fmt.Errorf("old value: %w", err)
+	}
+	newValue, err := Unmarshal(b, options...)
+	if err != nil {
+		return nil, fmt.Errorf("new value: %w", err)
+	}
+	d := &differ{active: make(map[differPair]bool)}
+	d.compare(nil, oldValue, newValue)
+	return d.changes, nil
+}
+
+// FormatDiff renders changes as text, one "-" line for the old value and one
+// "+" line for the new value of each path, like a unified diff. Values are
+// summarized in var_dump style, e.g. int(5), string(3) "Ann" or array(2);
+// reordered keys are shown on a "~" line.
+func FormatDiff(changes []Change) string {
+	var sb strings.Builder
+	for _, c := range changes {
+		path := c.Path
+		if path == "" {
+			path = "."
+		}
+		if c.Kind == Reordered {
+			fmt.Fprintf(&sb, "~%s: order %s -> %s\n", path, formatKeys(c.Old), formatKeys(c.New))
+			continue
+		}
+		if c.Kind != Added {
+			fmt.Fprintf(&sb, "-%s: %s\n", path, summarize(c.Old))
+		}
+		if c.Kind != Removed {
+			fmt.Fprintf(&sb, "+%s: %s\n", path, summarize(c.New))
+		}
+	}
+	return sb.String()
+}
+
+// summarize renders a value on one line
+func summarize(v interface{}) string {
+	switch val := v.(type) {
+	case nil:
+		return "NULL"
+	case bool:
+		return fmt.Sprintf("bool(%t)", val)
+	case int64:
+		return fmt.Sprintf("int(%d)", val)
+	case float64:
+		return fmt.Sprintf("float(%s)", formatPHPFloat(val, -1, 'E'))
+	case string:
+		return fmt.Sprintf("string(%d) %s", len(val), strconv.Quote(val))
+	case PHPArray:
+		return fmt.Sprintf("array(%d)", len(val))
+	case PHPObject:
+		return fmt.Sprintf("object(%s) (%d)", val.ClassName, len(val.Properties))
+	case PHPCustomObject:
+		return fmt.Sprintf("object(%s) C:%d", val.ClassName, len(val.Data))
+	case PHPEnum:
+		return fmt.Sprintf("enum(%s::%s)", val.ClassName, val.Case)
+	}
+	return fmt.Sprintf("%v", v)
+}
+
+// formatKeys lists the keys of a Reordered change
+func formatKeys(keys interface{}) string {
+	list, _ := keys.([]string)
+	return strings.Join(list, ", ")
+}
+
+// differ walks two decoded values side by side
+type differ struct {
+	changes []Change
+	// active holds the pairs of arrays and objects being compared, which
+	// stops the walk at values that contain themselves
+	active map[differPair]bool
+}
+
+// differPair identifies an array or object of each side by the address of
+// its entries; arrays that share entries differ in length
+type differPair struct {
+	old, new       uintptr
+	oldLen, newLen int
+}
+
+func (d *differ) add(kind ChangeKind, path []string, old, new interface{}) {
+	d.changes = append(d.changes, Change{Kind: kind, Path: joinSegments(path), Old: old, New: new})
+}
+
+// compare records the differences between two values at path
+func (d *differ) compare(path []string, old, new interface{}) {
+	// A custom object or a registered enum differs from a plain one in type
+	if reflect.TypeOf(old) != reflect.TypeOf(new) {
+		d.add(TypeChanged, path, old, new)
+		return
+	}
+
+	switch o := old.(type) {
+	case PHPArray:
+		n := new.(PHPArray)
+		if len(o) > 0 && len(n) > 0 {
+			pair := differPair{reflect.ValueOf(o).Pointer(), reflect.ValueOf(n).Pointer(), len(o), len(n)}
+			if d.active[pair] {
+				return
+			}
+			d.active[pair] = true
+			defer delete(d.active, pair)
+		}
+		oldKeys, newKeys := make([]interface{}, len(o)), make([]interface{}, len(n))
+		oldValues, newValues := make(map[interface{}]interface{}, len(o)), make(map[interface{}]interface{}, len(n))
+		for i, e := range o {
+			oldKeys[i], oldValues[e.Key] = e.Key, e.Value
+		}
+		for i, e := range n {
+			newKeys[i], newValues[e.Key] = e.Key, e.Value
+		}
+		d.entries(path, oldKeys, newKeys, oldValues, newValues, keyString)
+
+	case PHPObject:
+		n := new.(PHPObject)
+		pair := differPair{old: reflect.ValueOf(o.Properties).Pointer(), new: reflect.ValueOf(n.Properties).Pointer()}
+		if d.active[pair] {
+			return
+		}
+		d.active[pair] = true
+		defer delete(d.active, pair)
+
+		if o.ClassName != n.ClassName {
+			d.add(ClassChanged, path, old, new)
+		}
+		oldKeys, newKeys := propertyKeys(o), propertyKeys(n)
+		oldValues, newValues := make(map[interface{}]interface{}, len(oldKeys)), make(map[interface{}]interface{}, len(newKeys))
+		for _, k := range oldKeys {
+			oldValues[k] = o.Properties[k.(string)]
+		}
+		for _, k := range newKeys {
+			newValues[k] = n.Properties[k.(string)]
+		}
+		d.entries(path, oldKeys, newKeys, oldValues, newValues, func(k interface{}) string {
+			return bareName(k.(string))
+		})
+
+	case PHPCustomObject:
+		n := new.(PHPCustomObject)
+		if o.ClassName != n.ClassName {
+			d.add(ClassChanged, path, old, new)
+		} else if o.Data != n.Data {
+			d.add(Modified, path, old, new)
+		}
+
+	case float64:
+		n := new.(float64)
+		if o != n && !(math.IsNaN(o) && math.IsNaN(n)) {
+			d.add(Modified, path, old, new)
+		}
+
+	default:
+		if !reflect.DeepEqual(old, new) {
+			d.add(Modified, path, old, new)
+		}
+	}
+}
+
+// entries compares the entries of two arrays or objects; name turns a key
+// into its path segment
+func (d *differ) entries(path []string, oldKeys, newKeys []interface{}, oldValues, newValues map[interface{}]interface{}, name func(interface{}) string) {
+	var oldCommon, newCommon []string
+	for _, k := range oldKeys {
+		if _, ok := newValues[k]; ok {
+			oldCommon = append(oldCommon, name(k))
+		}
+	}
+	for _, k := range newKeys {
+		if _, ok := oldValues[k]; ok {
+			newCommon = append(newCommon, name(k))
+		}
+	}
+	if !reflect.DeepEqual(oldCommon, newCommon) {
+		d.add(Reordered, path, oldCommon, newCommon)
+	}
+
+	for _, k := range oldKeys {
+		sub := append(path[:len(path):len(path)], name(k))
+		if newValue, ok := newValues[k]; ok {
+			d.compare(sub, oldValues[k], newValue)
+		} else {
+			d.add(Removed, sub, oldValues[k], nil)
+		}
+	}
+	for _, k := range newKeys {
+		if _, ok := oldValues[k]; !ok {
+			d.add(Added, append(path[:len(path):len(path)], name(k)), nil, newValues[k])
+		}
+	}
+}
+
+// propertyKeys returns the serialized property names of an object in order
+func propertyKeys(obj PHPObject) []interface{} {
+	names := orderedPropertyNames(obj, KeyOrderSorted)
+	keys := make([]interface{}, len(names))
+	for i, name := range names {
+		keys[i] = name
+	}
+	return keys
+}
@@ -0,0 +1,129 @@
+package phpserialize
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+// TestDiff tests the changes reported between two values
+func TestDiff(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string
+		want []Change
+	}{
+		{"equal", `a:1:{s:1:"a";d:NAN;}`, `a:1:{s:1:"a";d:NAN;}`, nil},
+		{"modified", `a:1:{s:1:"a";i:1;}`, `a:1:{s:1:"a";i:2;}`,
+			[]Change{{Modified, "a", int64(1), int64(2)}}},
+		{"type changed", `a:1:{s:2:"id";i:5;}`, `a:1:{s:2:"id";s:1:"5";}`,
+			[]Change{{TypeChanged, "id", int64(5), "5"}}},
+		{"added and removed", `a:2:{i:0;s:1:"x";s:1:"k";b:1;}`, `a:2:{i:0;s:1:"x";s:1:"n";N;}`,
+			[]Change{{Removed, "k", true, nil}, {Added, "n", nil, nil}}},
+		{"reordered", `a:3:{s:1:"a";i:1;s:1:"b";i:2;s:1:"c";i:3;}`, `a:2:{s:1:"b";i:2;s:1:"a";i:1;}`,
+			[]Change{{Reordered, "", []string{"a", "b"}, []string{"b", "a"}}, {Removed, "c", int64(3), nil}}},
+		{"nested", `a:1:{s:4:"user";a:1:{s:5:"roles";a:1:{i:0;s:5:"admin";}}}`, `a:1:{s:4:"user";a:1:{s:5:"roles";a:1:{i:0;s:6:"editor";}}}`,
+			[]Change{{Modified, "user.roles.0", "admin", "editor"}}},
+		{"escaped key", `a:1:{s:5:"a.com";i:1;}`, `a:1:{s:5:"a.com";i:2;}`,
+			[]Change{{Modified, `a\.com`, int64(1), int64(2)}}},
+		{"root", `i:1;`, `b:1;`, []Change{{TypeChanged, "", int64(1), true}}},
+		{"enum", `E:6:"Suit:H";`, `E:6:"Suit:S";`,
+			[]Change{{Modified, "", PHPEnum{ClassName: "Suit", Case: "H"}, PHPEnum{ClassName: "Suit", Case: "S"}}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Diff(tt.a, tt.b)
+			if err != nil {
+				t.Fatalf("Diff failed: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Expected %#v, got %#v", tt.want, got)
+			}
+		})
+	}
+}
+
+// TestDiffObjects tests class and property changes
+func TestDiffObjects(t *testing.T) {
+	a := "O:4:\"User\":2:{s:4:\"name\";s:3:\"Ann\";s:6:\"\x00*\x00age\";i:30;}"
+	b := "O:5:\"Admin\":2:{s:4:\"name\";s:3:\"Bob\";s:3:\"age\";i:30;}"
+	got, err := Diff(a, b)
+	if err != nil {
+		t.Fatalf("Diff failed: %v", err)
+	}
+	kinds := []ChangeKind{ClassChanged, Modified, Removed, Added}
+	paths := []string{"", "name", "age", "age"}
+	if len(got) != len(kinds) {
+		t.Fatalf("Expected %d changes, got %#v", len(kinds), got)
+	}
+	for i, c := range got {
+		if c.Kind != kinds[i] || c.Path != paths[i] {
+			t.Errorf("Expected %s at %q, got %s at %q", kinds[i], paths[i], c.Kind, c.Path)
+		}
+	}
+
+	// An object containing itself does not recurse forever
+	self := `O:4:"Node":2:{s:4:"self";r:1;s:1:"v";i:1;}`
+	got, err = Diff(self, `O:4:"Node":2:{s:4:"self";r:1;s:1:"v";i:2;}`)
+	if err != nil {
+		t.Fatalf("Diff failed: %v", err)
+	}
+	if len(got) != 1 || got[0].Path != "v" {
+		t.Errorf("Expected one change at v, got %#v", got)
+	}
+}
+
+// TestDiffSelfReferentialArray tests that an array containing itself does
+// not recurse forever
+func TestDiffSelfReferentialArray(t *testing.T) {
+	self := `a:1:{i:0;a:1:{i:0;R:2;}}`
+	got, err := Diff(self, self)
+	if err != nil {
+		t.Fatalf("Diff failed: %v", err)
+	}
+	if len(got) != 0 {
+		t.Errorf("Expected no changes, got %#v", got)
+	}
+
+	got, err = Diff(`a:2:{i:0;a:1:{i:0;R:2;}i:1;i:1;}`, `a:2:{i:0;a:1:{i:0;R:2;}i:1;i:2;}`)
+	if err != nil {
+		t.Fatalf("Diff failed: %v", err)
+	}
+	if len(got) != 1 || got[0].Path != "1" {
+		t.Errorf("Expected one change at 1, got %#v", got)
+	}
+}
+
+// TestFormatDiff tests the textual rendering
+func TestFormatDiff(t *testing.T) {
+	changes := []Change{
+		{Reordered, "", []string{"a", "b"}, []string{"b", "a"}},
+		{Modified, "user.name", "Ann", "Bo\nb"},
+		{TypeChanged, "user.id", int64(5), "5"},
+		{Added, "user.tags", nil, PHPArray{{Key: int64(0), Value: "x"}}},
+		{Removed, "user.score", math.Inf(1), nil},
+		{ClassChanged, "user", PHPObject{ClassName: "User"}, PHPObject{ClassName: "Admin"}},
+	}
+	want := "~.: order a, b -> b, a\n" +
+		"-user.name: string(3) \"Ann\"\n" +
+		"+user.name: string(4) \"Bo\\nb\"\n" +
+		"-user.id: int(5)\n" +
+		"+user.id: string(1) \"5\"\n" +
+		"+user.tags: array(1)\n" +
+		"-user.score: float(INF)\n" +
+		"-user: object(User) (0)\n" +
+		"+user: object(Admin) (0)\n"
+	if got := FormatDiff(changes); got != want {
+		t.Errorf("Expected\n%s\ngot\n%s", want, got)
+	}
+}
+
+// TestDiffErrors tests undecodable input
+func TestDiffErrors(t *testing.T) {
+	if _, err := Diff(`i:1`, `i:1;`); err == nil {
+		t.Error("Expected error for the old value")
+	}
+	if _, err := Diff(`i:1;`, `x`); err == nil {
+		t.Error("Expected error for the new value")
+	}
+}
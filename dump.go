@@ -0,0 +1,488 @@
+package phpserialize
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Dump writes v the way PHP's var_dump() prints it, with byte lengths for
+// strings and #n handles for objects. v is typically a value returned by
+// Unmarshal; other Go values are shown as PHP would see them after Marshal.
+// Arrays decoded without WithOrderedArrays(true) are Go maps and are printed
+// with their keys sorted, since their original order is lost.
+func Dump(w io.Writer, v interface{}) error {
+	d := newDumper()
+	if err := d.varDump(v, 1); err != nil {
+		return err
+	}
+	_, err := w.Write(d.buf.Bytes())
+	return err
+}
+
+// PrintR writes v the way PHP's print_r() prints it
+func PrintR(w io.Writer, v interface{}) error {
+	d := newDumper()
+	if err := d.printR(v, 0); err != nil {
+		return err
+	}
+	_, err := w.Write(d.buf.Bytes())
+	return err
+}
+
+// VarExport writes v as PHP code, the way PHP's var_export() prints it.
+// Like PHP, a value containing itself is exported as NULL.
+func VarExport(w io.Writer, v interface{}) error {
+	d := newDumper()
+	if err := d.varExport(v, 1); err != nil {
+		return err
+	}
+	_, err := w.Write(d.buf.Bytes())
+	return err
+}
+
+// dumper renders values for Dump, PrintR and VarExport
+type dumper struct {
+	buf    bytes.Buffer
+	ids    map[uintptr]int  // object handles by properties map
+	nextID int              // last object handle given out
+	active map[uintptr]bool // arrays and objects being printed, to detect recursion
+}
+
+func newDumper() *dumper {
+	return &dumper{ids: make(map[uintptr]int), active: make(map[uintptr]bool)}
+}
+
+// dumpValue converts v to one of the types Unmarshal produces with
+// WithOrderedArrays(true), and returns the identity of arrays and objects
+func dumpValue(v interface{}) (value interface{}, identity uintptr, err error) {
+	switch val := v.(type) {
+	case nil, bool, int64, float64, string, PHPCustomObject, PHPEnum:
+		return v, 0, nil
+	case PHPArray:
+		if len(val) > 0 {
+			identity = reflect.ValueOf(val).Pointer()
+		}
+		return val, identity, nil
+	case PHPObject:
+		if val.Properties != nil {
+			identity = reflect.ValueOf(val.Properties).Pointer()
+		}
+		return val, identity, nil
+	case []interface{}:
+		arr := make(PHPArray, len(val))
+		for i, e := range val {
+			arr[i] = PHPArrayEntry{Key: int64(i), Value: e}
+		}
+		if len(val) > 0 {
+			identity = reflect.ValueOf(val).Pointer()
+		}
+		return arr, identity, nil
+	case map[string]interface{}:
+		keys := make([]string, 0, len(val))
+		for k := range val {
+			keys = append(keys, k)
+		}
+		sort.Slice(keys, func(i, j int) bool {
+			return keyLess(keys[i], keys[j], KeyOrderSorted)
+		})
+		arr := make(PHPArray, len(keys))
+		for i, k := range keys {
+			key, _ := normalizeArrayKey(k)
+			arr[i] = PHPArrayEntry{Key: key, Value: val[k]}
+		}
+		return arr, reflect.ValueOf(val).Pointer(), nil
+	}
+
+	data, err := Marshal(v, WithKeyOrder(KeyOrderSorted))
+	if err != nil {
+		return nil, 0, err
+	}
+	value, err = Unmarshal(data, WithOrderedArrays(true))
+	if err != nil {
+		return nil, 0, err
+	}
+	return dumpValue(value)
+}
+
+// objectID returns the handle of an object, numbering objects in the order
+// they are first printed, like PHP numbers them as unserialize() creates them
+func (d *dumper) objectID(identity uintptr) int {
+	if identity == 0 {
+		d.nextID++
+		return d.nextID
+	}
+	if id, ok := d.ids[identity]; ok {
+		return id
+	}
+	d.nextID++
+	d.ids[identity] = d.nextID
+	return d.nextID
+}
+
+// enter marks an array or object as being printed, reporting false when it
+// already is
+func (d *dumper) enter(identity uintptr) bool {
+	if identity == 0 {
+		return true
+	}
+	if d.active[identity] {
+		return false
+	}
+	d.active[identity] = true
+	return true
+}
+
+func (d *dumper) leave(identity uintptr) {
+	delete(d.active, identity)
+}
+
+func (d *dumper) pad(n int) {
+	for i := 0; i < n; i++ {
+		d.buf.WriteByte(' ')
+	}
+}
+
+// varDump prints a value at nesting level, which starts at 1 as in PHP's source
+func (d *dumper) varDump(v interface{}, level int) error {
+	value, identity, err := dumpValue(v)
+	if err != nil {
+		return err
+	}
+	if level > 1 {
+		d.pad(level - 1)
+	}
+
+	switch val := value.(type) {
+	case nil:
+		d.buf.WriteString("NULL\n")
+	case bool:
+		fmt.Fprintf(&d.buf, "bool(%t)\n", val)
+	case int64:
+		fmt.Fprintf(&d.buf, "int(%d)\n", val)
+	case float64:
+		fmt.Fprintf(&d.buf, "float(%s)\n", formatPHPFloat(val, -1, 'E'))
+	case string:
+		fmt.Fprintf(&d.buf, "string(%d) \"%s\"\n", len(val), val)
+	case PHPArray:
+		if !d.enter(identity) {
+			d.buf.WriteString("*RECURSION*\n")
+			return nil
+		}
+		defer d.leave(identity)
+		fmt.Fprintf(&d.buf, "array(%d) {\n", len(val))
+		for _, e := range val {
+			d.pad(level + 1)
+			if k, ok := e.Key.(int64); ok {
+				fmt.Fprintf(&d.buf, "[%d]=>\n", k)
+			} else {
+				fmt.Fprintf(&d.buf, "[\"%s\"]=>\n", keyString(e.Key))
+			}
+			if err := d.varDump(e.Value, level+2); err != nil {
+				return err
+			}
+		}
+		d.closeBrace(level)
+	case PHPObject:
+		if !d.enter(identity) {
+			d.buf.WriteString("*RECURSION*\n")
+			return nil
+		}
+		defer d.leave(identity)
+		names := orderedPropertyNames(val, KeyOrderSorted)
+		fmt.Fprintf(&d.buf, "object(%s)#%d (%d) {\n", val.ClassName, d.objectID(identity), len(names))
+		for _, mangled := range names {
+			d.pad(level + 1)
+			name, visibility, class := ParsePropertyName(mangled)
+			switch visibility {
+			case Protected:
+				fmt.Fprintf(&d.buf, "[\"%s\":protected]=>\n", name)
+			case Private:
+				fmt.Fprintf(&d.buf, "[\"%s\":\"%s\":private]=>\n", name, class)
+			default:
+				fmt.Fprintf(&d.buf, "[\"%s\"]=>\n", name)
+			}
+			if err := d.varDump(val.Properties[mangled], level+2); err != nil {
+				return err
+			}
+		}
+		d.closeBrace(level)
+	case PHPCustomObject:
+		// The payload format belongs to the class, so its properties are unknown
+		fmt.Fprintf(&d.buf, "object(%s)#%d (0) {\n", val.ClassName, d.objectID(0))
+		d.closeBrace(level)
+	case PHPEnum:
+		fmt.Fprintf(&d.buf, "enum(%s::%s)\n", val.ClassName, val.Case)
+	}
+	return nil
+}
+
+func (d *dumper) closeBrace(level int) {
+	if level > 1 {
+		d.pad(level - 1)
+	}
+	d.buf.WriteString("}\n")
+}
+
+// printR prints a value whose entries are indented by indent+4 spaces
+func (d *dumper) printR(v interface{}, indent int) error {
+	value, identity, err := dumpValue(v)
+	if err != nil {
+		return err
+	}
+
+	switch val := value.(type) {
+	case nil:
+	case bool:
+		if val {
+			d.buf.WriteByte('1')
+		}
+	case int64:
+		d.buf.WriteString(strconv.FormatInt(val, 10))
+	case float64:
+		// String conversion uses the precision setting, 14 by default
+		d.buf.WriteString(formatPHPFloat(val, 14, 'E'))
+	case string:
+		d.buf.WriteString(val)
+	case PHPArray:
+		d.buf.WriteString("Array\n")
+		if !d.enter(identity) {
+			d.buf.WriteString(" *RECURSION*")
+			return nil
+		}
+		defer d.leave(identity)
+		d.pad(indent)
+		d.buf.WriteString("(\n")
+		for _, e := range val {
+			d.pad(indent + 4)
+			fmt.Fprintf(&d.buf, "[%s] => ", keyString(e.Key))
+			if err := d.printR(e.Value, indent+8); err != nil {
+				return err
+			}
+			d.buf.WriteByte('\n')
+		}
+		d.pad(indent)
+		d.buf.WriteString(")\n")
+	case PHPObject:
+		d.buf.WriteString(val.ClassName + " Object\n")
+		if !d.enter(identity) {
+			d.buf.WriteString(" *RECURSION*")
+			return nil
+		}
+		defer d.leave(identity)
+		d.pad(indent)
+		d.buf.WriteString("(\n")
+		for _, mangled := range orderedPropertyNames(val, KeyOrderSorted) {
+			d.pad(indent + 4)
+			name, visibility, class := ParsePropertyName(mangled)
+			switch visibility {
+			case Protected:
+				fmt.Fprintf(&d.buf, "[%s:protected] => ", name)
+			case Private:
+				fmt.Fprintf(&d.buf, "[%s:%s:private] => ", name, class)
+			default:
+				fmt.Fprintf(&d.buf, "[%s] => ", name)
+			}
+			if err := d.printR(val.Properties[mangled], indent+8); err != nil {
+				return err
+			}
+			d.buf.WriteByte('\n')
+		}
+		d.pad(indent)
+		d.buf.WriteString(")\n")
+	case PHPCustomObject:
+		d.buf.WriteString(val.ClassName + " Object\n")
+		d.pad(indent)
+		d.buf.WriteString("(\n")
+		d.pad(indent)
+		d.buf.WriteString(")\n")
+	case PHPEnum:
+		// Only the case name is known; backed enums would also show their value
+		d.buf.WriteString(val.ClassName + " Enum\n")
+		d.pad(indent)
+		d.buf.WriteString("(\n")
+		d.pad(indent + 4)
+		d.buf.WriteString("[name] => " + val.Case + "\n")
+		d.pad(indent)
+		d.buf.WriteString(")\n")
+	}
+	return nil
+}
+
+// varExport prints a value at nesting level, which starts at 1 as in PHP's source
+func (d *dumper) varExport(v interface{}, level int) error {
+	value, identity, err := dumpValue(v)
+	if err != nil {
+		return err
+	}
+
+	switch val := value.(type) {
+	case nil:
+		d.buf.WriteString("NULL")
+	case bool:
+		d.buf.WriteString(strconv.FormatBool(val))
+	case int64:
+		if val == math.MinInt64 {
+			// The literal would be parsed as a float
+			d.buf.WriteString("-9223372036854775807-1")
+		} else {
+			d.buf.WriteString(strconv.FormatInt(val, 10))
+		}
+	case float64:
+		s := formatPHPFloat(val, -1, 'E')
+		if !math.IsNaN(val) && !math.IsInf(val, 0) && !strings.ContainsAny(s, ".E") {
+			s += ".0"
+		}
+		d.buf.WriteString(s)
+	case string:
+		d.exportString(val)
+	case PHPArray:
+		if !d.enter(identity) {
+			d.buf.WriteString("NULL")
+			return nil
+		}
+		defer d.leave(identity)
+		d.exportNewline(level)
+		d.buf.WriteString("array (\n")
+		for _, e := range val {
+			d.pad(level + 1)
+			if k, ok := e.Key.(int64); ok {
+				d.buf.WriteString(strconv.FormatInt(k, 10))
+			} else {
+				d.exportString(keyString(e.Key))
+			}
+			d.buf.WriteString(" => ")
+			if err := d.varExport(e.Value, level+2); err != nil {
+				return err
+			}
+			d.buf.WriteString(",\n")
+		}
+		if level > 1 {
+			d.pad(level - 1)
+		}
+		d.buf.WriteByte(')')
+	case PHPObject:
+		if !d.enter(identity) {
+			d.buf.WriteString("NULL")
+			return nil
+		}
+		defer d.leave(identity)
+		d.exportNewline(level)
+		stdClass := strings.EqualFold(val.ClassName, "stdClass")
+		if stdClass {
+			d.buf.WriteString("(object) array(\n")
+		} else {
+			d.buf.WriteString("\\" + val.ClassName + "::__set_state(array(\n")
+		}
+		for _, mangled := range orderedPropertyNames(val, KeyOrderSorted) {
+			d.pad(level + 2)
+			d.exportString(bareName(mangled))
+			d.buf.WriteString(" => ")
+			if err := d.varExport(val.Properties[mangled], level+2); err != nil {
+				return err
+			}
+			d.buf.WriteString(",\n")
+		}
+		if level > 1 {
+			d.pad(level - 1)
+		}
+		if stdClass {
+			d.buf.WriteByte(')')
+		} else {
+			d.buf.WriteString("))")
+		}
+	case PHPCustomObject:
+		d.exportNewline(level)
+		d.buf.WriteString("\\" + val.ClassName + "::__set_state(array(\n")
+		if level > 1 {
+			d.pad(level - 1)
+		}
+		d.buf.WriteString("))")
+	case PHPEnum:
+		d.exportNewline(level)
+		d.buf.WriteString("\\" + val.ClassName + "::" + val.Case)
+	}
+	return nil
+}
+
+// exportNewline starts a nested array, object or enum on its own line
+func (d *dumper) exportNewline(level int) {
+	if level > 1 {
+		d.buf.WriteByte('\n')
+		d.pad(level - 1)
+	}
+}
+
+// exportString writes a single-quoted PHP string literal; NUL bytes are
+// spliced in as "\0" since single quotes cannot hold them
+func (d *dumper) exportString(s string) {
+	d.buf.WriteByte('\'')
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '\'', '\\':
+			d.buf.WriteByte('\\')
+			d.buf.WriteByte(c)
+		case 0:
+			d.buf.WriteString(`' . "\0" . '`)
+		default:
+			d.buf.WriteByte(c)
+		}
+	}
+	d.buf.WriteByte('\'')
+}
+
+// formatPHPFloat formats f like PHP's php_gcvt: with precision significant
+// digits, or the shortest exact representation when precision is -1 (the
+// serialize_precision default), switching to exponential notation below 1e-4
+// and when the exponent reaches the number of digits
+func formatPHPFloat(f float64, precision int, expChar byte) string {
+	switch {
+	case math.IsNaN(f):
+		return "NAN"
+	case math.IsInf(f, 1):
+		return "INF"
+	case math.IsInf(f, -1):
+		return "-INF"
+	}
+	var digits string
+	if precision < 0 {
+		precision = 17
+		digits = strconv.FormatFloat(f, 'e', -1, 64)
+	} else {
+		digits = strconv.FormatFloat(f, 'e', precision-1, 64)
+	}
+	mantissa, expStr, _ := strings.Cut(digits, "e")
+	if strings.Contains(mantissa, ".") {
+		mantissa = strings.TrimRight(strings.TrimRight(mantissa, "0"), ".")
+	}
+	exp, _ := strconv.Atoi(expStr)
+	if exp < -4 || exp >= precision {
+		if !strings.Contains(mantissa, ".") {
+			mantissa += ".0"
+		}
+		sign := "+"
+		if exp < 0 {
+			sign, exp = "-", -exp
+		}
+		return mantissa + string(expChar) + sign + strconv.Itoa(exp)
+	}
+
+	// Place the decimal point exp digits after the first one
+	sign := ""
+	if mantissa[0] == '-' {
+		sign, mantissa = "-", mantissa[1:]
+	}
+	mantissa = strings.Replace(mantissa, ".", "", 1)
+	if exp < 0 {
+		return sign + "0." + strings.Repeat("0", -exp-1) + mantissa
+	}
+	if len(mantissa) <= exp+1 {
+		return sign + mantissa + strings.Repeat("0", exp+1-len(mantissa))
+	}
+	return sign + mantissa[:exp+1] + "." + mantissa[exp+1:]
+}
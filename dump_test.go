@@ -0,0 +1,180 @@
+package phpserialize
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+const dumpUser = "O:4:\"User\":3:{s:4:\"name\";s:3:\"Ann\";s:6:\"\x00*\x00age\";i:30;s:10:\"\x00User\x00pass\";s:2:\"pw\";}"
+
+// TestDump tests output matching PHP's var_dump()
+func TestDump(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want string
+	}{
+		{"scalars", `a:4:{i:0;N;i:1;b:1;i:2;i:-7;s:1:"k";s:5:"hello";}`,
+			"array(4) {\n  [0]=>\n  NULL\n  [1]=>\n  bool(true)\n  [2]=>\n  int(-7)\n  [\"k\"]=>\n  string(5) \"hello\"\n}\n"},
+		{"binary string", "s:4:\"a\x00\xc3\xa9\";", "string(4) \"a\x00\xc3\xa9\"\n"},
+		{"floats", `a:6:{i:0;d:0.1;i:1;d:1;i:2;d:-0;i:3;d:1.0E+25;i:4;d:1.0E-5;i:5;d:0.0001;}`,
+			"array(6) {\n  [0]=>\n  float(0.1)\n  [1]=>\n  float(1)\n  [2]=>\n  float(-0)\n  [3]=>\n  float(1.0E+25)\n  [4]=>\n  float(1.0E-5)\n  [5]=>\n  float(0.0001)\n}\n"},
+		{"special floats", `a:2:{i:0;d:NAN;i:1;d:-INF;}`, "array(2) {\n  [0]=>\n  float(NAN)\n  [1]=>\n  float(-INF)\n}\n"},
+		{"nested", `a:1:{s:1:"a";a:1:{i:0;a:0:{}}}`,
+			"array(1) {\n  [\"a\"]=>\n  array(1) {\n    [0]=>\n    array(0) {\n    }\n  }\n}\n"},
+		{"visibility", dumpUser,
+			"object(User)#1 (3) {\n  [\"name\"]=>\n  string(3) \"Ann\"\n  [\"age\":protected]=>\n  int(30)\n  [\"pass\":\"User\":private]=>\n  string(2) \"pw\"\n}\n"},
+		{"object ids", `a:3:{i:0;O:1:"A":1:{s:1:"b";O:1:"B":0:{}}i:1;O:1:"A":0:{}i:2;E:7:"Suit:Hi";}`,
+			"array(3) {\n  [0]=>\n  object(A)#1 (1) {\n    [\"b\"]=>\n    object(B)#2 (0) {\n    }\n  }\n  [1]=>\n  object(A)#3 (0) {\n  }\n  [2]=>\n  enum(Suit::Hi)\n}\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v, err := Unmarshal(tt.data, WithOrderedArrays(true))
+			if err != nil {
+				t.Fatalf("Unmarshal failed: %v", err)
+			}
+			var sb strings.Builder
+			if err := Dump(&sb, v); err != nil {
+				t.Fatalf("Dump failed: %v", err)
+			}
+			if sb.String() != tt.want {
+				t.Errorf("Expected\n%s\ngot\n%s", tt.want, sb.String())
+			}
+		})
+	}
+}
+
+// TestDumpGoValues tests Go values that Unmarshal does not produce
+func TestDumpGoValues(t *testing.T) {
+	shared := PHPObject{ClassName: "Node", Properties: map[string]interface{}{"id": int64(1)}}
+	shared.Properties["self"] = shared
+
+	tests := []struct {
+		name string
+		v    interface{}
+		want string
+	}{
+		{"map", map[string]interface{}{"b": 2, "10": "x", "a": 1.5},
+			"array(3) {\n  [10]=>\n  string(1) \"x\"\n  [\"a\"]=>\n  float(1.5)\n  [\"b\"]=>\n  int(2)\n}\n"},
+		{"slice", []interface{}{true, nil}, "array(2) {\n  [0]=>\n  bool(true)\n  [1]=>\n  NULL\n}\n"},
+		{"int", 42, "int(42)\n"},
+		{"same object twice", []interface{}{shared, shared},
+			"array(2) {\n  [0]=>\n  object(Node)#1 (2) {\n    [\"id\"]=>\n    int(1)\n    [\"self\"]=>\n    *RECURSION*\n  }\n  [1]=>\n  object(Node)#1 (2) {\n    [\"id\"]=>\n    int(1)\n    [\"self\"]=>\n    *RECURSION*\n  }\n}\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var sb strings.Builder
+			if err := Dump(&sb, tt.v); err != nil {
+				t.Fatalf("Dump failed: %v", err)
+			}
+			if sb.String() != tt.want {
+				t.Errorf("Expected\n%s\ngot\n%s", tt.want, sb.String())
+			}
+		})
+	}
+
+	if err := Dump(&strings.Builder{}, make(chan int)); err == nil {
+		t.Error("Expected error for an unsupported type")
+	}
+}
+
+// TestPrintR tests output matching PHP's print_r()
+func TestPrintR(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want string
+	}{
+		{"scalars", `a:5:{i:0;b:1;i:1;b:0;i:2;N;i:3;d:0.1;s:1:"k";s:2:"hi";}`,
+			"Array\n(\n    [0] => 1\n    [1] => \n    [2] => \n    [3] => 0.1\n    [k] => hi\n)\n"},
+		{"top-level string", `s:5:"hello";`, "hello"},
+		{"precision", `d:0.3333333333333333;`, "0.33333333333333"},
+		{"large float", `d:1.0E+15;`, "1.0E+15"},
+		{"nested", `a:2:{s:1:"a";i:1;s:1:"b";a:1:{i:0;b:1;}}`,
+			"Array\n(\n    [a] => 1\n    [b] => Array\n        (\n            [0] => 1\n        )\n\n)\n"},
+		{"visibility", dumpUser,
+			"User Object\n(\n    [name] => Ann\n    [age:protected] => 30\n    [pass:User:private] => pw\n)\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v, err := Unmarshal(tt.data, WithOrderedArrays(true))
+			if err != nil {
+				t.Fatalf("Unmarshal failed: %v", err)
+			}
+			var sb strings.Builder
+			if err := PrintR(&sb, v); err != nil {
+				t.Fatalf("PrintR failed: %v", err)
+			}
+			if sb.String() != tt.want {
+				t.Errorf("Expected\n%s\ngot\n%s", tt.want, sb.String())
+			}
+		})
+	}
+}
+
+// TestVarExport tests output matching PHP's var_export()
+func TestVarExport(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want string
+	}{
+		{"scalars", `a:4:{i:0;N;i:1;b:0;i:2;d:1;s:1:"k";d:0.5;}`,
+			"array (\n  0 => NULL,\n  1 => false,\n  2 => 1.0,\n  'k' => 0.5,\n)"},
+		{"min int", `i:-9223372036854775808;`, "-9223372036854775807-1"},
+		{"quotes and NUL", "s:7:\"it's\\\x00!\";", `'it\'s\\' . "\0" . '!'`},
+		{"nested", `a:1:{s:1:"b";a:2:{i:0;b:1;i:1;N;}}`,
+			"array (\n  'b' => \n  array (\n    0 => true,\n    1 => NULL,\n  ),\n)"},
+		{"object", dumpUser,
+			"\\User::__set_state(array(\n   'name' => 'Ann',\n   'age' => 30,\n   'pass' => 'pw',\n))"},
+		{"stdClass", `a:1:{i:0;O:8:"stdClass":1:{s:1:"a";i:1;}}`,
+			"array (\n  0 => \n  (object) array(\n     'a' => 1,\n  ),\n)"},
+		{"enum", `E:7:"Suit:Hi";`, `\Suit::Hi`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v, err := Unmarshal(tt.data, WithOrderedArrays(true))
+			if err != nil {
+				t.Fatalf("Unmarshal failed: %v", err)
+			}
+			var sb strings.Builder
+			if err := VarExport(&sb, v); err != nil {
+				t.Fatalf("VarExport failed: %v", err)
+			}
+			if sb.String() != tt.want {
+				t.Errorf("Expected\n%s\ngot\n%s", tt.want, sb.String())
+			}
+		})
+	}
+}
+
+// TestFormatPHPFloat tests php_gcvt-style formatting
+func TestFormatPHPFloat(t *testing.T) {
+	tenth := 0.1
+	tests := []struct {
+		f         float64
+		precision int
+		want      string
+	}{
+		{0.1, -1, "0.1"},
+		{tenth + 0.2, -1, "0.30000000000000004"},
+		{tenth + 0.2, 14, "0.3"},
+		{100, -1, "100"},
+		{-1.5, 14, "-1.5"},
+		{9223372036854775808, -1, "9.223372036854776E+18"},
+		{9223372036854775808, 14, "9.2233720368548E+18"},
+		{1e-5, -1, "1.0E-5"},
+		{1.5e-7, -1, "1.5E-7"},
+		{0.1, 17, "0.10000000000000001"},
+		{-0.00012, 17, "-0.00012"},
+		{1234.5, 17, "1234.5"},
+		{1e16, 17, "10000000000000000"},
+		{math.Inf(1), -1, "INF"},
+	}
+	for _, tt := range tests {
+		if got := formatPHPFloat(tt.f, tt.precision, 'E'); got != tt.want {
+			t.Errorf("Expected %s for %v at precision %d, got %s", tt.want, tt.f, tt.precision, got)
+		}
+	}
+}
@@ -0,0 +1,204 @@
+package phpserialize
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Sentinel errors, usable with errors.Is on errors returned by this package
+var (
+	// ErrUnexpectedEOF means the data ended in the middle of a value
+	ErrUnexpectedEOF = errors.New("unexpected end of data")
+	// ErrMaxDepth means the data is nested deeper than WithMaxDepth allows
+	ErrMaxDepth = errors.New("exceeded max depth")
+	// ErrClassNotAllowed means the data holds an object of a class rejected by WithAllowedClasses
+	ErrClassNotAllowed = errors.New("class not allowed")
+	// ErrUnsupportedType means a Go value has no PHP representation
+	ErrUnsupportedType = errors.New("unsupported type")
+	// ErrPathNotFound means a path passed to Get names no value
+	ErrPathNotFound = errors.New("path not found")
+	// ErrPHPVersion means a value cannot be read by the PHP version targeted with
+	// WithPHPVersion, or that the version given to it is invalid
+	ErrPHPVersion = errors.New("not supported by the target PHP version")
+)
+
+// SyntaxError describes serialized data that could not be decoded.
+// Err holds ErrUnexpectedEOF, ErrMaxDepth, ErrClassNotAllowed or ErrPHPVersion
+// when one of them is the cause, or the error of a CustomDecoder, so errors.Is
+// sees through a SyntaxError.
+type SyntaxError struct {
+	Offset   int64  // byte offset in the input where decoding failed
+	Path     string // array keys and property names leading to the failing value, e.g. "users.0.name"
+	Expected string // what the decoder expected, e.g. "';'"; empty if not applicable
+	Got      string // what it found instead
+	Msg      string // description of the error
+	Err      error  // underlying cause, or nil
+
+	// PHP-style rendering, see WithPHPErrors
+	valueOffset int  // start of the innermost value being decoded, -1 until known
+	php         bool // render like PHP's unserialize() notice
+	size        int  // input length, -1 when unknown (streams)
+}
+
+func (e *SyntaxError) Error() string {
+	if e.php {
+		if e.size < 0 {
+			return fmt.Sprintf("Error at offset %d", e.valueOffset)
+		}
+		return fmt.Sprintf("Error at offset %d of %d bytes", e.valueOffset, e.size)
+	}
+	if e.Path != "" {
+		return fmt.Sprintf("at position %d: %s at path %q", e.Offset, e.Msg, e.Path)
+	}
+	return fmt.Sprintf("at position %d: %s", e.Offset, e.Msg)
+}
+
+func (e *SyntaxError) Unwrap() error {
+	return e.Err
+}
+
+// syntaxError returns a SyntaxError at offset with a formatted message
+func syntaxError(offset int, format string, args ...interface{}) *SyntaxError {
+	return &SyntaxError{Offset: int64(offset), Msg: fmt.Sprintf(format, args...), valueOffset: -1}
+}
+
+// expectError reports finding got where expected was required
+func expectError(offset int, expected, where string, got byte) *SyntaxError {
+	err := syntaxError(offset, "expected %s %s, got '%c'", expected, where, got)
+	err.Expected, err.Got = expected, fmt.Sprintf("'%c'", got)
+	return err
+}
+
+// invalidError reports a malformed token such as an integer or a length
+func invalidError(offset int, what, got string) *SyntaxError {
+	err := syntaxError(offset, "invalid %s: %s", what, got)
+	err.Expected, err.Got = what, got
+	return err
+}
+
+// unexpectedEOF reports that the input ended where expected was required
+func unexpectedEOF(offset int, expected string) *SyntaxError {
+	err := syntaxError(offset, "unexpected end of data")
+	err.Expected, err.Got, err.Err = expected, "end of data", ErrUnexpectedEOF
+	return err
+}
+
+// customDecoderError reports a custom object payload its CustomDecoder rejected
+func customDecoderError(offset int, className string, cause error) *SyntaxError {
+	err := syntaxError(offset, "decoding %s payload: %v", className, cause)
+	err.Err = cause
+	return err
+}
+
+// tokenTooLongError reports a number or length with no delim within
+// maxTokenLength bytes
+func tokenTooLongError(offset int, delim byte) *SyntaxError {
+	err := syntaxError(offset, "no '%c' within %d bytes", delim, maxTokenLength)
+	err.Expected, err.Got = fmt.Sprintf("'%c'", delim), fmt.Sprintf("more than %d bytes", maxTokenLength)
+	return err
+}
+
+// keyTypeError reports an array key or property name that is neither an
+// integer nor a string
+func keyTypeError(offset int, typeChar byte) *SyntaxError {
+	err := syntaxError(offset, "invalid key type '%c'", typeChar)
+	err.Expected, err.Got = "int or string key", fmt.Sprintf("'%c'", typeChar)
+	return err
+}
+
+// unknownTypeError reports a value starting with an unknown type character
+func unknownTypeError(offset int, typeChar byte) *SyntaxError {
+	err := syntaxError(offset, "unknown type '%c'", typeChar)
+	err.Expected, err.Got = "type", fmt.Sprintf("'%c'", typeChar)
+	return err
+}
+
+// maxDepthError reports data nested deeper than the configured limit
+func maxDepthError(offset int, maxDepth int) *SyntaxError {
+	err := syntaxError(offset, "exceeded max depth %d", maxDepth)
+	err.Err = ErrMaxDepth
+	return err
+}
+
+// classNotAllowedError reports an object whose class is rejected by WithAllowedClasses
+func classNotAllowedError(offset int, className string) *SyntaxError {
+	err := syntaxError(offset, "class %q not allowed", className)
+	err.Err = ErrClassNotAllowed
+	return err
+}
+
+// phpVersionError reports a value that the PHP version targeted with
+// WithPHPVersion cannot read
+func phpVersionError(offset int, format string, args ...interface{}) *SyntaxError {
+	err := syntaxError(offset, format, args...)
+	err.Err = ErrPHPVersion
+	return err
+}
+
+// prependPath adds the key of an enclosing array or object to the path of a SyntaxError
+func prependPath(err error, key interface{}) error {
+	if se, ok := err.(*SyntaxError); ok {
+		if se.Path == "" {
+			se.Path = keyString(key)
+		} else {
+			se.Path = keyString(key) + "." + se.Path
+		}
+	}
+	return err
+}
+
+// markValueStart records where the innermost failing value starts, which is
+// the offset PHP reports
+func markValueStart(err error, start int) {
+	if se, ok := err.(*SyntaxError); ok && se.valueOffset < 0 {
+		se.valueOffset = start
+	}
+}
+
+// phpErrorsOption implements Option for PHP-style error messages
+type phpErrorsOption struct {
+	enabled bool
+}
+
+func (o phpErrorsOption) applyMarshal(*marshalConfig) {
+	// No effect on marshal
+}
+
+func (o phpErrorsOption) applyUnmarshal(cfg *unmarshalConfig) {
+	cfg.phpErrors = o.enabled
+}
+
+// WithPHPErrors makes decoding errors read like the notice PHP's unserialize()
+// emits, "Error at offset X of Y bytes", where X is the start of the value that
+// failed to decode. The error is still a *SyntaxError with all fields set.
+func WithPHPErrors(enabled bool) Option {
+	return phpErrorsOption{enabled: enabled}
+}
+
+// finishError prepares a decoding error for rendering; size is the input
+// length, or -1 when unknown
+func (cfg *unmarshalConfig) finishError(err error, size int) error {
+	var se *SyntaxError
+	if cfg.phpErrors && errors.As(err, &se) {
+		se.php, se.size = true, size
+		if se.valueOffset < 0 {
+			se.valueOffset = int(se.Offset)
+		}
+	}
+	return err
+}
+
+// notEnoughDataError reports a string or payload running past the end of the input
+func notEnoughDataError(offset int, need, have int) *SyntaxError {
+	err := unexpectedEOF(offset, fmt.Sprintf("%d bytes", need))
+	err.Msg = fmt.Sprintf("not enough data: need %d bytes, have %d", need, have)
+	return err
+}
+
+// syntaxPath adds the path of the value being decoded by UnmarshalTo to a SyntaxError
+func syntaxPath(err error, path string) error {
+	if path != "" {
+		return prependPath(err, path)
+	}
+	return err
+}
@@ -0,0 +1,103 @@
+package phpserialize
+
+import (
+	"errors"
+	"testing"
+)
+
+// TestSyntaxError tests the fields of decoding errors
+func TestSyntaxError(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     string
+		offset   int64
+		path     string
+		expected string
+		got      string
+		sentinel error
+	}{
+		{"bad terminator", `s:3:"abc"x`, 9, "", "';'", "'x'", nil},
+		{"nested", `a:1:{s:4:"user";a:1:{s:5:"roles";a:1:{i:0;i:x;}}}`, 46, "user.roles.0", "integer", "x", nil},
+		{"object property", `O:1:"A":1:{s:4:"` + "\x00*\x00" + `n";b:1`, 25, "n", "';'", "end of data", ErrUnexpectedEOF},
+		{"truncated string", `a:1:{i:0;s:10:"abc";}`, 15, "0", "10 bytes", "end of data", ErrUnexpectedEOF},
+		{"unknown type", `a:1:{i:0;X:1;}`, 9, "0", "type", "'X'", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Unmarshal(tt.data)
+			var se *SyntaxError
+			if !errors.As(err, &se) {
+				t.Fatalf("Expected *SyntaxError, got %T: %v", err, err)
+			}
+			if se.Offset != tt.offset || se.Path != tt.path || se.Expected != tt.expected || se.Got != tt.got {
+				t.Errorf("Unexpected error fields %+v", se)
+			}
+			if !errors.Is(err, tt.sentinel) && tt.sentinel != nil {
+				t.Errorf("Expected errors.Is(%v), got %v", tt.sentinel, err)
+			}
+		})
+	}
+}
+
+// TestErrorSentinels tests errors.Is on decoding and encoding errors
+func TestErrorSentinels(t *testing.T) {
+	_, err := Unmarshal(`a:1:{i:0;a:1:{i:0;i:1;}}`, WithMaxDepth(2))
+	if !errors.Is(err, ErrMaxDepth) {
+		t.Errorf("Expected ErrMaxDepth, got %v", err)
+	}
+	_, err = Unmarshal(`O:4:"Evil":0:{}`, WithAllowedClasses([]string{"Good"}))
+	if !errors.Is(err, ErrClassNotAllowed) {
+		t.Errorf("Expected ErrClassNotAllowed, got %v", err)
+	}
+	_, err = Unmarshal(`a:2:{i:0;`)
+	if !errors.Is(err, ErrUnexpectedEOF) {
+		t.Errorf("Expected ErrUnexpectedEOF, got %v", err)
+	}
+
+	var dst struct {
+		Items []int `php:"items"`
+	}
+	err = UnmarshalTo(`a:1:{s:5:"items";a:1:{i:0;i:1}}`, &dst)
+	var se *SyntaxError
+	if !errors.As(err, &se) || se.Path != "items.0" {
+		t.Errorf("Expected SyntaxError at path items.0, got %v", err)
+	}
+
+	if _, err := Marshal(make(chan int)); !errors.Is(err, ErrUnsupportedType) {
+		t.Errorf("Expected ErrUnsupportedType, got %v", err)
+	}
+	if _, err := Marshal(map[float64]int{1.5: 1}); !errors.Is(err, ErrUnsupportedType) {
+		t.Errorf("Expected ErrUnsupportedType, got %v", err)
+	}
+	if _, err := Marshal([]interface{}{[]interface{}{1}}, WithMaxDepth(1)); !errors.Is(err, ErrMaxDepth) {
+		t.Errorf("Expected ErrMaxDepth, got %v", err)
+	}
+}
+
+// TestPHPErrors tests PHP-style error messages
+func TestPHPErrors(t *testing.T) {
+	tests := []struct {
+		data string
+		want string
+	}{
+		{"foo", "Error at offset 0 of 3 bytes"},
+		{`a:1:{s:4:"test";s:3:"abcd";}`, "Error at offset 16 of 28 bytes"},
+		{`a:2:{i:0;i:1;}`, "Error at offset 13 of 14 bytes"},
+	}
+	for _, tt := range tests {
+		_, err := Unmarshal(tt.data, WithPHPErrors(true))
+		if err == nil || err.Error() != tt.want {
+			t.Errorf("Unmarshal(%q): expected %q, got %v", tt.data, tt.want, err)
+		}
+		var se *SyntaxError
+		if !errors.As(err, &se) {
+			t.Errorf("Expected *SyntaxError, got %T", err)
+		}
+	}
+
+	_, err := Unmarshal("foo")
+	if err == nil || err.Error() != "at position 0: unknown type 'f'" {
+		t.Errorf("Expected default message, got %v", err)
+	}
+}
@@ -0,0 +1,17 @@
+//go:build !unix && !windows
+
+package phpserialize
+
+import (
+	"os"
+)
+
+// lockFile is a no-op on systems with neither flock nor LockFileEx, such as
+// Plan 9 and wasm
+func lockFile(*os.File) error {
+	return nil
+}
+
+func unlockFile(*os.File) error {
+	return nil
+}
@@ -0,0 +1,22 @@
+//go:build unix
+
+package phpserialize
+
+import (
+	"os"
+	"syscall"
+)
+
+// lockFile takes the exclusive flock PHP's files save handler uses
+func lockFile(f *os.File) error {
+	for {
+		err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX)
+		if err != syscall.EINTR {
+			return err
+		}
+	}
+}
+
+func unlockFile(f *os.File) error {
+	return syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+}
@@ -0,0 +1,781 @@
+package phpserialize
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// JSONMode selects how ToJSON and FromJSON represent PHP values
+type JSONMode int
+
+const (
+	// JSONPlain converts like PHP's json_encode and json_decode($json, true):
+	// lists become JSON arrays, other arrays and objects become JSON objects,
+	// and class names, key types and private properties are lost
+	JSONPlain JSONMode = iota
+	// JSONTagged records the type of every value, so the JSON converts back
+	// to byte-identical serialized data
+	JSONTagged
+)
+
+// JSONFlag is a json_encode flag honored by ToJSON in plain mode.
+// The values are PHP's, so flags can be copied from PHP code.
+type JSONFlag int
+
+const (
+	JSONForceObject              JSONFlag = 16   // JSON_FORCE_OBJECT: write lists as objects
+	JSONUnescapedSlashes         JSONFlag = 64   // JSON_UNESCAPED_SLASHES: do not escape '/'
+	JSONPrettyPrint              JSONFlag = 128  // JSON_PRETTY_PRINT: indent with four spaces
+	JSONUnescapedUnicode         JSONFlag = 256  // JSON_UNESCAPED_UNICODE: write non-ASCII characters as is
+	JSONPreserveZeroFraction     JSONFlag = 1024 // JSON_PRESERVE_ZERO_FRACTION: write 1.0 instead of 1
+	JSONUnescapedLineTerminators JSONFlag = 2048 // JSON_UNESCAPED_LINE_TERMINATORS: keep U+2028 and U+2029 with JSONUnescapedUnicode
+)
+
+// jsonMaxDepth is json_encode's default depth limit
+const jsonMaxDepth = 512
+
+// jsonFlagsOption implements Option for json_encode flags
+type jsonFlagsOption struct {
+	flags JSONFlag
+}
+
+func (o jsonFlagsOption) applyMarshal(*marshalConfig) {
+	// No effect on marshal
+}
+
+func (o jsonFlagsOption) applyUnmarshal(cfg *unmarshalConfig) {
+	cfg.jsonFlags = o.flags
+}
+
+// WithJSONFlags sets the json_encode flags used by ToJSON in plain mode,
+// combined with |, e.g. JSONUnescapedSlashes|JSONPrettyPrint
+func WithJSONFlags(flags JSONFlag) Option {
+	return jsonFlagsOption{flags: flags}
+}
+
+// ToJSON converts PHP serialized data to JSON.
+// In plain mode the output matches PHP's json_encode of the unserialized
+// value with the flags from WithJSONFlags: only public properties of objects
+// are written, and NaN, INF, invalid UTF-8 and enums not registered with
+// WithEnum are errors, as in PHP. Values produced by WithEnum or
+// WithCustomDecoder are written with encoding/json.
+// In tagged mode every value becomes an object with a "type" member, see
+// FromJSON; strings that are not valid UTF-8 are written as {"base64": ...}.
+func ToJSON(data string, mode JSONMode, options ...Option) ([]byte, error) {
+	config := newUnmarshalConfig(options)
+	if config.versionErr != nil {
+		return nil, config.versionErr
+	}
+	var buf bytes.Buffer
+	buf.Grow(len(data))
+
+	switch mode {
+	case JSONPlain:
+		value, err := Unmarshal(data, append(options[:len(options):len(options)], WithOrderedArrays(true))...)
+		if err != nil {
+			return nil, err
+		}
+		enc := &jsonEncoder{buf: &buf, flags: config.jsonFlags}
+		if err := enc.value(value, 0); err != nil {
+			return nil, err
+		}
+		if config.jsonFlags&JSONPrettyPrint != 0 {
+			var pretty bytes.Buffer
+			if err := json.Indent(&pretty, buf.Bytes(), "", "    "); err != nil {
+				return nil, err
+			}
+			return pretty.Bytes(), nil
+		}
+	case JSONTagged:
+		r := &stringReader{data: data, pos: 0}
+		t := &jsonTagger{buf: &buf, cfg: config}
+		if err := t.value(r, 0); err != nil {
+			return nil, config.finishError(err, len(data))
+		}
+		if r.pos != len(data) {
+			return nil, config.finishError(syntaxError(r.pos, "unexpected data after value"), len(data))
+		}
+	default:
+		return nil, fmt.Errorf("unknown JSON mode %d", mode)
+	}
+	return buf.Bytes(), nil
+}
+
+// FromJSON converts JSON to PHP serialized data.
+// In plain mode it behaves like PHP's json_decode($json, true) followed by
+// serialize(): objects become arrays, numeric string keys become integer keys,
+// and numbers without a fraction or exponent that fit in 64 bits become integers.
+// In tagged mode it reverses ToJSON. Each value is an object such as
+//
+//	{"type": "null"}
+//	{"type": "bool", "value": true}
+//	{"type": "int", "value": 5}
+//	{"type": "float", "value": 0.5}
+//	{"type": "string", "value": "text"}
+//	{"type": "array", "entries": [{"key": <int or string>, "value": <value>}]}
+//	{"type": "object", "class": "Name", "entries": [...]}
+//	{"type": "custom", "class": "Name", "value": "payload"}
+//	{"type": "enum", "class": "Name", "case": "Case"}
+//	{"type": "object-reference", "value": 1}
+//	{"type": "reference", "value": 1}
+//
+// where numbers may also be given as strings holding PHP's spelling, such as
+// "NAN", and strings may be given as {"base64": "..."}.
+func FromJSON(data []byte, mode JSONMode, options ...Option) (string, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	switch mode {
+	case JSONPlain:
+		value, err := decodePlainJSON(dec)
+		if err != nil {
+			return "", err
+		}
+		if _, err := dec.Token(); err != io.EOF {
+			return "", errors.New("invalid JSON: unexpected data after value")
+		}
+		return Marshal(value, options...)
+	case JSONTagged:
+		var value interface{}
+		if err := dec.Decode(&value); err != nil {
+			return "", fmt.Errorf("invalid JSON: %w", err)
+		}
+		if _, err := dec.Token(); err != io.EOF {
+			return "", errors.New("invalid JSON: unexpected data after value")
+		}
+		config := newUnmarshalConfig(options)
+		if config.versionErr != nil {
+			return "", config.versionErr
+		}
+		var buf bytes.Buffer
+		buf.Grow(len(data) / 2)
+		if err := writeTaggedJSON(&buf, value, config, 0, ""); err != nil {
+			return "", err
+		}
+		return buf.String(), nil
+	}
+	return "", fmt.Errorf("unknown JSON mode %d", mode)
+}
+
+// jsonEncoder writes decoded PHP values following json_encode's rules
+type jsonEncoder struct {
+	buf   *bytes.Buffer
+	flags JSONFlag
+}
+
+func (e *jsonEncoder) value(value interface{}, depth int) error {
+	if depth > jsonMaxDepth {
+		return fmt.Errorf("%w %d in JSON", ErrMaxDepth, jsonMaxDepth)
+	}
+
+	switch v := value.(type) {
+	case nil:
+		e.buf.WriteString("null")
+	case bool:
+		e.buf.WriteString(strconv.FormatBool(v))
+	case int64:
+		e.buf.WriteString(strconv.FormatInt(v, 10))
+	case float64:
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return errors.New("cannot encode NaN or Inf as JSON")
+		}
+		e.buf.WriteString(phpJSONFloat(v, e.flags&JSONPreserveZeroFraction != 0))
+	case string:
+		return writeJSONString(e.buf, v, e.flags)
+	case PHPArray:
+		return e.array(v, depth)
+	case PHPObject:
+		// json_encode only sees the public properties
+		e.buf.WriteByte('{')
+		first := true
+		for _, name := range orderedPropertyNames(v, KeyOrderSorted) {
+			if strings.HasPrefix(name, "\x00") {
+				continue
+			}
+			if !first {
+				e.buf.WriteByte(',')
+			}
+			first = false
+			if err := e.member(name, v.Properties[name], depth); err != nil {
+				return err
+			}
+		}
+		e.buf.WriteByte('}')
+	case PHPCustomObject:
+		if v.Value == nil {
+			e.buf.WriteString("{}")
+			return nil
+		}
+		return e.value(v.Value, depth)
+	case PHPEnum:
+		return fmt.Errorf("%w: enum %s::%s has no JSON value, register it with WithEnum", ErrUnsupportedType, v.ClassName, v.Case)
+	default:
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			return err
+		}
+		e.buf.Write(encoded)
+	}
+	return nil
+}
+
+// array writes a PHP array as a JSON array when it is a list, and as an object otherwise
+func (e *jsonEncoder) array(arr PHPArray, depth int) error {
+	list := e.flags&JSONForceObject == 0
+	for i, entry := range arr {
+		if entry.Key != int64(i) {
+			list = false
+			break
+		}
+	}
+
+	if list {
+		e.buf.WriteByte('[')
+		for i, entry := range arr {
+			if i > 0 {
+				e.buf.WriteByte(',')
+			}
+			if err := e.value(entry.Value, depth+1); err != nil {
+				return prependPath(err, entry.Key)
+			}
+		}
+		e.buf.WriteByte(']')
+		return nil
+	}
+
+	e.buf.WriteByte('{')
+	for i, entry := range arr {
+		if i > 0 {
+			e.buf.WriteByte(',')
+		}
+		if err := e.member(keyString(entry.Key), entry.Value, depth); err != nil {
+			return err
+		}
+	}
+	e.buf.WriteByte('}')
+	return nil
+}
+
+// member writes one "name":value pair of a JSON object
+func (e *jsonEncoder) member(name string, value interface{}, depth int) error {
+	if err := writeJSONString(e.buf, name, e.flags); err != nil {
+		return err
+	}
+	e.buf.WriteByte(':')
+	return e.value(value, depth+1)
+}
+
+// writeJSONString writes s as a JSON string, escaping like json_encode
+func writeJSONString(buf *bytes.Buffer, s string, flags JSONFlag) error {
+	if !utf8.ValidString(s) {
+		return fmt.Errorf("malformed UTF-8 characters in %q, possibly incorrectly encoded", s)
+	}
+	const hex = "0123456789abcdef"
+	buf.WriteByte('"')
+	for _, c := range s {
+		switch {
+		case c == '"':
+			buf.WriteString(`\"`)
+		case c == '\\':
+			buf.WriteString(`\\`)
+		case c == '/' && flags&JSONUnescapedSlashes == 0:
+			buf.WriteString(`\/`)
+		case c == '\b':
+			buf.WriteString(`\b`)
+		case c == '\f':
+			buf.WriteString(`\f`)
+		case c == '\n':
+			buf.WriteString(`\n`)
+		case c == '\r':
+			buf.WriteString(`\r`)
+		case c == '\t':
+			buf.WriteString(`\t`)
+		case c < 0x20:
+			buf.WriteString(`\u00`)
+			buf.WriteByte(hex[c>>4])
+			buf.WriteByte(hex[c&0xf])
+		case c < utf8.RuneSelf:
+			buf.WriteByte(byte(c))
+		case flags&JSONUnescapedUnicode != 0 && (flags&JSONUnescapedLineTerminators != 0 || c != '\u2028' && c != '\u2029'):
+			buf.WriteRune(c)
+		default:
+			// Characters outside the BMP are written as a surrogate pair
+			units := []rune{c}
+			if c > 0xffff {
+				c -= 0x10000
+				units = []rune{0xd800 + c>>10, 0xdc00 + c&0x3ff}
+			}
+			for _, u := range units {
+				buf.WriteString(`\u`)
+				for shift := 12; shift >= 0; shift -= 4 {
+					buf.WriteByte(hex[u>>shift&0xf])
+				}
+			}
+		}
+	}
+	buf.WriteByte('"')
+	return nil
+}
+
+// phpJSONFloat formats f like json_encode with serialize_precision -1
+func phpJSONFloat(f float64, zeroFraction bool) string {
+	s := formatPHPFloat(f, -1, 'e')
+	if zeroFraction && !strings.ContainsAny(s, ".e") {
+		s += ".0"
+	}
+	return s
+}
+
+// decodePlainJSON reads the next JSON value, keeping the order of object members
+func decodePlainJSON(dec *json.Decoder) (interface{}, error) {
+	token, err := dec.Token()
+	if err != nil {
+		return nil, fmt.Errorf("invalid JSON: %w", err)
+	}
+
+	switch t := token.(type) {
+	case json.Delim:
+		arr := PHPArray{}
+		index := make(map[interface{}]int)
+		for i := 0; dec.More(); i++ {
+			var key interface{} = int64(i)
+			if t == '{' {
+				nameToken, err := dec.Token()
+				if err != nil {
+					return nil, fmt.Errorf("invalid JSON: %w", err)
+				}
+				key, _ = normalizeArrayKey(nameToken.(string))
+			}
+			value, err := decodePlainJSON(dec)
+			if err != nil {
+				return nil, err
+			}
+			// A repeated member replaces the earlier one, like json_decode
+			if at, ok := index[key]; ok {
+				arr[at].Value = value
+				continue
+			}
+			index[key] = len(arr)
+			arr = append(arr, PHPArrayEntry{Key: key, Value: value})
+		}
+		if _, err := dec.Token(); err != nil {
+			return nil, fmt.Errorf("invalid JSON: %w", err)
+		}
+		return arr, nil
+	case json.Number:
+		if n, err := t.Int64(); err == nil {
+			return n, nil
+		}
+		return t.Float64()
+	}
+	return token, nil
+}
+
+// jsonTagger converts serialized data to tagged JSON, keeping every token's spelling
+type jsonTagger struct {
+	buf *bytes.Buffer
+	cfg *unmarshalConfig
+}
+
+func (t *jsonTagger) value(r *stringReader, depth int) (err error) {
+	if t.cfg.maxDepth > 0 && depth >= t.cfg.maxDepth {
+		return maxDepthError(r.pos, t.cfg.maxDepth)
+	}
+
+	start := r.pos
+	defer func() {
+		if err != nil {
+			markValueStart(err, start)
+		}
+	}()
+
+	typeChar, err := r.read()
+	if err != nil {
+		return err
+	}
+	if !strings.ContainsRune("NbirRdsaOCE", rune(typeChar)) {
+		return unknownTypeError(start, typeChar)
+	}
+	if typeChar == 'N' {
+		semicolon, err := r.read()
+		if err != nil {
+			return err
+		}
+		if semicolon != ';' {
+			return expectError(r.pos-1, "';'", "after NULL", semicolon)
+		}
+		t.buf.WriteString(`{"type":"null"}`)
+		return nil
+	}
+	colon, err := r.read()
+	if err != nil {
+		return err
+	}
+	if colon != ':' {
+		return expectError(r.pos-1, "':'", fmt.Sprintf("after type '%c'", typeChar), colon)
+	}
+
+	switch typeChar {
+	case 'b', 'i', 'd', 'r', 'R':
+		token, err := r.readUntil(';')
+		if err != nil {
+			return err
+		}
+		if !validScalar(typeChar, token) {
+			return invalidError(r.pos, "value", token)
+		}
+		t.buf.WriteString(`{"type":"`)
+		t.buf.WriteString(taggedScalarTypes[typeChar])
+		t.buf.WriteString(`","value":`)
+		switch {
+		case typeChar == 'b':
+			t.buf.WriteString(strconv.FormatBool(token == "1"))
+		case json.Valid([]byte(token)):
+			t.buf.WriteString(token)
+		default:
+			t.text(token)
+		}
+		t.buf.WriteByte('}')
+		return nil
+
+	case 's':
+		str, err := readQuoted(r, "string", ';')
+		if err != nil {
+			return err
+		}
+		t.buf.WriteString(`{"type":"string","value":`)
+		t.text(str)
+		t.buf.WriteByte('}')
+		return nil
+
+	case 'a':
+		count, err := readCount(r, "array count", "array")
+		if err != nil {
+			return err
+		}
+		t.buf.WriteString(`{"type":"array",`)
+		return t.entries(r, depth, count, "array", false)
+
+	case 'O', 'C':
+		className, err := readClassName(r, t.cfg, typeChar)
+		if err != nil {
+			return err
+		}
+		if typeChar == 'O' {
+			count, err := readCount(r, "property count", "object properties")
+			if err != nil {
+				return err
+			}
+			t.buf.WriteString(`{"type":"object","class":`)
+			t.text(className)
+			t.buf.WriteByte(',')
+			return t.entries(r, depth, count, "object", true)
+		}
+
+		dataLenStr, err := r.readUntil(':')
+		if err != nil {
+			return err
+		}
+		dataLen, err := strconv.Atoi(dataLenStr)
+		if err != nil || dataLen < 0 {
+			return invalidError(r.pos, "payload length", dataLenStr)
+		}
+		brace, err := r.read()
+		if err != nil {
+			return err
+		}
+		if brace != '{' {
+			return expectError(r.pos-1, "'{'", "for custom object payload", brace)
+		}
+		payload, err := r.readBytes(dataLen)
+		if err != nil {
+			return err
+		}
+		brace, err = r.read()
+		if err != nil {
+			return err
+		}
+		if brace != '}' {
+			return expectError(r.pos-1, "'}'", "for custom object", brace)
+		}
+		t.buf.WriteString(`{"type":"custom","class":`)
+		t.text(className)
+		t.buf.WriteString(`,"value":`)
+		t.text(payload)
+		t.buf.WriteByte('}')
+		return nil
+
+	default: // 'E'
+		name, err := readQuoted(r, "enum name", ';')
+		if err != nil {
+			return err
+		}
+		className, caseName, found := strings.Cut(name, ":")
+		if !found || className == "" || caseName == "" {
+			return syntaxError(start, "invalid enum name %q", name)
+		}
+		t.buf.WriteString(`{"type":"enum","class":`)
+		t.text(className)
+		t.buf.WriteString(`,"case":`)
+		t.text(caseName)
+		t.buf.WriteByte('}')
+		return nil
+	}
+}
+
+// taggedScalarTypes names the scalar types in tagged JSON
+var taggedScalarTypes = map[byte]string{
+	'b': "bool",
+	'i': "int",
+	'd': "float",
+	'r': "object-reference",
+	'R': "reference",
+}
+
+// entries writes the "entries" member and closes the value
+func (t *jsonTagger) entries(r *stringReader, depth, count int, body string, object bool) error {
+	t.buf.WriteString(`"entries":[`)
+	for i := 0; i < count; i++ {
+		if i > 0 {
+			t.buf.WriteByte(',')
+		}
+		t.buf.WriteString(`{"key":`)
+		key, err := t.key(r)
+		if err != nil {
+			return err
+		}
+		t.buf.WriteString(`,"value":`)
+		if err := t.value(r, depth+1); err != nil {
+			if object {
+				return prependPath(err, bareName(keyString(key)))
+			}
+			return prependPath(err, key)
+		}
+		t.buf.WriteByte('}')
+	}
+	brace, err := r.read()
+	if err != nil {
+		return err
+	}
+	if brace != '}' {
+		return expectError(r.pos-1, "'}'", "for "+body, brace)
+	}
+	t.buf.WriteString("]}")
+	return nil
+}
+
+// key writes an array key or property name as a tagged int or string
+func (t *jsonTagger) key(r *stringReader) (interface{}, error) {
+	typeChar, err := r.peek()
+	if err != nil {
+		return nil, err
+	}
+	if typeChar != 'i' && typeChar != 's' {
+		return nil, keyTypeError(r.pos, typeChar)
+	}
+
+	start := r.pos
+	if err := t.value(r, 0); err != nil {
+		return nil, err
+	}
+	key := r.slice(start, r.pos)
+	if typeChar == 'i' {
+		return strings.TrimSuffix(key[2:], ";"), nil
+	}
+	_, key, _ = strings.Cut(key, `"`)
+	return key[:len(key)-2], nil
+}
+
+// text writes a JSON string, or {"base64": ...} when s is not valid UTF-8
+func (t *jsonTagger) text(s string) {
+	if utf8.ValidString(s) {
+		writeJSONString(t.buf, s, JSONUnescapedSlashes|JSONUnescapedUnicode|JSONUnescapedLineTerminators)
+		return
+	}
+	t.buf.WriteString(`{"base64":"`)
+	t.buf.WriteString(base64.StdEncoding.EncodeToString([]byte(s)))
+	t.buf.WriteString(`"}`)
+}
+
+// writeTaggedJSON writes the serialized form of a decoded tagged JSON value
+func writeTaggedJSON(buf *bytes.Buffer, value interface{}, cfg *unmarshalConfig, depth int, path string) error {
+	if cfg.maxDepth > 0 && depth >= cfg.maxDepth {
+		return fmt.Errorf("%w %d at %q", ErrMaxDepth, cfg.maxDepth, path)
+	}
+	fail := func(format string, args ...interface{}) error {
+		return fmt.Errorf("tagged JSON value at %q: %s", path, fmt.Sprintf(format, args...))
+	}
+
+	obj, ok := value.(map[string]interface{})
+	if !ok {
+		return fail("expected an object, got %s", jsonTypeName(value))
+	}
+	typeName, _ := obj["type"].(string)
+
+	switch typeName {
+	case "null":
+		buf.WriteString("N;")
+
+	case "bool":
+		b, ok := obj["value"].(bool)
+		if !ok {
+			return fail("bool value must be true or false")
+		}
+		if b {
+			buf.WriteString("b:1;")
+		} else {
+			buf.WriteString("b:0;")
+		}
+
+	case "int", "float", "object-reference", "reference":
+		var token string
+		switch v := obj["value"].(type) {
+		case json.Number:
+			token = v.String()
+		case string:
+			token = v
+		default:
+			return fail("%s value must be a number or a string", typeName)
+		}
+		typeChar := map[string]byte{"int": 'i', "float": 'd', "object-reference": 'r', "reference": 'R'}[typeName]
+		if !validScalar(typeChar, token) {
+			return fail("invalid %s %q", typeName, token)
+		}
+		buf.WriteByte(typeChar)
+		buf.WriteByte(':')
+		buf.WriteString(token)
+		buf.WriteByte(';')
+
+	case "string":
+		s, err := taggedText(obj["value"])
+		if err != nil {
+			return fail("string value: %v", err)
+		}
+		writeString(buf, s)
+
+	case "array", "object":
+		entries, ok := obj["entries"].([]interface{})
+		if !ok {
+			return fail("%s entries must be an array", typeName)
+		}
+		if typeName == "object" {
+			className, err := taggedText(obj["class"])
+			if err != nil {
+				return fail("class: %v", err)
+			}
+			if !cfg.isClassAllowed(className) {
+				return fmt.Errorf("tagged JSON value at %q: %w: %s", path, ErrClassNotAllowed, className)
+			}
+			buf.WriteString("O:")
+			writeQuoted(buf, className)
+			buf.WriteByte(':')
+		} else {
+			buf.WriteString("a:")
+		}
+		buf.WriteString(strconv.Itoa(len(entries)))
+		buf.WriteString(":{")
+		for i, e := range entries {
+			entry, ok := e.(map[string]interface{})
+			if !ok {
+				return fail("entry %d must be an object", i)
+			}
+			keyObj, _ := entry["key"].(map[string]interface{})
+			if keyType, _ := keyObj["type"].(string); keyType != "int" && keyType != "string" {
+				return fail("key of entry %d must be an int or a string", i)
+			}
+			if err := writeTaggedJSON(buf, keyObj, cfg, depth+1, path); err != nil {
+				return err
+			}
+			key := fmt.Sprint(keyObj["value"])
+			if err := writeTaggedJSON(buf, entry["value"], cfg, depth+1, joinPath(path, key)); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte('}')
+
+	case "custom":
+		className, err := taggedText(obj["class"])
+		if err != nil {
+			return fail("class: %v", err)
+		}
+		if !cfg.isClassAllowed(className) {
+			return fmt.Errorf("tagged JSON value at %q: %w: %s", path, ErrClassNotAllowed, className)
+		}
+		payload, err := taggedText(obj["value"])
+		if err != nil {
+			return fail("custom value: %v", err)
+		}
+		buf.WriteString("C:")
+		writeQuoted(buf, className)
+		buf.WriteByte(':')
+		buf.WriteString(strconv.Itoa(len(payload)))
+		buf.WriteString(":{")
+		buf.WriteString(payload)
+		buf.WriteByte('}')
+
+	case "enum":
+		className, err := taggedText(obj["class"])
+		if err != nil {
+			return fail("class: %v", err)
+		}
+		caseName, err := taggedText(obj["case"])
+		if err != nil {
+			return fail("case: %v", err)
+		}
+		if className == "" || caseName == "" || strings.Contains(className, ":") {
+			return fail("invalid enum %s::%s", className, caseName)
+		}
+		if !cfg.isClassAllowed(className) {
+			return fmt.Errorf("tagged JSON value at %q: %w: %s", path, ErrClassNotAllowed, className)
+		}
+		buf.WriteString("E:")
+		writeQuoted(buf, className+":"+caseName)
+		buf.WriteByte(';')
+
+	default:
+		return fail("unknown type %q", typeName)
+	}
+	return nil
+}
+
+// taggedText decodes a JSON string or a {"base64": ...} object
+func taggedText(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case string:
+		return v, nil
+	case map[string]interface{}:
+		if encoded, ok := v["base64"].(string); ok {
+			decoded, err := base64.StdEncoding.DecodeString(encoded)
+			return string(decoded), err
+		}
+	}
+	return "", fmt.Errorf("expected a string or {\"base64\": ...}, got %s", jsonTypeName(value))
+}
+
+// jsonTypeName describes a decoded JSON value for error messages
+func jsonTypeName(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case json.Number:
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	return reflect.TypeOf(value).String()
+}
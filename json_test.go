@@ -0,0 +1,167 @@
+package phpserialize
+
+import (
+	"errors"
+	"math"
+	"strings"
+	"testing"
+)
+
+// TestToJSONPlain tests conversion following json_encode's rules
+func TestToJSONPlain(t *testing.T) {
+	tests := []struct {
+		name  string
+		data  string
+		flags JSONFlag
+		want  string
+	}{
+		{"list", `a:2:{i:0;s:1:"a";i:1;i:2;}`, 0, `["a",2]`},
+		{"force object", `a:2:{i:0;s:1:"a";i:1;i:2;}`, JSONForceObject, `{"0":"a","1":2}`},
+		{"map", `a:2:{i:1;s:1:"a";s:1:"k";b:1;}`, 0, `{"1":"a","k":true}`},
+		{"empty array", `a:0:{}`, 0, `[]`},
+		{"object", "O:4:\"User\":3:{s:4:\"name\";s:3:\"Ann\";s:5:\"\x00*\x00id\";i:1;s:4:\"tags\";a:0:{}}", 0, `{"name":"Ann","tags":[]}`},
+		{"empty object", `O:8:"stdClass":0:{}`, 0, `{}`},
+		{"floats", `a:5:{i:0;d:1;i:1;d:0.1;i:2;d:1.0E+25;i:3;d:1.0E-5;i:4;d:-0.5;}`, 0, `[1,0.1,1.0e+25,1.0e-5,-0.5]`},
+		{"zero fraction", `a:2:{i:0;d:1;i:1;d:100;}`, JSONPreserveZeroFraction, `[1.0,100.0]`},
+		{"escapes", "s:12:\"a/b \"é\" \u2028\";", 0, `"a\/b \"\u00e9\" \u2028"`},
+		{"unescaped", "s:12:\"a/b \"é\" \u2028\";", JSONUnescapedSlashes | JSONUnescapedUnicode, "\"a/b \\\"é\\\" \\u2028\""},
+		{"control", "s:3:\"\x01\n\t\";", 0, `"\u0001\n\t"`},
+		{"emoji", `s:4:"😀";`, 0, `"\ud83d\ude00"`},
+		{"references", `a:2:{i:0;a:1:{i:0;i:1;}i:1;R:2;}`, 0, `[[1],[1]]`},
+		{"pretty", `a:1:{s:1:"a";a:1:{i:0;i:1;}}`, JSONPrettyPrint, "{\n    \"a\": [\n        1\n    ]\n}"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ToJSON(tt.data, JSONPlain, WithJSONFlags(tt.flags))
+			if err != nil {
+				t.Fatalf("ToJSON failed: %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("Expected %s, got %s", tt.want, got)
+			}
+		})
+	}
+}
+
+// TestToJSONPlainErrors tests values json_encode rejects
+func TestToJSONPlainErrors(t *testing.T) {
+	for _, data := range []string{`d:NAN;`, `d:INF;`, "s:1:\"\xff\";", `E:7:"Suit:Hi";`} {
+		if _, err := ToJSON(data, JSONPlain); err == nil {
+			t.Errorf("Expected error for %s", data)
+		}
+	}
+
+	got, err := ToJSON(`E:7:"Suit:Hi";`, JSONPlain, WithEnum("Suit", map[string]string{"Hi": "H"}))
+	if err != nil || string(got) != `"H"` {
+		t.Errorf(`Expected "H" for a registered enum, got %s (%v)`, got, err)
+	}
+}
+
+// TestFromJSONPlain tests conversion like json_decode($json, true) and serialize()
+func TestFromJSONPlain(t *testing.T) {
+	tests := []struct {
+		json string
+		want string
+	}{
+		{`null`, `N;`},
+		{`[1, 2.5, "x", true]`, `a:4:{i:0;i:1;i:1;d:2.5;i:2;s:1:"x";i:3;b:1;}`},
+		{`{"b": 1, "5": 2, "05": 3, "b": 4}`, `a:3:{s:1:"b";i:4;i:5;i:2;s:2:"05";i:3;}`},
+		{`{"n": 1e3, "big": 18446744073709551616}`, `a:2:{s:1:"n";d:1000;s:3:"big";d:18446744073709552000;}`},
+	}
+	for _, tt := range tests {
+		got, err := FromJSON([]byte(tt.json), JSONPlain)
+		if err != nil {
+			t.Fatalf("FromJSON(%s) failed: %v", tt.json, err)
+		}
+		if got != tt.want {
+			t.Errorf("FromJSON(%s): expected %s, got %s", tt.json, tt.want, got)
+		}
+	}
+
+	if _, err := FromJSON([]byte(`[1] [2]`), JSONPlain); err == nil {
+		t.Error("Expected error for trailing data")
+	}
+}
+
+// TestJSONTaggedRoundTrip tests that tagged JSON converts back to identical bytes
+func TestJSONTaggedRoundTrip(t *testing.T) {
+	inputs := []string{
+		`N;`,
+		`b:0;`,
+		`i:-0;`,
+		`d:0.1000000000000000055511151231257827;`,
+		`d:1.0E+25;`,
+		`d:NAN;`,
+		"s:4:\"\xff\x00ab\";",
+		`a:3:{i:5;s:1:"a";s:1:"5";d:-INF;s:0:"";a:0:{}}`,
+		"O:4:\"User\":2:{s:5:\"\x00*\x00id\";i:1;s:4:\"self\";r:1;}",
+		`a:2:{i:0;a:0:{}i:1;R:2;}`,
+		`C:11:"ArrayObject":21:{x:i:0;a:0:{};m:a:0:{}}`,
+		`E:11:"Suit:Hearts";`,
+		"s:3:\"\u2028\";",
+	}
+	for _, data := range inputs {
+		tagged, err := ToJSON(data, JSONTagged)
+		if err != nil {
+			t.Fatalf("ToJSON(%q) failed: %v", data, err)
+		}
+		back, err := FromJSON(tagged, JSONTagged)
+		if err != nil {
+			t.Fatalf("FromJSON(%s) failed: %v", tagged, err)
+		}
+		if back != data {
+			t.Errorf("Expected %q, got %q via %s", data, back, tagged)
+		}
+	}
+
+	tagged, _ := ToJSON(`a:1:{s:1:"k";i:7;}`, JSONTagged)
+	want := `{"type":"array","entries":[{"key":{"type":"string","value":"k"},"value":{"type":"int","value":7}}]}`
+	if string(tagged) != want {
+		t.Errorf("Expected %s, got %s", want, tagged)
+	}
+}
+
+// TestFromJSONTaggedErrors tests that malformed tagged JSON is rejected
+func TestFromJSONTaggedErrors(t *testing.T) {
+	tests := []string{
+		`{"type":"int","value":"x"}`,
+		`{"type":"bool","value":1}`,
+		`{"type":"blob"}`,
+		`[1]`,
+		`{"type":"array","entries":[{"key":{"type":"null"},"value":{"type":"null"}}]}`,
+		`{"type":"array","entries":[{"key":{"type":"int","value":0},"value":{"type":"float","value":"1.5x"}}]}`,
+	}
+	for _, data := range tests {
+		if _, err := FromJSON([]byte(data), JSONTagged); err == nil {
+			t.Errorf("Expected error for %s", data)
+		}
+	}
+
+	_, err := FromJSON([]byte(`{"type":"object","class":"Evil","entries":[]}`), JSONTagged, WithAllowedClasses(nil))
+	if !errors.Is(err, ErrClassNotAllowed) {
+		t.Errorf("Expected ErrClassNotAllowed, got %v", err)
+	}
+}
+
+// TestPHPJSONFloat tests json_encode's float formatting
+func TestPHPJSONFloat(t *testing.T) {
+	tests := map[float64]string{
+		0:                    "0",
+		1e16:                 "10000000000000000",
+		1e17:                 "1.0e+17",
+		0.0001:               "0.0001",
+		1.5e-7:               "1.5e-7",
+		-1.25e20:             "-1.25e+20",
+		math.MaxFloat64:      "1.7976931348623157e+308",
+		123456.789:           "123456.789",
+		math.Copysign(0, -1): "-0",
+	}
+	for f, want := range tests {
+		if got := phpJSONFloat(f, false); got != want {
+			t.Errorf("phpJSONFloat(%v): expected %s, got %s", f, want, got)
+		}
+	}
+	if got := phpJSONFloat(-0.0, true); !strings.HasSuffix(got, ".0") {
+		t.Errorf("Expected zero fraction, got %s", got)
+	}
+}
@@ -0,0 +1,88 @@
+package phpserialize
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// testMoney serializes as a "12.50 EUR" string
+type testMoney struct {
+	Cents    int64
+	Currency string
+}
+
+func (m testMoney) MarshalPHP() ([]byte, error) {
+	s := fmt.Sprintf("%d.%02d %s", m.Cents/100, m.Cents%100, m.Currency)
+	return []byte(fmt.Sprintf("s:%d:\"%s\";", len(s), s)), nil
+}
+
+func (m *testMoney) UnmarshalPHP(data []byte) error {
+	s, err := Unmarshal(string(data))
+	if err != nil {
+		return err
+	}
+	str, ok := s.(string)
+	if !ok {
+		return fmt.Errorf("money must be a string, got %T", s)
+	}
+	var units, cents int64
+	_, err = fmt.Sscanf(str, "%d.%02d %s", &units, &cents, &m.Currency)
+	m.Cents = units*100 + cents
+	return err
+}
+
+type testBadMarshaler struct{}
+
+func (testBadMarshaler) MarshalPHP() ([]byte, error) { return []byte("s:5:\"x\";"), nil }
+
+type testInvoice struct {
+	Total testMoney   `php:"total"`
+	Lines []testMoney `php:"lines"`
+	After int         `php:"after"`
+}
+
+// TestMarshaler tests the Marshaler interface at any nesting level
+func TestMarshaler(t *testing.T) {
+	inv := testInvoice{
+		Total: testMoney{1250, "EUR"},
+		Lines: []testMoney{{1000, "EUR"}, {250, "EUR"}},
+		After: 1,
+	}
+	result, err := Marshal(inv)
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	expected := `a:3:{s:5:"total";s:9:"12.50 EUR";s:5:"lines";a:2:{i:0;s:9:"10.00 EUR";i:1;s:8:"2.50 EUR";}s:5:"after";i:1;}`
+	if result != expected {
+		t.Errorf("Expected %q, got %q", expected, result)
+	}
+
+	// Invalid output is rejected
+	if _, err := Marshal([]interface{}{testBadMarshaler{}}); err == nil || !strings.Contains(err.Error(), "invalid data") {
+		t.Errorf("Expected invalid data error, got %v", err)
+	}
+}
+
+// TestUnmarshaler tests the Unmarshaler interface with UnmarshalTo
+func TestUnmarshaler(t *testing.T) {
+	data := `a:3:{s:5:"total";s:9:"12.50 EUR";s:5:"lines";a:2:{i:0;s:9:"10.00 EUR";i:1;s:8:"2.50 EUR";}s:5:"after";i:1;}`
+
+	var inv testInvoice
+	if err := UnmarshalTo(data, &inv); err != nil {
+		t.Fatalf("UnmarshalTo failed: %v", err)
+	}
+	if inv.Total != (testMoney{1250, "EUR"}) || len(inv.Lines) != 2 || inv.Lines[1] != (testMoney{250, "EUR"}) || inv.After != 1 {
+		t.Errorf("Unexpected invoice: %+v", inv)
+	}
+
+	var ptr *testMoney
+	if err := UnmarshalTo(`s:8:"1.05 USD";`, &ptr); err != nil || ptr == nil || *ptr != (testMoney{105, "USD"}) {
+		t.Errorf("Expected *testMoney, got %v (%v)", ptr, err)
+	}
+
+	err := UnmarshalTo(`a:1:{s:5:"total";i:5;}`, &inv)
+	if err == nil || !strings.Contains(err.Error(), `"total"`) {
+		t.Errorf("Expected error naming path total, got %v", err)
+	}
+}
@@ -0,0 +1,125 @@
+package phpserialize
+
+import (
+	"strings"
+)
+
+// Visibility is the visibility of a PHP object property
+type Visibility int
+
+const (
+	// Public properties are serialized under their plain name
+	Public Visibility = iota
+	// Protected properties are serialized as "\0*\0name"
+	Protected
+	// Private properties are serialized as "\0Class\0name", where Class declares the property
+	Private
+)
+
+// String returns the PHP keyword for the visibility
+func (v Visibility) String() string {
+	switch v {
+	case Protected:
+		return "protected"
+	case Private:
+		return "private"
+	}
+	return "public"
+}
+
+// PropertyName returns the serialized (mangled) name of a property.
+// class is the declaring class and is only used for private properties.
+func PropertyName(name string, visibility Visibility, class string) string {
+	switch visibility {
+	case Protected:
+		return "\x00*\x00" + name
+	case Private:
+		return "\x00" + class + "\x00" + name
+	}
+	return name
+}
+
+// ParsePropertyName splits a serialized property name into its bare name,
+// visibility and, for private properties, the declaring class
+func ParsePropertyName(mangled string) (name string, visibility Visibility, class string) {
+	if len(mangled) == 0 || mangled[0] != 0 {
+		return mangled, Public, ""
+	}
+	class, name, found := strings.Cut(mangled[1:], "\x00")
+	if !found {
+		return mangled, Public, ""
+	}
+	if class == "*" {
+		return name, Protected, ""
+	}
+	return name, Private, class
+}
+
+// bareName removes visibility prefixes from a property name if present
+func bareName(mangled string) string {
+	name, _, _ := ParsePropertyName(mangled)
+	return name
+}
+
+// Get returns a property by its bare name, whatever its visibility.
+// When several properties share the name, the public one wins, then the
+// protected one, then the one declared private by the object's own class.
+func (o PHPObject) Get(name string) (interface{}, bool) {
+	key, ok := o.propertyKey(name)
+	if !ok {
+		return nil, false
+	}
+	return o.Properties[key], true
+}
+
+// PropertyVisibility returns the visibility and, for private properties, the
+// declaring class of the property Get would return
+func (o PHPObject) PropertyVisibility(name string) (Visibility, string, bool) {
+	key, ok := o.propertyKey(name)
+	if !ok {
+		return Public, "", false
+	}
+	_, visibility, class := ParsePropertyName(key)
+	return visibility, class, true
+}
+
+// Set stores a property by its bare name, keeping the visibility of an existing
+// property with that name; new properties are public
+func (o *PHPObject) Set(name string, value interface{}) {
+	if o.Properties == nil {
+		o.Properties = make(map[string]interface{})
+	}
+	key, ok := o.propertyKey(name)
+	if !ok {
+		key = name
+		o.Order = append(o.Order, key)
+	}
+	o.Properties[key] = value
+}
+
+// propertyKey finds the serialized name of the property with the given bare name
+func (o PHPObject) propertyKey(name string) (string, bool) {
+	candidates := []string{
+		name,
+		PropertyName(name, Protected, ""),
+		PropertyName(name, Private, o.ClassName),
+	}
+	for _, key := range candidates {
+		if _, ok := o.Properties[key]; ok {
+			return key, true
+		}
+	}
+
+	// Private property declared by a parent class; pick the first in order
+	for _, key := range o.Order {
+		if _, ok := o.Properties[key]; ok && bareName(key) == name {
+			return key, true
+		}
+	}
+	for key := range o.Properties {
+		if bareName(key) == name {
+			return key, true
+		}
+	}
+	return "", false
+}
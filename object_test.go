@@ -0,0 +1,101 @@
+package phpserialize
+
+import (
+	"testing"
+)
+
+// TestPropertyVisibility tests that colliding private/protected properties are kept apart
+func TestPropertyVisibility(t *testing.T) {
+	data := "O:5:\"Child\":3:{s:10:\"\x00Parent\x00id\";i:1;s:5:\"\x00*\x00id\";i:2;s:13:\"\x00Child\x00secret\";s:1:\"s\";}"
+
+	result, err := Unmarshal(data)
+	if err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	obj := result.(PHPObject)
+	if len(obj.Properties) != 3 {
+		t.Fatalf("Expected 3 distinct properties, got %d", len(obj.Properties))
+	}
+
+	// Protected wins over a parent's private property with the same name
+	if v, ok := obj.Get("id"); !ok || v != int64(2) {
+		t.Errorf("Expected protected id=2, got %v", v)
+	}
+	if v := obj.Properties[PropertyName("id", Private, "Parent")]; v != int64(1) {
+		t.Errorf("Expected Parent's private id=1, got %v", v)
+	}
+	if vis, class, ok := obj.PropertyVisibility("secret"); !ok || vis != Private || class != "Child" {
+		t.Errorf("Unexpected visibility for secret: %v %q %v", vis, class, ok)
+	}
+
+	out, err := Marshal(obj)
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	if out != data {
+		t.Errorf("Expected %q, got %q", data, out)
+	}
+
+	// Set keeps the existing visibility
+	obj.Set("secret", "t")
+	if obj.Properties["\x00Child\x00secret"] != "t" {
+		t.Error("Expected Set to update the private property")
+	}
+	obj.Set("name", "n")
+	if obj.Properties["name"] != "n" {
+		t.Error("Expected Set to add a public property")
+	}
+}
+
+// TestParsePropertyName tests mangled name parsing
+func TestParsePropertyName(t *testing.T) {
+	tests := []struct {
+		mangled    string
+		name       string
+		visibility Visibility
+		class      string
+	}{
+		{"id", "id", Public, ""},
+		{"\x00*\x00id", "id", Protected, ""},
+		{"\x00App\\User\x00id", "id", Private, `App\User`},
+		{"\x00broken", "\x00broken", Public, ""},
+	}
+	for _, tt := range tests {
+		name, vis, class := ParsePropertyName(tt.mangled)
+		if name != tt.name || vis != tt.visibility || class != tt.class {
+			t.Errorf("ParsePropertyName(%q) = %q, %v, %q", tt.mangled, name, vis, class)
+		}
+		if tt.visibility != Public || tt.mangled == tt.name {
+			if got := PropertyName(name, vis, class); got != tt.mangled {
+				t.Errorf("PropertyName(%q, %v, %q) = %q, expected %q", name, vis, class, got, tt.mangled)
+			}
+		}
+	}
+}
+
+type testAccount struct {
+	_       struct{} `php:"Account,class"`
+	ID      int      `php:"id"`
+	Balance int      `php:"balance,protected"`
+	Token   string   `php:"token,private"`
+}
+
+// TestStructVisibility tests the protected and private tag options
+func TestStructVisibility(t *testing.T) {
+	out, err := Marshal(testAccount{ID: 1, Balance: 5, Token: "t"})
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	expected := "O:7:\"Account\":3:{s:2:\"id\";i:1;s:10:\"\x00*\x00balance\";i:5;s:14:\"\x00Account\x00token\";s:1:\"t\";}"
+	if out != expected {
+		t.Errorf("Expected %q, got %q", expected, out)
+	}
+
+	var back testAccount
+	if err := UnmarshalTo(out, &back); err != nil {
+		t.Fatalf("UnmarshalTo failed: %v", err)
+	}
+	if back.ID != 1 || back.Balance != 5 || back.Token != "t" {
+		t.Errorf("Unexpected account: %+v", back)
+	}
+}
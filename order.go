@@ -0,0 +1,171 @@
+package phpserialize
+
+import (
+	"reflect"
+	"sort"
+	"strconv"
+)
+
+// KeyOrder selects the order in which Marshal writes map keys and PHPObject properties
+type KeyOrder int
+
+const (
+	// KeyOrderNone keeps Go's map iteration order, which changes between runs (default)
+	KeyOrderNone KeyOrder = iota
+	// KeyOrderSorted writes integer keys first in ascending order, then string keys in
+	// byte order. Strings holding a canonical integer such as "10", which PHP stores
+	// as integer keys, count as integers; "09", "9a" and "1.5" are strings. This is
+	// not PHP's SORT_REGULAR, whose numeric string comparison differs between PHP 7 and 8.
+	KeyOrderSorted
+	// KeyOrderNatural is KeyOrderSorted with string keys in natural order, so "item2"
+	// comes before "item10"
+	KeyOrderNatural
+)
+
+// keyOrderOption implements Option for deterministic output
+type keyOrderOption struct {
+	order KeyOrder
+}
+
+func (o keyOrderOption) applyMarshal(cfg *marshalConfig) {
+	cfg.keyOrder = o.order
+}
+
+func (o keyOrderOption) applyUnmarshal(*unmarshalConfig) {
+	// No effect on unmarshal
+}
+
+// WithKeyOrder makes Marshal output deterministic by writing map keys and
+// PHPObject properties in the given order. Properties listed in PHPObject.Order
+// are always written first, in that order.
+func WithKeyOrder(order KeyOrder) Option {
+	return keyOrderOption{order: order}
+}
+
+// sortMapKeys orders reflected map keys for output
+func sortMapKeys(keys []reflect.Value, order KeyOrder) {
+	if order == KeyOrderNone {
+		return
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keyLess(mapKeyInterface(keys[i]), mapKeyInterface(keys[j]), order)
+	})
+}
+
+// sortStringKeys orders property names for output
+func sortStringKeys(keys []string, order KeyOrder) {
+	if order == KeyOrderNone {
+		return
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keyLess(keys[i], keys[j], order)
+	})
+}
+
+func mapKeyInterface(key reflect.Value) interface{} {
+	switch key.Kind() {
+	case reflect.String:
+		return key.String()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return key.Int()
+	}
+	return key.Interface()
+}
+
+// keyLess compares two keys. Strings holding a canonical integer count as
+// integers, since PHP stores them as integer keys.
+func keyLess(a, b interface{}, order KeyOrder) bool {
+	an, aInt := keyInt(a)
+	bn, bInt := keyInt(b)
+	switch {
+	case aInt && bInt:
+		return an < bn
+	case aInt != bInt:
+		return aInt
+	}
+
+	as, bs := keyString(a), keyString(b)
+	if order == KeyOrderNatural {
+		return naturalLess(as, bs)
+	}
+	return as < bs
+}
+
+func keyInt(key interface{}) (int64, bool) {
+	switch k := key.(type) {
+	case int64:
+		return k, true
+	case string:
+		if n, err := strconv.ParseInt(k, 10, 64); err == nil && strconv.FormatInt(n, 10) == k {
+			return n, true
+		}
+	}
+	return 0, false
+}
+
+// naturalLess compares strings with runs of digits compared by numeric value
+func naturalLess(a, b string) bool {
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		if isDigit(a[i]) && isDigit(b[j]) {
+			// Skip leading zeros, then the longer run of digits is the larger number
+			si, sj := i, j
+			for si < len(a) && a[si] == '0' {
+				si++
+			}
+			for sj < len(b) && b[sj] == '0' {
+				sj++
+			}
+			ei, ej := si, sj
+			for ei < len(a) && isDigit(a[ei]) {
+				ei++
+			}
+			for ej < len(b) && isDigit(b[ej]) {
+				ej++
+			}
+			if ei-si != ej-sj {
+				return ei-si < ej-sj
+			}
+			if a[si:ei] != b[sj:ej] {
+				return a[si:ei] < b[sj:ej]
+			}
+			i, j = ei, ej
+			continue
+		}
+		if a[i] != b[j] {
+			return a[i] < b[j]
+		}
+		i++
+		j++
+	}
+	if len(a)-i != len(b)-j {
+		return len(a)-i < len(b)-j
+	}
+	return a < b
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// orderedPropertyNames returns the property names of obj in output order:
+// names from obj.Order first, then the remaining ones in the configured key order
+func orderedPropertyNames(obj PHPObject, order KeyOrder) []string {
+	names := make([]string, 0, len(obj.Properties))
+	listed := make(map[string]bool, len(obj.Order))
+	for _, name := range obj.Order {
+		if _, ok := obj.Properties[name]; ok && !listed[name] {
+			listed[name] = true
+			names = append(names, name)
+		}
+	}
+
+	rest := make([]string, 0, len(obj.Properties)-len(names))
+	for name := range obj.Properties {
+		if !listed[name] {
+			rest = append(rest, name)
+		}
+	}
+	sortStringKeys(rest, order)
+	return append(names, rest...)
+}
@@ -0,0 +1,93 @@
+package phpserialize
+
+import (
+	"testing"
+)
+
+// TestKeyOrder tests deterministic map key ordering
+func TestKeyOrder(t *testing.T) {
+	m := map[string]interface{}{
+		"item10": 1,
+		"item2":  2,
+		"b":      3,
+		"10":     4,
+		"9":      5,
+		"A":      6,
+	}
+
+	sorted := `a:6:{s:1:"9";i:5;s:2:"10";i:4;s:1:"A";i:6;s:1:"b";i:3;s:6:"item10";i:1;s:5:"item2";i:2;}`
+	natural := `a:6:{s:1:"9";i:5;s:2:"10";i:4;s:1:"A";i:6;s:1:"b";i:3;s:5:"item2";i:2;s:6:"item10";i:1;}`
+
+	for i := 0; i < 20; i++ {
+		out, err := Marshal(m, WithKeyOrder(KeyOrderSorted))
+		if err != nil {
+			t.Fatalf("Marshal failed: %v", err)
+		}
+		if out != sorted {
+			t.Fatalf("Expected %q, got %q", sorted, out)
+		}
+	}
+
+	out, err := Marshal(m, WithKeyOrder(KeyOrderNatural))
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	if out != natural {
+		t.Errorf("Expected %q, got %q", natural, out)
+	}
+
+	// Only canonical integers count as integers, other strings are compared byte by byte
+	mixed := map[string]interface{}{"10": 1, "9a": 2, "": 3, "09": 4, "-3": 5, "b": 6, "1.5": 7}
+	want := `a:7:{s:2:"-3";i:5;s:2:"10";i:1;s:0:"";i:3;s:2:"09";i:4;s:3:"1.5";i:7;s:2:"9a";i:2;s:1:"b";i:6;}`
+	if out, _ := Marshal(mixed, WithKeyOrder(KeyOrderSorted)); out != want {
+		t.Errorf("Expected %q, got %q", want, out)
+	}
+
+	ints := map[int]string{3: "c", -1: "a", 2: "b"}
+	out, _ = Marshal(ints, WithKeyOrder(KeyOrderSorted))
+	if out != `a:3:{i:-1;s:1:"a";i:2;s:1:"b";i:3;s:1:"c";}` {
+		t.Errorf("Unexpected int key order: %q", out)
+	}
+}
+
+// TestObjectPropertyOrder tests explicit and decoded PHPObject property order
+func TestObjectPropertyOrder(t *testing.T) {
+	obj := PHPObject{
+		ClassName:  "User",
+		Properties: map[string]interface{}{"name": "x", "id": 1, "email": "e", "age": 3},
+		Order:      []string{"name", "id", "missing"},
+	}
+	expected := `O:4:"User":4:{s:4:"name";s:1:"x";s:2:"id";i:1;s:3:"age";i:3;s:5:"email";s:1:"e";}`
+	out, err := Marshal(obj, WithKeyOrder(KeyOrderSorted))
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	if out != expected {
+		t.Errorf("Expected %q, got %q", expected, out)
+	}
+
+	// Decoded objects remember their order, so they round-trip without options
+	data := `O:4:"User":3:{s:1:"z";i:1;s:1:"a";i:2;s:1:"m";i:3;}`
+	for i := 0; i < 20; i++ {
+		out, err := Marshal(MustUnmarshal(data))
+		if err != nil {
+			t.Fatalf("Marshal failed: %v", err)
+		}
+		if out != data {
+			t.Fatalf("Expected %q, got %q", data, out)
+		}
+	}
+}
+
+// TestNaturalLess tests natural string comparison
+func TestNaturalLess(t *testing.T) {
+	ordered := []string{"", "a", "a1", "a01b", "a2", "a10", "ab", "b"}
+	for i := 0; i < len(ordered)-1; i++ {
+		if !naturalLess(ordered[i], ordered[i+1]) {
+			t.Errorf("Expected %q < %q", ordered[i], ordered[i+1])
+		}
+		if naturalLess(ordered[i+1], ordered[i]) {
+			t.Errorf("Expected not %q < %q", ordered[i+1], ordered[i])
+		}
+	}
+}
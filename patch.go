@@ -0,0 +1,173 @@
+package phpserialize
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Set returns data with the value at path replaced by the serialized form of
+// value. The path is written like for Get. When the last key of the path does
+// not exist, an entry is appended to its array, or a public property to its
+// object, and the entry count is updated. An empty path replaces everything.
+//
+// All other bytes of data are kept as they are, so key order and formatting
+// survive. References after the new value are renumbered when it holds a
+// different number of values than the old one; a reference into the old
+// value, other than to the value itself, is an error. An entry holding a
+// reference is replaced rather than followed.
+func Set(data, path string, value interface{}, options ...Option) (string, error) {
+	encoded, err := Marshal(value, options...)
+	if err != nil {
+		return "", err
+	}
+	segments := splitPath(path)
+	if len(segments) == 0 {
+		return encoded, nil
+	}
+
+	cfg := newUnmarshalConfig(options)
+	s := &pathScanner{r: &stringReader{data: data, pos: 0}, cfg: cfg}
+	loc, err := s.locate(segments, false)
+	if err == nil {
+		change := pathEdit{start: loc.start, end: loc.end}
+		return patch(data, cfg, path, change, encoded, loc.slot, loc.slots, nil)
+	}
+	if !s.absent {
+		return "", cfg.finishError(err, len(data))
+	}
+
+	// The entry goes last, where its values take the slots after the container
+	var key bytes.Buffer
+	k, _ := normalizeArrayKey(segments[len(segments)-1])
+	if n, ok := k.(int64); ok && !s.container.object {
+		key.WriteString("i:" + strconv.FormatInt(n, 10) + ";")
+	} else {
+		writeString(&key, segments[len(segments)-1])
+	}
+	change := pathEdit{start: s.container.close, end: s.container.close, text: key.String()}
+	return patch(data, cfg, path, change, encoded, s.count, 0, s.countEdit(1))
+}
+
+// Delete returns data without the array entry or property at path, updating
+// the entry count of its container. All other bytes of data are kept as they
+// are, and references after the entry are renumbered; deleting a value that
+// is referenced from elsewhere is an error.
+func Delete(data, path string, options ...Option) (string, error) {
+	segments := splitPath(path)
+	if len(segments) == 0 {
+		return "", errors.New("cannot delete the whole value")
+	}
+
+	cfg := newUnmarshalConfig(options)
+	if cfg.versionErr != nil {
+		return "", cfg.versionErr
+	}
+	s := &pathScanner{r: &stringReader{data: data, pos: 0}, cfg: cfg}
+	loc, err := s.locate(segments, false)
+	if err != nil {
+		return "", cfg.finishError(err, len(data))
+	}
+	change := pathEdit{start: s.container.keyStart, end: loc.end}
+	return patch(data, cfg, path, change, "", loc.slot, loc.slots, s.countEdit(-1))
+}
+
+// pathEdit replaces data[start:end] by text
+type pathEdit struct {
+	start, end int
+	text       string
+}
+
+// countEdit changes the entry count of the container enter found
+func (s *pathScanner) countEdit(delta int) *pathEdit {
+	c := s.container
+	return &pathEdit{start: c.countStart, end: c.countEnd, text: strconv.Itoa(c.count + delta)}
+}
+
+// patch applies change followed by value, a serialized value or nothing.
+// The bytes change replaces hold removed values numbered from first; value
+// adds its own, and its references, which count from one, are moved past
+// first. References after the change are renumbered to match. header, if
+// not nil, updates the count of the enclosing container.
+func patch(data string, cfg *unmarshalConfig, path string, change pathEdit, value string, first, removed int, header *pathEdit) (string, error) {
+	edits := make([]pathEdit, 0, 2)
+	if header != nil {
+		edits = append(edits, *header)
+	}
+
+	added := 0
+	if value != "" {
+		sites, count, err := scanReferences(value, newUnmarshalConfig(nil), 0)
+		if err != nil {
+			return "", err
+		}
+		added = count
+		change.text += renumberReferences(value, sites, func(n int) int { return n + first })
+	}
+	edits = append(edits, change)
+
+	// References only point backwards, so only those after the change can
+	// point into it or past it
+	if strings.Contains(data[change.end:], "R:") || strings.Contains(data[change.end:], "r:") {
+		sites, _, err := scanReferences(data, cfg, change.end)
+		if err != nil {
+			return "", err
+		}
+		for _, site := range sites {
+			n := site.n
+			switch {
+			case n-1 < first:
+				continue
+			case n-1 == first && removed > 0 && added > 0:
+				// Still points to the value at path, now the new one
+				continue
+			case n-1 < first+removed:
+				return "", fmt.Errorf("value at %s is referenced at position %d", path, site.start)
+			}
+			n += added - removed
+			edits = append(edits, pathEdit{start: site.start, end: site.end, text: fmt.Sprintf("%c:%d;", site.typeChar, n)})
+		}
+	}
+
+	sort.Slice(edits, func(i, j int) bool { return edits[i].start < edits[j].start })
+	var out strings.Builder
+	out.Grow(len(data) + len(change.text))
+	pos := 0
+	for _, e := range edits {
+		out.WriteString(data[pos:e.start])
+		out.WriteString(e.text)
+		pos = e.end
+	}
+	out.WriteString(data[pos:])
+	return out.String(), nil
+}
+
+// scanReferences checks the value in data and returns the number of values
+// it holds and the references that start at or after offset from
+func scanReferences(data string, cfg *unmarshalConfig, from int) ([]refSite, int, error) {
+	s := &pathScanner{r: &stringReader{data: data, pos: 0}, cfg: cfg, collect: true, collectFrom: from}
+	if err := s.skip(0); err != nil {
+		return nil, 0, cfg.finishError(err, len(data))
+	}
+	return s.sites, s.count, nil
+}
+
+// renumberReferences rewrites the references found at sites in text with the
+// numbers renumber returns
+func renumberReferences(text string, sites []refSite, renumber func(int) int) string {
+	if len(sites) == 0 {
+		return text
+	}
+	var out strings.Builder
+	pos := 0
+	for _, site := range sites {
+		out.WriteString(text[pos:site.start])
+		fmt.Fprintf(&out, "%c:%d;", site.typeChar, renumber(site.n))
+		pos = site.end
+	}
+	out.WriteString(text[pos:])
+	return out.String()
+}
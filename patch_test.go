@@ -0,0 +1,124 @@
+package phpserialize
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// TestSet tests replacing and adding values in place
+func TestSet(t *testing.T) {
+	tests := []struct {
+		name  string
+		data  string
+		path  string
+		value interface{}
+		want  string
+	}{
+		{"replace", `a:2:{s:1:"b";d:0.50;s:1:"a";i:1;}`, "a", "x", `a:2:{s:1:"b";d:0.50;s:1:"a";s:1:"x";}`},
+		{"replace nested", pathCart, "user.roles.1", "owner",
+			strings.Replace(pathCart, `s:6:"editor"`, `s:5:"owner"`, 1)},
+		{"keep visibility", pathCart, "user.roles", []string{},
+			strings.Replace(pathCart, `a:2:{i:0;s:5:"admin";i:1;s:6:"editor";}`, `a:0:{}`, 1)},
+		{"append to array", `a:1:{i:0;b:1;}`, "1", nil, `a:2:{i:0;b:1;i:1;N;}`},
+		{"append string key", `a:0:{}`, "k", int64(2), `a:1:{s:1:"k";i:2;}`},
+		{"append property", `O:1:"A":1:{s:1:"x";i:1;}`, "y", true, `O:1:"A":2:{s:1:"x";i:1;s:1:"y";b:1;}`},
+		{"numeric property", `O:1:"A":0:{}`, "0", true, `O:1:"A":1:{s:1:"0";b:1;}`},
+		{"escaped dot", `a:0:{}`, `a\.b`, int64(1), `a:1:{s:3:"a.b";i:1;}`},
+		{"whole value", `i:1;`, "", int64(2), `i:2;`},
+		{"through reference", `a:2:{i:0;a:1:{i:0;i:1;}i:1;R:2;}`, "1.0", int64(5), `a:2:{i:0;a:1:{i:0;i:5;}i:1;R:2;}`},
+		{"replace reference", `a:2:{i:0;a:0:{}i:1;R:2;}`, "1", int64(5), `a:2:{i:0;a:0:{}i:1;i:5;}`},
+		{"renumber after growth", `a:3:{i:0;s:1:"x";i:1;i:2;i:2;R:3;}`, "0", []int{7, 8}, `a:3:{i:0;a:2:{i:0;i:7;i:1;i:8;}i:1;i:2;i:2;R:5;}`},
+		{"reference to replaced value", `a:2:{i:0;i:1;i:1;R:2;}`, "0", int64(9), `a:2:{i:0;i:9;i:1;R:2;}`},
+		{"renumber after append", `a:2:{i:0;a:0:{}i:1;R:2;}`, "0.x", "v", `a:2:{i:0;a:1:{s:1:"x";s:1:"v";}i:1;R:2;}`},
+		{"renumber past append", `a:3:{i:0;a:0:{}i:1;i:3;i:2;R:3;}`, "0.x", "v", `a:3:{i:0;a:1:{s:1:"x";s:1:"v";}i:1;i:3;i:2;R:4;}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Set(tt.data, tt.path, tt.value)
+			if err != nil {
+				t.Fatalf("Set failed: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Expected %s, got %s", tt.want, got)
+			}
+			if _, err := Unmarshal(got); err != nil {
+				t.Errorf("Result does not decode: %v", err)
+			}
+		})
+	}
+}
+
+// TestSetNewValueReferences tests that references inside the new value are
+// moved to its place in the data
+func TestSetNewValueReferences(t *testing.T) {
+	shared := PHPObject{ClassName: "A", Properties: map[string]interface{}{}}
+	got, err := Set(`a:2:{i:0;i:1;i:1;i:2;}`, "1", []interface{}{shared, shared})
+	if err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	want := `a:2:{i:0;i:1;i:1;a:2:{i:0;O:1:"A":0:{}i:1;r:4;}}`
+	if got != want {
+		t.Errorf("Expected %s, got %s", want, got)
+	}
+}
+
+// TestDelete tests removing entries in place
+func TestDelete(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		path string
+		want string
+	}{
+		{"array entry", `a:3:{i:0;s:1:"a";i:1;s:1:"b";i:2;s:1:"c";}`, "1", `a:2:{i:0;s:1:"a";i:2;s:1:"c";}`},
+		{"last entry", `a:1:{s:1:"k";a:1:{i:0;N;}}`, "k", `a:0:{}`},
+		{"protected property", pathCart, "user.roles",
+			strings.Replace(strings.Replace(pathCart, `s:8:"`+"\x00*\x00roles"+`";a:2:{i:0;s:5:"admin";i:1;s:6:"editor";}`, "", 1), `"User":2:`, `"User":1:`, 1)},
+		{"renumber", `a:3:{i:0;s:1:"x";i:1;a:1:{i:0;i:1;}i:2;R:4;}`, "0", `a:2:{i:1;a:1:{i:0;i:1;}i:2;R:3;}`},
+		{"reference entry", `a:2:{i:0;i:1;i:1;R:2;}`, "1", `a:1:{i:0;i:1;}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Delete(tt.data, tt.path)
+			if err != nil {
+				t.Fatalf("Delete failed: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Expected %q, got %q", tt.want, got)
+			}
+			if _, err := Unmarshal(got); err != nil {
+				t.Errorf("Result does not decode: %v", err)
+			}
+		})
+	}
+}
+
+// TestPatchErrors tests paths that cannot be changed
+func TestPatchErrors(t *testing.T) {
+	referenced := `a:3:{i:0;s:1:"x";i:1;a:1:{i:0;i:1;}i:2;R:4;}`
+	if _, err := Delete(referenced, "1"); err == nil || !strings.Contains(err.Error(), "referenced") {
+		t.Errorf("Expected error deleting a referenced value, got %v", err)
+	}
+	if _, err := Set(referenced, "1", int64(0)); err == nil || !strings.Contains(err.Error(), "referenced") {
+		t.Errorf("Expected error replacing a value holding a referenced one, got %v", err)
+	}
+	if _, err := Delete(referenced, "5"); !errors.Is(err, ErrPathNotFound) {
+		t.Errorf("Expected ErrPathNotFound, got %v", err)
+	}
+	if _, err := Set(referenced, "5.x", int64(0)); !errors.Is(err, ErrPathNotFound) {
+		t.Errorf("Expected ErrPathNotFound for a missing parent, got %v", err)
+	}
+	if _, err := Set(referenced, "0.x", int64(0)); !errors.Is(err, ErrPathNotFound) {
+		t.Errorf("Expected ErrPathNotFound below a string, got %v", err)
+	}
+	if _, err := Delete(referenced, ""); err == nil {
+		t.Error("Expected error deleting the whole value")
+	}
+	if _, err := Set(`a:1:{i:0;s:9:"x";}`, "1", int64(0)); err == nil {
+		t.Error("Expected error for corrupt data")
+	}
+	if _, err := Set(`a:0:{}`, "x", make(chan int)); !errors.Is(err, ErrUnsupportedType) {
+		t.Errorf("Expected ErrUnsupportedType, got %v", err)
+	}
+}
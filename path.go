@@ -0,0 +1,545 @@
+package phpserialize
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Get returns the value at path without decoding the rest of data. The path
+// lists array keys and property names separated by dots, e.g. "user.roles.0";
+// a backslash escapes a dot that is part of a key, and an empty path selects
+// the whole value. Properties are matched by name whatever their visibility,
+// like PHPObject.Get, and references are followed.
+//
+// Values before and around the target are only scanned: strings are jumped
+// over using their length prefix and nothing is allocated for them. The value
+// itself is decoded like Unmarshal would decode it with the same options.
+// A path that does not exist returns an error wrapping ErrPathNotFound.
+func Get(data, path string, options ...Option) (interface{}, error) {
+	cfg := newUnmarshalConfig(options)
+	if cfg.versionErr != nil {
+		return nil, cfg.versionErr
+	}
+	segments := splitPath(path)
+	s := &pathScanner{r: &stringReader{data: data, pos: 0}, cfg: cfg}
+	loc, err := s.locate(segments, true)
+	if err != nil {
+		return nil, cfg.finishError(err, len(data))
+	}
+
+	if s.outside {
+		// The value refers to values outside of it, which only a full decode
+		// can supply
+		value, err := Unmarshal(data, options...)
+		if err != nil {
+			return nil, err
+		}
+		return lookupPath(value, segments)
+	}
+
+	r := &stringReader{data: data, pos: loc.start}
+	if s.refs {
+		// Its references count slots from the start of data; the slots
+		// before the value stay empty as nothing refers to them
+		r.vars = make([]interface{}, loc.slot)
+	}
+	value, err := unmarshalValue(r, cfg, len(segments))
+	if err != nil {
+		return nil, cfg.finishError(err, len(data))
+	}
+	return value, nil
+}
+
+// GetRaw returns the serialized bytes of the value at path, as a slice of
+// data. References inside the returned value keep the numbers they have in
+// data, so a value holding R: or r: may not decode on its own.
+func GetRaw(data, path string, options ...Option) (string, error) {
+	cfg := newUnmarshalConfig(options)
+	if cfg.versionErr != nil {
+		return "", cfg.versionErr
+	}
+	s := &pathScanner{r: &stringReader{data: data, pos: 0}, cfg: cfg}
+	loc, err := s.locate(splitPath(path), true)
+	if err != nil {
+		return "", cfg.finishError(err, len(data))
+	}
+	return data[loc.start:loc.end], nil
+}
+
+// splitPath splits a dotted path into keys, honoring backslash escapes
+func splitPath(path string) []string {
+	if path == "" {
+		return nil
+	}
+	var segments []string
+	var seg strings.Builder
+	for i := 0; i < len(path); i++ {
+		switch c := path[i]; {
+		case c == '\\' && i+1 < len(path):
+			i++
+			seg.WriteByte(path[i])
+		case c == '.':
+			segments = append(segments, seg.String())
+			seg.Reset()
+		default:
+			seg.WriteByte(c)
+		}
+	}
+	return append(segments, seg.String())
+}
+
+var pathEscaper = strings.NewReplacer(`\`, `\\`, `.`, `\.`)
+
+// joinSegments is the inverse of splitPath
+func joinSegments(segments []string) string {
+	escaped := make([]string, len(segments))
+	for i, seg := range segments {
+		escaped[i] = pathEscaper.Replace(seg)
+	}
+	return strings.Join(escaped, ".")
+}
+
+// pathNotFound reports that the first n segments of a path lead nowhere
+func pathNotFound(segments []string, n int) error {
+	return fmt.Errorf("%w: %s", ErrPathNotFound, joinSegments(segments[:n]))
+}
+
+// lookupPath follows segments through a decoded value
+func lookupPath(value interface{}, segments []string) (interface{}, error) {
+	for i, seg := range segments {
+		var ok bool
+		switch v := value.(type) {
+		case PHPArray:
+			value, ok = v.Get(seg)
+		case PHPObject:
+			value, ok = v.Get(seg)
+		case map[string]interface{}:
+			value, ok = v[seg]
+		case []interface{}:
+			n, err := strconv.Atoi(seg)
+			if ok = err == nil && n >= 0 && n < len(v) && strconv.Itoa(n) == seg; ok {
+				value = v[n]
+			}
+		}
+		if !ok {
+			return nil, pathNotFound(segments, i+1)
+		}
+	}
+	return value, nil
+}
+
+// pathLocation is where the value at a path sits in the data
+type pathLocation struct {
+	start, end int // offsets of the value
+	slot       int // number of values before it, which PHP's var_hash counts
+	slots      int // number of values it holds, itself included
+}
+
+// pathContainer describes the array or object enter looked into last
+type pathContainer struct {
+	object               bool
+	count                int // number of entries
+	countStart, countEnd int // offsets of the count digits
+	keyStart             int // start of the matching entry
+	close                int // offset of the closing brace when no entry matched, else -1
+}
+
+// refSite is an r: or R: value found by a collecting scan
+type refSite struct {
+	start, end int
+	typeChar   byte
+	n          int
+}
+
+// pathScanner walks serialized data without decoding it. Values are numbered
+// like PHP's var_hash numbers them, so that references can be followed.
+type pathScanner struct {
+	r     *stringReader
+	cfg   *unmarshalConfig
+	count int // values numbered so far
+	seek  int // slot find is looking for, or 0
+
+	floor   int  // first slot of the value being measured by locate
+	refs    bool // that value holds references
+	outside bool // one of them points below floor
+
+	container pathContainer // set by enter
+	absent    bool          // locate failed only because the last key is missing
+
+	collect     bool // record the references starting at collectFrom in sites
+	collectFrom int
+	sites       []refSite
+}
+
+// errSlotFound stops the scan of find at the value it is looking for
+var errSlotFound = errors.New("slot found")
+
+// locate finds the value at the path given by segments. A reference found
+// there is followed when followLast is set, and returned as is otherwise.
+func (s *pathScanner) locate(segments []string, followLast bool) (pathLocation, error) {
+	for i, seg := range segments {
+		if err := s.follow(); err != nil {
+			return pathLocation{}, err
+		}
+		found, err := s.enter(seg, i)
+		if err != nil {
+			return pathLocation{}, syntaxPath(err, joinSegments(segments[:i]))
+		}
+		if !found {
+			s.absent = i == len(segments)-1 && s.container.close >= 0
+			return pathLocation{}, pathNotFound(segments, i+1)
+		}
+	}
+	if followLast {
+		if err := s.follow(); err != nil {
+			return pathLocation{}, err
+		}
+	}
+
+	loc := pathLocation{start: s.r.pos, slot: s.count}
+	s.floor, s.refs, s.outside = loc.slot, false, false
+	if err := s.skip(len(segments)); err != nil {
+		return pathLocation{}, syntaxPath(err, joinSegments(segments))
+	}
+	loc.end, loc.slots = s.r.pos, s.count-loc.slot
+	return loc, nil
+}
+
+// follow moves to the value a reference at the current position points to
+func (s *pathScanner) follow() error {
+	for {
+		start := s.r.pos
+		typeChar, err := s.r.peek()
+		if err != nil {
+			return err
+		}
+		if typeChar != 'r' && typeChar != 'R' {
+			return nil
+		}
+		n, err := s.reference()
+		if err != nil {
+			markValueStart(err, start)
+			return err
+		}
+		if err := s.find(n); err != nil {
+			return err
+		}
+	}
+}
+
+// find moves to the value in slot n by scanning the data again from the
+// start, which is cheaper than remembering where every value starts
+func (s *pathScanner) find(n int) error {
+	s.r.pos, s.count, s.seek = 0, 0, n
+	err := s.skip(0)
+	s.seek = 0
+	if err != errSlotFound {
+		return err
+	}
+	// Scanning resumes at the value, which numbers it again
+	s.count = n - 1
+	return nil
+}
+
+// number gives the value starting at offset start the next slot
+func (s *pathScanner) number(start int) error {
+	s.count++
+	if s.count == s.seek {
+		s.r.pos = start
+		return errSlotFound
+	}
+	return nil
+}
+
+// reference reads an r: or R: value and returns the slot it points to. Like
+// in PHP, r: takes a slot of its own and R: does not.
+func (s *pathScanner) reference() (int, error) {
+	start := s.r.pos
+	typeChar, _ := s.r.read()
+	colon, err := s.r.read()
+	if err != nil {
+		return 0, err
+	}
+	if colon != ':' {
+		return 0, expectError(s.r.pos-1, "':'", fmt.Sprintf("after type '%c'", typeChar), colon)
+	}
+	token, err := s.r.readUntil(';')
+	if err != nil {
+		return 0, err
+	}
+	n, err := strconv.Atoi(token)
+	if err != nil {
+		return 0, invalidError(s.r.pos, "reference", token)
+	}
+	if n < 1 || n > s.count {
+		return 0, syntaxError(s.r.pos, "reference %d out of range", n)
+	}
+	if typeChar == 'r' {
+		return n, s.number(start)
+	}
+	return n, nil
+}
+
+// enter reads the header of the array or object at the current position and
+// moves to the value of its entry named seg, reporting false when there is
+// no such entry or the value is neither an array nor an object
+func (s *pathScanner) enter(seg string, depth int) (bool, error) {
+	if s.cfg.maxDepth > 0 && depth >= s.cfg.maxDepth {
+		return false, maxDepthError(s.r.pos, s.cfg.maxDepth)
+	}
+	s.container = pathContainer{close: -1}
+	typeChar, err := s.r.peek()
+	if err != nil || (typeChar != 'a' && typeChar != 'O') {
+		return false, err
+	}
+	s.r.pos++
+	colon, err := s.r.read()
+	if err != nil {
+		return false, err
+	}
+	if colon != ':' {
+		return false, expectError(s.r.pos-1, "':'", fmt.Sprintf("after type '%c'", typeChar), colon)
+	}
+	s.count++
+
+	if typeChar == 'a' {
+		want, _ := normalizeArrayKey(seg)
+		wantInt, isInt := want.(int64)
+		count, err := s.readCount("array count", "array")
+		if err != nil {
+			return false, err
+		}
+		for i := 0; i < count; i++ {
+			keyStart := s.r.pos
+			n, str, keyIsInt, err := scanKey(s.r)
+			if err != nil {
+				return false, err
+			}
+			if keyIsInt == isInt && (isInt && n == wantInt || !isInt && str == seg) {
+				s.container.keyStart = keyStart
+				return true, nil
+			}
+			if err := s.skip(depth + 1); err != nil {
+				if keyIsInt {
+					return false, prependPath(err, n)
+				}
+				return false, prependPath(err, str)
+			}
+		}
+		return false, s.closeContainer("array")
+	}
+
+	className, err := readClassName(s.r, s.cfg, typeChar)
+	if err != nil {
+		return false, err
+	}
+	s.container.object = true
+	count, err := s.readCount("property count", "object properties")
+	if err != nil {
+		return false, err
+	}
+	// Pick the property PHPObject.Get would pick when several share the name
+	best, bestRank, bestCount, bestKey := -1, 0, 0, 0
+	for i := 0; i < count; i++ {
+		keyStart := s.r.pos
+		n, name, isInt, err := scanKey(s.r)
+		if err != nil {
+			return false, err
+		}
+		if isInt {
+			name = strconv.FormatInt(n, 10)
+		}
+		if rank := propertyRank(name, seg, className); rank == 0 {
+			s.container.keyStart = keyStart
+			return true, nil
+		} else if rank > 0 && (best < 0 || rank < bestRank) {
+			best, bestRank, bestCount, bestKey = s.r.pos, rank, s.count, keyStart
+		}
+		if err := s.skip(depth + 1); err != nil {
+			return false, prependPath(err, bareName(name))
+		}
+	}
+	if err := s.closeContainer("object"); err != nil || best < 0 {
+		return false, err
+	}
+	s.r.pos, s.count = best, bestCount
+	s.container.keyStart, s.container.close = bestKey, -1
+	return true, nil
+}
+
+// readCount reads the count of the container being entered and records it
+func (s *pathScanner) readCount(countName, body string) (int, error) {
+	s.container.countStart = s.r.pos
+	count, err := readCount(s.r, countName, body)
+	// readCount stops after the ":{" that follows the digits
+	s.container.count, s.container.countEnd = count, s.r.pos-2
+	return count, err
+}
+
+// closeContainer reads the closing brace of the container being entered
+func (s *pathScanner) closeContainer(body string) error {
+	if err := s.close(body); err != nil {
+		return err
+	}
+	s.container.close = s.r.pos - 1
+	return nil
+}
+
+// propertyRank tells how well a serialized property name matches a bare
+// name: 0 for a public property, 1 for a protected one, 2 for a private one
+// of the object's own class, 3 for any other private one and -1 for none
+func propertyRank(mangled, name, className string) int {
+	bare, visibility, class := ParsePropertyName(mangled)
+	switch {
+	case bare != name:
+		return -1
+	case visibility == Public:
+		return 0
+	case visibility == Protected:
+		return 1
+	case class == className:
+		return 2
+	}
+	return 3
+}
+
+// close reads the closing brace of an array or object
+func (s *pathScanner) close(body string) error {
+	brace, err := s.r.read()
+	if err != nil {
+		return err
+	}
+	if brace != '}' {
+		return expectError(s.r.pos-1, "'}'", "for "+body, brace)
+	}
+	return nil
+}
+
+// skip moves past the value at the current position, checking its syntax
+func (s *pathScanner) skip(depth int) (err error) {
+	if s.cfg.maxDepth > 0 && depth >= s.cfg.maxDepth {
+		return maxDepthError(s.r.pos, s.cfg.maxDepth)
+	}
+
+	start := s.r.pos
+	defer func() {
+		if err != nil {
+			markValueStart(err, start)
+		}
+	}()
+
+	typeChar, err := s.r.peek()
+	if err != nil {
+		return err
+	}
+	if typeChar == 'r' || typeChar == 'R' {
+		n, err := s.reference()
+		if err != nil {
+			return err
+		}
+		s.refs = true
+		if n-1 < s.floor {
+			s.outside = true
+		}
+		if s.collect && start >= s.collectFrom {
+			s.sites = append(s.sites, refSite{start: start, end: s.r.pos, typeChar: typeChar, n: n})
+		}
+		return nil
+	}
+	s.r.pos++
+	if !strings.ContainsRune("NbidsaOCE", rune(typeChar)) {
+		return unknownTypeError(start, typeChar)
+	}
+	if err := s.number(start); err != nil {
+		return err
+	}
+
+	if typeChar == 'N' {
+		semicolon, err := s.r.read()
+		if err != nil {
+			return err
+		}
+		if semicolon != ';' {
+			return expectError(s.r.pos-1, "';'", "after NULL", semicolon)
+		}
+		return nil
+	}
+	colon, err := s.r.read()
+	if err != nil {
+		return err
+	}
+	if colon != ':' {
+		return expectError(s.r.pos-1, "':'", fmt.Sprintf("after type '%c'", typeChar), colon)
+	}
+
+	switch typeChar {
+	case 'b', 'i', 'd':
+		token, err := s.r.readUntil(';')
+		if err != nil {
+			return err
+		}
+		if !validScalar(typeChar, token) {
+			return invalidError(s.r.pos, "value", token)
+		}
+		return nil
+
+	case 's':
+		_, err := readQuoted(s.r, "string", ';')
+		return err
+
+	case 'a':
+		count, err := readCount(s.r, "array count", "array")
+		if err != nil {
+			return err
+		}
+		return s.entries(depth, count, "array", false)
+
+	case 'O':
+		if _, err := readClassName(s.r, s.cfg, typeChar); err != nil {
+			return err
+		}
+		count, err := readCount(s.r, "property count", "object properties")
+		if err != nil {
+			return err
+		}
+		return s.entries(depth, count, "object", true)
+
+	case 'C':
+		if _, err := readClassName(s.r, s.cfg, typeChar); err != nil {
+			return err
+		}
+		_, err := readPayload(s.r)
+		return err
+
+	default: // 'E'
+		name, err := readQuoted(s.r, "enum name", ';')
+		if err != nil {
+			return err
+		}
+		className, _, _ := strings.Cut(name, ":")
+		return s.cfg.versionError(start, typeChar, className)
+	}
+}
+
+// entries moves past the key/value pairs of an array or object and its
+// closing brace
+func (s *pathScanner) entries(depth, count int, body string, object bool) error {
+	for i := 0; i < count; i++ {
+		n, str, isInt, err := scanKey(s.r)
+		if err != nil {
+			return err
+		}
+		if err := s.skip(depth + 1); err != nil {
+			switch {
+			case isInt:
+				return prependPath(err, n)
+			case object:
+				return prependPath(err, bareName(str))
+			}
+			return prependPath(err, str)
+		}
+	}
+	return s.close(body)
+}
@@ -0,0 +1,170 @@
+package phpserialize
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const pathCart = `a:2:{s:4:"user";O:4:"User":2:{s:4:"name";s:3:"Ann";s:8:"` + "\x00*\x00roles" + `";a:2:{i:0;s:5:"admin";i:1;s:6:"editor";}}s:5:"items";a:1:{s:11:"example.com";d:9.5;}}`
+
+// TestGet tests looking up values by path
+func TestGet(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		path string
+		want interface{}
+	}{
+		{"root", `i:5;`, "", int64(5)},
+		{"nested", pathCart, "user.roles.0", "admin"},
+		{"protected property", pathCart, "user.roles", []interface{}{"admin", "editor"}},
+		{"escaped dot", pathCart, `items.example\.com`, 9.5},
+		{"null value", `a:1:{s:1:"a";N;}`, "a", nil},
+		{"string key", `a:2:{i:7;b:1;s:1:"7";b:0;}`, "7", true},
+		{"reference", `a:2:{i:0;a:1:{s:1:"x";i:5;}i:1;R:2;}`, "1.x", int64(5)},
+		{"object reference", `a:2:{i:0;O:1:"A":1:{s:1:"n";s:1:"v";}i:1;r:2;}`, "1.n", "v"},
+		{"reference to object reference", `a:3:{i:0;O:1:"A":1:{s:1:"n";i:1;}i:1;r:2;i:2;R:4;}`, "2.n", int64(1)},
+		{"reference target", `a:2:{i:0;s:1:"x";i:1;R:2;}`, "1", "x"},
+		{"reference outside", `a:2:{i:0;s:1:"x";i:1;a:1:{i:0;R:2;}}`, "1", []interface{}{"x"}},
+		{"public before private", "O:1:\"B\":2:{s:4:\"\x00A\x00n\";i:1;s:1:\"n\";i:2;}", "n", int64(2)},
+		{"protected before private", "O:1:\"B\":2:{s:4:\"\x00A\x00n\";i:1;s:4:\"\x00*\x00n\";i:2;}", "n", int64(2)},
+		{"own private first", "O:1:\"B\":2:{s:4:\"\x00A\x00n\";i:1;s:4:\"\x00B\x00n\";i:2;}", "n", int64(2)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Get(tt.data, tt.path)
+			if err != nil {
+				t.Fatalf("Get failed: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Expected %#v, got %#v", tt.want, got)
+			}
+		})
+	}
+}
+
+// TestGetRaw tests returning the serialized bytes of a value
+func TestGetRaw(t *testing.T) {
+	tests := []struct {
+		data string
+		path string
+		want string
+	}{
+		{pathCart, "user.roles", `a:2:{i:0;s:5:"admin";i:1;s:6:"editor";}`},
+		{pathCart, "user.name", `s:3:"Ann";`},
+		{pathCart, "", pathCart},
+		{`a:2:{i:0;O:1:"A":0:{}i:1;r:2;}`, "1", `O:1:"A":0:{}`},
+	}
+	for _, tt := range tests {
+		got, err := GetRaw(tt.data, tt.path)
+		if err != nil {
+			t.Errorf("GetRaw(%q) failed: %v", tt.path, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Expected %s, got %s", tt.want, got)
+		}
+	}
+}
+
+// TestGetErrors tests missing paths and corrupt data
+func TestGetErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     string
+		path     string
+		notFound bool
+		msg      string
+	}{
+		{"missing key", pathCart, "user.email", true, "path not found: user.email"},
+		{"index past end", pathCart, "user.roles.2", true, "path not found: user.roles.2"},
+		{"into scalar", pathCart, "user.name.x", true, "path not found: user.name.x"},
+		{"escaped in message", pathCart, `items.example\.org`, true, `path not found: items.example\.org`},
+		{"corrupt skipped value", `a:2:{i:0;s:9:"ab";i:1;i:2;}`, "1", false, `path "0"`},
+		{"corrupt target", `a:1:{i:0;a:1:{i:0;i:x;}}`, "0", false, `path "0.0"`},
+		{"bad reference", `a:1:{i:0;R:9;}`, "0.a", false, "reference 9 out of range"},
+		{"unknown type", `a:1:{i:0;X:1;}`, "1", false, "unknown type"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Get(tt.data, tt.path)
+			if err == nil {
+				t.Fatal("Expected error, got nil")
+			}
+			if errors.Is(err, ErrPathNotFound) != tt.notFound {
+				t.Errorf("Expected ErrPathNotFound to be %v, got %v", tt.notFound, err)
+			}
+			var se *SyntaxError
+			if !tt.notFound && !errors.As(err, &se) {
+				t.Errorf("Expected *SyntaxError, got %T", err)
+			}
+			if !strings.Contains(err.Error(), tt.msg) {
+				t.Errorf("Expected error containing %q, got %v", tt.msg, err)
+			}
+		})
+	}
+
+	deep := strings.Repeat("a:1:{i:0;", 5) + "i:1;" + strings.Repeat("}", 5)
+	if _, err := Get(deep, "0.0.0.0", WithMaxDepth(3)); !errors.Is(err, ErrMaxDepth) {
+		t.Errorf("Expected ErrMaxDepth, got %v", err)
+	}
+}
+
+// TestGetMatchesUnmarshal tests that Get decodes values like Unmarshal
+func TestGetMatchesUnmarshal(t *testing.T) {
+	data := `a:1:{s:1:"a";a:2:{i:1;s:1:"x";s:1:"k";O:8:"stdClass":1:{s:1:"p";b:1;}}}`
+	for _, options := range [][]Option{nil, {WithOrderedArrays(true)}} {
+		whole, err := Unmarshal(data, options...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want, err := lookupPath(whole, []string{"a"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := Get(data, "a", options...)
+		if err != nil {
+			t.Fatalf("Get failed: %v", err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("Expected %#v, got %#v", want, got)
+		}
+	}
+}
+
+// largeCart returns a cart with many items before its total
+func largeCart(items int) string {
+	list := make(PHPArray, 0, items)
+	for i := 0; i < items; i++ {
+		list = append(list, PHPArrayEntry{Key: int64(i), Value: PHPArray{
+			{Key: "sku", Value: strings.Repeat("x", 100)},
+			{Key: "qty", Value: int64(i)},
+		}})
+	}
+	return MustMarshal(PHPArray{{Key: "items", Value: list}, {Key: "total", Value: 9.5}})
+}
+
+// TestGetSkipsWithoutAllocating tests that skipped values are not decoded
+func TestGetSkipsWithoutAllocating(t *testing.T) {
+	data := largeCart(1000)
+	allocs := testing.AllocsPerRun(10, func() {
+		if _, err := Get(data, "total"); err != nil {
+			t.Fatal(err)
+		}
+	})
+	if allocs > 20 {
+		t.Errorf("Expected a few allocations, got %v", allocs)
+	}
+}
+
+func BenchmarkGet(b *testing.B) {
+	data := largeCart(10000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := Get(data, "total"); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
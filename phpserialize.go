@@ -1,10 +1,12 @@
 // Package phpserialize provides PHP-compatible serialize and un-serialize functions for Go.
-// It supports all PHP data types and maintains compatibility with PHP 4, 5, 7, and 8.
+// It supports all PHP data types and the serialize format of PHP 4 through 8;
+// WithPHPVersion targets the format of one version.
 package phpserialize
 
 import (
 	"bytes"
 	"fmt"
+	"io"
 	"math"
 	"reflect"
 	"strconv"
@@ -12,21 +14,115 @@ import (
 	"unicode/utf8"
 )
 
-// PHPObject represents a PHP object in Go
+// PHPObject represents a PHP object in Go.
+// Properties are keyed by the names PHP serializes, so protected and private
+// properties keep their mangled form (see PropertyName); use Get to read a
+// property by its bare name.
 type PHPObject struct {
 	ClassName  string
 	Properties map[string]interface{}
+	// Order optionally lists property names in serialization order. Unmarshal fills it
+	// with the order found in the data; Marshal writes listed properties first.
+	Order []string
 }
 
+// PHPCustomObject represents an object of a class implementing PHP's Serializable
+// interface, serialized as C:<len>:"<class>":<len>:{<payload>}
+type PHPCustomObject struct {
+	ClassName string
+	// Data is the raw payload returned by Serializable::serialize(); Marshal writes it back byte-for-byte
+	Data string
+	// Value holds the payload decoded by a WithCustomDecoder hook, nil otherwise
+	Value interface{}
+}
+
+// PHPEnum represents a PHP 8.1+ enum case, serialized as E:<len>:"<class>:<case>";
+type PHPEnum struct {
+	ClassName string
+	Case      string
+}
+
+// Marshaler is implemented by types that produce their own PHP serialized form.
+// MarshalPHP must return exactly one complete serialized value, e.g. `s:3:"EUR";`.
+type Marshaler interface {
+	MarshalPHP() ([]byte, error)
+}
+
+// Unmarshaler is implemented by types that decode their own PHP serialized form.
+// UnmarshalPHP receives the raw bytes of one complete serialized value.
+type Unmarshaler interface {
+	UnmarshalPHP([]byte) error
+}
+
+// CustomDecoder decodes the payload of a PHPCustomObject of a known class
+type CustomDecoder func(data string) (interface{}, error)
+
 type marshalConfig struct {
 	phpStrict bool
 	maxDepth  int
+
+	// Per-call reference tracking, mirroring PHP's serialize var_hash
+	slot int            // number of value slots written so far
+	seen map[refKey]int // slot number of every shared pointer/map/slice already written
+
+	enums      map[reflect.Type]marshalEnum // Go enum types registered with WithEnum
+	keyOrder   KeyOrder
+	version    phpVersion // PHP version targeted with WithPHPVersion, or 0
+	versionErr error      // invalid version given to WithPHPVersion, returned by every call
+
+	out    io.Writer // set by an Encoder, which receives output as it is produced
+	outErr error     // first error returned by out
+}
+
+// flush hands buffered output to the Encoder's writer once enough has accumulated
+func (cfg *marshalConfig) flush(buf *bytes.Buffer) error {
+	if cfg.outErr != nil {
+		return cfg.outErr
+	}
+	if cfg.out == nil || buf.Len() < streamChunkSize {
+		return nil
+	}
+	if _, err := cfg.out.Write(buf.Bytes()); err != nil {
+		cfg.outErr = err
+		return err
+	}
+	buf.Reset()
+	return nil
+}
+
+// marshalEnum maps the values of a registered Go type to PHP enum cases
+type marshalEnum struct {
+	className string
+	cases     map[interface{}]string
+}
+
+// refKey identifies a Go value that PHP would treat as the same zval
+type refKey struct {
+	ptr    uintptr
+	typ    reflect.Type
+	length int
 }
 
 type unmarshalConfig struct {
 	allowedClasses map[string]bool
 	allowAll       bool
 	maxDepth       int
+	customDecoders map[string]CustomDecoder
+	enums          map[string]map[string]interface{} // class -> case -> Go value, from WithEnum
+	orderedArrays  bool
+	zeroCopy       bool       // strings from UnmarshalBytes alias the input, from WithZeroCopy
+	phpErrors      bool       // render SyntaxError like PHP, from WithPHPErrors
+	version        phpVersion // PHP version targeted with WithPHPVersion, or 0
+	versionErr     error      // invalid version given to WithPHPVersion, returned by every call
+
+	replaceKeys       bool     // ReplaceStrings rewrites keys too, from WithReplaceKeys
+	replaceClassNames bool     // ReplaceStrings rewrites class names too, from WithReplaceClassNames
+	jsonFlags         JSONFlag // json_encode flags for ToJSON, from WithJSONFlags
+}
+
+// isClassAllowed reports whether objects of the class may be un-serialized
+func (cfg *unmarshalConfig) isClassAllowed(className string) bool {
+	return cfg.allowAll || cfg.allowedClasses[className]
 }
 
 // Option allows customization of serialize/un-serialize behavior
@@ -89,6 +185,61 @@ func (o allowedClassesOption) applyUnmarshal(cfg *unmarshalConfig) {
 	cfg.allowedClasses = allowed
 }
 
+// customDecoderOption implements Option for decoding C: payloads
+type customDecoderOption struct {
+	className string
+	decode    CustomDecoder
+}
+
+func (o customDecoderOption) applyMarshal(*marshalConfig) {
+	// No effect on marshal
+}
+
+func (o customDecoderOption) applyUnmarshal(cfg *unmarshalConfig) {
+	if cfg.customDecoders == nil {
+		cfg.customDecoders = make(map[string]CustomDecoder)
+	}
+	cfg.customDecoders[o.className] = o.decode
+}
+
+// enumOption implements Option for mapping PHP enum cases to Go values
+type enumOption struct {
+	className string
+	typ       reflect.Type
+	cases     map[string]interface{}
+}
+
+func (o enumOption) applyMarshal(cfg *marshalConfig) {
+	if cfg.enums == nil {
+		cfg.enums = make(map[reflect.Type]marshalEnum)
+	}
+	reverse := make(map[interface{}]string, len(o.cases))
+	for name, value := range o.cases {
+		reverse[value] = name
+	}
+	cfg.enums[o.typ] = marshalEnum{className: o.className, cases: reverse}
+}
+
+func (o enumOption) applyUnmarshal(cfg *unmarshalConfig) {
+	if cfg.enums == nil {
+		cfg.enums = make(map[string]map[string]interface{})
+	}
+	cfg.enums[o.className] = o.cases
+}
+
+// orderedArraysOption implements Option for returning arrays as PHPArray
+type orderedArraysOption struct {
+	ordered bool
+}
+
+func (o orderedArraysOption) applyMarshal(*marshalConfig) {
+	// No effect on marshal, PHPArray is always written in order
+}
+
+func (o orderedArraysOption) applyUnmarshal(cfg *unmarshalConfig) {
+	cfg.orderedArrays = o.ordered
+}
+
 // WithMaxDepth limits nesting depth for both Marshal and Unmarshal
 // For Marshal: 0 = unlimited (default)
 // For Unmarshal: 0 will use PHP default of 4096
@@ -110,14 +261,39 @@ func WithAllowedClasses(classes []string) Option {
 	return allowedClassesOption{classes: classes}
 }
 
+// WithCustomDecoder registers a decoder for the payload of C: objects of the given class.
+// The decoded value is stored in PHPCustomObject.Value; Data is always kept intact.
+func WithCustomDecoder(className string, decode CustomDecoder) Option {
+	return customDecoderOption{className: className, decode: decode}
+}
+
+// WithEnum maps the cases of the PHP enum className to Go values of type T.
+// Unmarshal returns the Go value instead of a PHPEnum, and Marshal writes values of T as E: cases.
+//
+//	phpserialize.WithEnum("Suit", map[string]Suit{"Hearts": Hearts, "Spades": Spades})
+func WithEnum[T comparable](className string, cases map[string]T) Option {
+	generic := make(map[string]interface{}, len(cases))
+	for name, value := range cases {
+		generic[name] = value
+	}
+	return enumOption{
+		className: className,
+		typ:       reflect.TypeOf((*T)(nil)).Elem(),
+		cases:     generic,
+	}
+}
+
+// WithOrderedArrays makes Unmarshal return every PHP array as a PHPArray,
+// which keeps key order and integer vs string keys (default false)
+func WithOrderedArrays(ordered bool) Option {
+	return orderedArraysOption{ordered: ordered}
+}
+
 // Marshal converts a Go value to PHP serialized format
 func Marshal(value interface{}, options ...Option) (string, error) {
-	config := &marshalConfig{
-		phpStrict: true,
-		maxDepth:  0, // 0 = unlimited (PHP serialize has no max_depth)
-	}
-	for _, opt := range options {
-		opt.applyMarshal(config)
+	config := newMarshalConfig(options)
+	if config.versionErr != nil {
+		return "", config.versionErr
 	}
 
 	var buf bytes.Buffer
@@ -131,25 +307,34 @@ func Marshal(value interface{}, options ...Option) (string, error) {
 
 // MarshalObject serializes a PHPObject
 func MarshalObject(obj PHPObject, options ...Option) (string, error) {
+	return Marshal(obj, options...)
+}
+
+// newMarshalConfig returns the PHP defaults with options applied
+func newMarshalConfig(options []Option) *marshalConfig {
 	config := &marshalConfig{
 		phpStrict: true,
-		maxDepth:  0,
+		maxDepth:  0, // 0 = unlimited (PHP serialize has no max_depth)
 	}
 	for _, opt := range options {
 		opt.applyMarshal(config)
 	}
-
-	var buf bytes.Buffer
-	buf.Grow(256)
-	err := marshalObject(&buf, obj, config, 0)
-	if err != nil {
-		return "", err
-	}
-	return buf.String(), nil
+	return config
 }
 
 // Unmarshal converts PHP serialized data to Go values
 func Unmarshal(data string, options ...Option) (interface{}, error) {
+	config := newUnmarshalConfig(options)
+	if config.versionErr != nil {
+		return nil, config.versionErr
+	}
+	reader := &stringReader{data: data, pos: 0}
+	value, err := unmarshalValue(reader, config, 0)
+	return value, config.finishError(err, len(data))
+}
+
+// newUnmarshalConfig returns the PHP defaults with options applied
+func newUnmarshalConfig(options []Option) *unmarshalConfig {
 	config := &unmarshalConfig{
 		allowAll: true, // PHP default = all classes allowed
 		maxDepth: 4096, // PHP default max depth
@@ -157,78 +342,238 @@ func Unmarshal(data string, options ...Option) (interface{}, error) {
 	for _, opt := range options {
 		opt.applyUnmarshal(config)
 	}
-
-	reader := &stringReader{data: data, pos: 0}
-	return unmarshalValue(reader, config, 0)
+	return config
 }
 
-// stringReader helps to parse serialized data
+// stringReader helps to parse serialized data.
+// It reads from an in-memory string, or from an io.Reader through a sliding
+// window when used by a Decoder; positions are always absolute offsets.
 type stringReader struct {
 	data string
 	pos  int
+
+	// Streaming state: data aliases buf, which holds the input from offset
+	// base onwards
+	stream bool
+	src    io.Reader
+	buf    []byte
+	base   int
+	err    error // read error other than io.EOF
+
+	// vars holds every decoded value by PHP slot number (slot n is vars[n-1]),
+	// so that r:n; and R:n; can be resolved like PHP's var_hash does
+	vars []interface{}
+	// open marks arrays that are still being decoded; the flag is set once the
+	// array is referenced from inside itself, which forces it to stay a map
+	open map[int]bool
+}
+
+// streamChunkSize is the number of bytes a streaming reader requests at a time
+const streamChunkSize = 32 * 1024
+
+// maxTokenLength bounds numbers and lengths read up to a delimiter, so a
+// stream with a missing delimiter fails instead of being buffered whole
+const maxTokenLength = 1024
+
+// end returns the absolute offset just past the buffered data
+func (r *stringReader) end() int {
+	return r.base + len(r.data)
+}
+
+// more buffers another chunk from the stream, discarding data before offset keep.
+// It reports false when the stream is exhausted.
+func (r *stringReader) more(keep int) bool {
+	if r.src == nil || r.err != nil {
+		return false
+	}
+	if keep > r.base {
+		// Move the data still needed to the front of buf; data is only
+		// handed out through slice, which copies it, so nothing aliases buf
+		r.buf = r.buf[:copy(r.buf, r.buf[keep-r.base:])]
+		r.base = keep
+		r.data = bytesString(r.buf, true)
+	}
+	if cap(r.buf)-len(r.buf) < streamChunkSize {
+		grown := make([]byte, len(r.buf), max(2*cap(r.buf), len(r.buf)+streamChunkSize))
+		copy(grown, r.buf)
+		r.buf = grown
+	}
+
+	for {
+		n, err := r.src.Read(r.buf[len(r.buf):cap(r.buf)])
+		if n > 0 {
+			r.buf = r.buf[:len(r.buf)+n]
+			r.data = bytesString(r.buf, true)
+			return true
+		}
+		if err == io.EOF {
+			r.src = nil
+			return false
+		}
+		if err != nil {
+			r.err = err
+			return false
+		}
+	}
+}
+
+// eofError reports running out of data, or the underlying read error
+func (r *stringReader) eofError() error {
+	if r.err != nil {
+		return r.err
+	}
+	return unexpectedEOF(r.pos, "")
+}
+
+// slice returns the input between two absolute offsets that are still buffered.
+// Streams get a copy, as the window is overwritten by later reads.
+func (r *stringReader) slice(start, end int) string {
+	if r.stream {
+		return string(r.buf[start-r.base : end-r.base])
+	}
+	return r.data[start-r.base : end-r.base]
 }
 
 func (r *stringReader) read() (byte, error) {
-	if r.pos >= len(r.data) {
-		return 0, fmt.Errorf("unexpected end of data at position %d", r.pos)
+	if r.pos >= r.end() && !r.more(r.pos) {
+		return 0, r.eofError()
 	}
-	b := r.data[r.pos]
+	b := r.data[r.pos-r.base]
 	r.pos++
 	return b, nil
 }
 
 func (r *stringReader) peek() (byte, error) {
-	if r.pos >= len(r.data) {
-		return 0, fmt.Errorf("unexpected end of data at position %d", r.pos)
+	if r.pos >= r.end() && !r.more(r.pos) {
+		return 0, r.eofError()
 	}
-	return r.data[r.pos], nil
+	return r.data[r.pos-r.base], nil
 }
 
 func (r *stringReader) readUntil(delim byte) (string, error) {
 	start := r.pos
-	for r.pos < len(r.data) {
-		if r.data[r.pos] == delim {
-			result := r.data[start:r.pos]
-			r.pos++ // skip delimiter
-			return result, nil
+	for {
+		for r.pos < r.end() {
+			if r.pos-start >= maxTokenLength {
+				return "", tokenTooLongError(start, delim)
+			}
+			if r.data[r.pos-r.base] == delim {
+				result := r.slice(start, r.pos)
+				r.pos++ // skip delimiter
+				return result, nil
+			}
+			r.pos++
+		}
+		if !r.more(start) {
+			break
 		}
-		r.pos++
 	}
-	return "", fmt.Errorf("delimiter '%c' not found after position %d", delim, start)
+	if r.err != nil {
+		return "", r.err
+	}
+	return "", unexpectedEOF(r.end(), fmt.Sprintf("'%c'", delim))
 }
 
 func (r *stringReader) readBytes(n int) (string, error) {
-	if r.pos+n > len(r.data) {
-		return "", fmt.Errorf("not enough data at position %d: need %d bytes, have %d", r.pos, n, len(r.data)-r.pos)
+	if r.stream && n > r.end()-r.pos {
+		return r.readLarge(n)
+	}
+	if n > r.end()-r.pos {
+		return "", notEnoughDataError(r.pos, n, r.end()-r.pos)
 	}
-	result := r.data[r.pos : r.pos+n]
+	result := r.slice(r.pos, r.pos+n)
 	r.pos += n
 	return result, nil
 }
 
+// readLarge reads n bytes that extend past the stream window straight from the
+// stream, so long strings are not accumulated chunk by chunk
+func (r *stringReader) readLarge(n int) (string, error) {
+	buf := make([]byte, n)
+	have := copy(buf, r.data[r.pos-r.base:])
+	if r.src != nil && r.err == nil {
+		m, err := io.ReadFull(r.src, buf[have:])
+		have += m
+		switch err {
+		case nil:
+		case io.EOF, io.ErrUnexpectedEOF:
+			r.src = nil
+		default:
+			r.err = err
+			return "", err
+		}
+	}
+	if have < n {
+		return "", notEnoughDataError(r.pos, n, have)
+	}
+
+	r.pos += n
+	r.base, r.buf, r.data = r.pos, r.buf[:0], ""
+	return string(buf), nil
+}
+
 // marshalValue serializes any Go value
 func marshalValue(buf *bytes.Buffer, value interface{}, cfg *marshalConfig, depth int) error {
 	if cfg.maxDepth > 0 && depth >= cfg.maxDepth {
-		return fmt.Errorf("exceeded max depth %d", cfg.maxDepth)
+		return fmt.Errorf("%w %d", ErrMaxDepth, cfg.maxDepth)
+	}
+	if err := cfg.flush(buf); err != nil {
+		return err
 	}
 
 	if value == nil {
+		cfg.slot++
 		buf.WriteString("N;")
 		return nil
 	}
 
 	v := reflect.ValueOf(value)
 
-	// Check for circular references in pointers
-	if v.Kind() == reflect.Ptr || v.Kind() == reflect.Map || v.Kind() == reflect.Slice {
-		if v.Kind() == reflect.Ptr {
-			if v.IsNil() {
-				buf.WriteString("N;")
-				return nil
+	// Types implementing Marshaler write themselves
+	if m, ok := value.(Marshaler); ok && !(v.Kind() == reflect.Ptr && v.IsNil()) {
+		return marshalCustom(buf, m, v.Type(), cfg)
+	}
+
+	// A value seen before is written as a back-reference instead of a copy:
+	// objects use r:n; (object handle) and everything else R:n; (PHP reference).
+	// Only r: occupies a new slot, exactly like PHP's php_add_var_hash.
+	if key, isObject, ok := refKeyOf(v); ok {
+		if n, seen := cfg.seen[key]; seen {
+			if isObject {
+				cfg.slot++
+				buf.WriteString("r:" + strconv.Itoa(n) + ";")
+			} else {
+				buf.WriteString("R:" + strconv.Itoa(n) + ";")
 			}
-			// Dereference pointer
-			v = v.Elem()
+			return nil
+		}
+		if cfg.seen == nil {
+			cfg.seen = make(map[refKey]int)
 		}
+		cfg.seen[key] = cfg.slot + 1
+	}
+	cfg.slot++
+
+	// Dereference pointers and interfaces down to the concrete value
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			buf.WriteString("N;")
+			return nil
+		}
+		v = v.Elem()
+	}
+
+	// Values of a type registered with WithEnum are written as enum cases
+	if enum, ok := cfg.enums[v.Type()]; ok {
+		name, ok := enum.cases[v.Interface()]
+		if !ok {
+			return fmt.Errorf("value %v of type %s is not a case of enum %s", v.Interface(), v.Type(), enum.className)
+		}
+		return marshalEnumCase(buf, PHPEnum{ClassName: enum.className, Case: name}, cfg)
+	}
+
+	if arr, ok := v.Interface().(PHPArray); ok {
+		return marshalArray(buf, arr, cfg, depth)
 	}
 
 	switch v.Kind() {
@@ -244,7 +589,7 @@ func marshalValue(buf *bytes.Buffer, value interface{}, cfg *marshalConfig, dept
 
 	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
 		u := v.Uint()
-		if cfg.phpStrict {
+		if cfg.phpStrict || cfg.version != 0 {
 			if u > math.MaxInt64 {
 				return fmt.Errorf("uint %d exceeds PHP int range", u)
 			}
@@ -263,6 +608,8 @@ func marshalValue(buf *bytes.Buffer, value interface{}, cfg *marshalConfig, dept
 			buf.WriteString("d:INF;")
 		} else if math.IsInf(f, -1) {
 			buf.WriteString("d:-INF;")
+		} else if cfg.version != 0 {
+			buf.WriteString("d:" + formatPHPFloat(f, cfg.version.floatPrecision(), 'E') + ";")
 		} else {
 			buf.WriteString("d:" + strconv.FormatFloat(f, 'f', -1, 64) + ";")
 		}
@@ -291,6 +638,7 @@ func marshalValue(buf *bytes.Buffer, value interface{}, cfg *marshalConfig, dept
 		buf.WriteString(fmt.Sprintf("a:%d:{", length))
 
 		keys := v.MapKeys()
+		sortMapKeys(keys, cfg.keyOrder)
 
 		for _, key := range keys {
 			switch key.Kind() {
@@ -300,7 +648,7 @@ func marshalValue(buf *bytes.Buffer, value interface{}, cfg *marshalConfig, dept
 			case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
 				buf.WriteString(fmt.Sprintf("i:%d;", key.Int()))
 			default:
-				return fmt.Errorf("cannot serialize map with key type %v", key.Kind())
+				return fmt.Errorf("%w: cannot serialize map with key type %v", ErrUnsupportedType, key.Kind())
 			}
 
 			if err := marshalValue(buf, v.MapIndex(key).Interface(), cfg, depth+1); err != nil {
@@ -311,30 +659,136 @@ func marshalValue(buf *bytes.Buffer, value interface{}, cfg *marshalConfig, dept
 
 	case reflect.Struct:
 		// Check if it's a PHPObject
-		if obj, ok := value.(PHPObject); ok {
+		if obj, ok := v.Interface().(PHPObject); ok {
 			return marshalObject(buf, obj, cfg, depth)
 		}
-		// For other structs, convert to map
-		return fmt.Errorf("cannot serialize struct type %T directly, use PHPObject or convert to map", value)
+		if enum, ok := v.Interface().(PHPEnum); ok {
+			return marshalEnumCase(buf, enum, cfg)
+		}
+		if obj, ok := v.Interface().(PHPCustomObject); ok {
+			return marshalCustomObject(buf, obj, cfg)
+		}
+		// Other structs follow their `php` field tags
+		return marshalStruct(buf, v, cfg, depth)
+
+	default:
+		return fmt.Errorf("%w: cannot serialize type %s", ErrUnsupportedType, v.Kind())
+	}
 
+	return nil
+}
+
+// marshalCustom writes the output of a Marshaler after checking that it is one
+// complete serialized value, and accounts for the slots it contains
+func marshalCustom(buf *bytes.Buffer, m Marshaler, t reflect.Type, cfg *marshalConfig) error {
+	data, err := m.MarshalPHP()
+	if err != nil {
+		return fmt.Errorf("MarshalPHP for type %s: %w", t, err)
+	}
+
+	r := &stringReader{data: string(data), pos: 0}
+	if _, err := unmarshalValue(r, &unmarshalConfig{allowAll: true, version: cfg.version}, 0); err != nil {
+		return fmt.Errorf("MarshalPHP for type %s returned invalid data: %w", t, err)
+	}
+	if r.pos != r.end() {
+		return fmt.Errorf("MarshalPHP for type %s returned invalid data: trailing bytes at position %d", t, r.pos)
+	}
+
+	cfg.slot += len(r.vars)
+	buf.Write(data)
+	return nil
+}
+
+// refKeyOf returns the identity of values that can be shared within a graph.
+// PHPObjects are identified by their Properties map, so an object decoded from
+// r:n; keeps its identity when it is marshaled again.
+func refKeyOf(v reflect.Value) (key refKey, isObject bool, ok bool) {
+	for v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return refKey{}, false, false
+		}
+		v = v.Elem()
+	}
+
+	switch v.Kind() {
 	case reflect.Ptr:
 		if v.IsNil() {
-			buf.WriteString("N;")
-			return nil
+			return refKey{}, false, false
 		}
-		return marshalValue(buf, v.Elem().Interface(), cfg, depth)
+		if obj, isObj := v.Elem().Interface().(PHPObject); isObj {
+			return refKeyOf(reflect.ValueOf(obj))
+		}
+		// Pointers to structs serialized as O: share an object handle
+		isObject := v.Elem().Kind() == reflect.Struct && structClassName(v.Elem()) != ""
+		return refKey{ptr: v.Pointer(), typ: v.Type()}, isObject, true
+	case reflect.Map:
+		if v.IsNil() {
+			return refKey{}, false, false
+		}
+		return refKey{ptr: v.Pointer(), typ: v.Type()}, false, true
+	case reflect.Slice:
+		// Empty slices have no identity worth preserving
+		if v.Len() == 0 {
+			return refKey{}, false, false
+		}
+		return refKey{ptr: v.Pointer(), typ: v.Type(), length: v.Len()}, false, true
+	case reflect.Struct:
+		if obj, isObj := v.Interface().(PHPObject); isObj && obj.Properties != nil {
+			props := reflect.ValueOf(obj.Properties)
+			return refKey{ptr: props.Pointer(), typ: reflect.TypeOf(obj)}, true, true
+		}
+	}
+	return refKey{}, false, false
+}
 
-	default:
-		return fmt.Errorf("cannot serialize type %s", v.Kind())
+// marshalEnumCase serializes a PHPEnum
+func marshalEnumCase(buf *bytes.Buffer, enum PHPEnum, cfg *marshalConfig) error {
+	if cfg.version.before(8, 1) {
+		return fmt.Errorf("%w: enums need PHP 8.1, target is PHP %s", ErrPHPVersion, cfg.version)
 	}
+	name := enum.ClassName + ":" + enum.Case
+	buf.WriteString(fmt.Sprintf("E:%d:\"%s\";", len(name), name))
+	return nil
+}
 
+// marshalCustomObject serializes a PHPCustomObject. When targeting PHP 7.4 or
+// later, SPL classes are written in the O: form those versions produce.
+func marshalCustomObject(buf *bytes.Buffer, obj PHPCustomObject, cfg *marshalConfig) error {
+	if cfg.version.before(5, 1) {
+		return fmt.Errorf("%w: custom serialized objects need PHP 5.1, target is PHP %s", ErrPHPVersion, cfg.version)
+	}
+	if cfg.version.since(7, 4) && splFormats[obj.ClassName] != 0 {
+		text, err := splToObject(obj)
+		if err != nil {
+			return fmt.Errorf("converting %s for PHP %s: %w", obj.ClassName, cfg.version, err)
+		}
+		// Unlike the C: payload, the values of the O: form take slots
+		_, count, err := scanReferences(text, newUnmarshalConfig(nil), 0)
+		if err != nil {
+			return err
+		}
+		cfg.slot += count - 1
+		buf.WriteString(text)
+		return nil
+	}
+	buf.WriteString(fmt.Sprintf("C:%d:\"%s\":%d:{%s}", len(obj.ClassName), obj.ClassName, len(obj.Data), obj.Data))
 	return nil
 }
 
 // marshalObject serializes a PHPObject
 func marshalObject(buf *bytes.Buffer, obj PHPObject, cfg *marshalConfig, depth int) error {
 	if cfg.maxDepth > 0 && depth >= cfg.maxDepth {
-		return fmt.Errorf("exceeded max depth %d", cfg.maxDepth)
+		return fmt.Errorf("%w %d", ErrMaxDepth, cfg.maxDepth)
+	}
+
+	// Before PHP 7.4, SPL classes only had their Serializable form
+	if cfg.version.before(7, 4) && splFormats[obj.ClassName] != 0 {
+		text, err := splToCustom(obj, cfg, depth)
+		if err != nil {
+			return fmt.Errorf("converting %s for PHP %s: %w", obj.ClassName, cfg.version, err)
+		}
+		buf.WriteString(text)
+		return nil
 	}
 
 	classNameLen := len(obj.ClassName)
@@ -342,11 +796,11 @@ func marshalObject(buf *bytes.Buffer, obj PHPObject, cfg *marshalConfig, depth i
 
 	buf.WriteString(fmt.Sprintf("O:%d:\"%s\":%d:{", classNameLen, obj.ClassName, propCount))
 
-	for key, value := range obj.Properties {
+	for _, key := range orderedPropertyNames(obj, cfg.keyOrder) {
 		// Serialize property name
 		buf.WriteString(fmt.Sprintf("s:%d:\"%s\";", len(key), key))
 		// Serialize property value with incremented depth
-		if err := marshalValue(buf, value, cfg, depth+1); err != nil {
+		if err := marshalValue(buf, obj.Properties[key], cfg, depth+1); err != nil {
 			return err
 		}
 	}
@@ -355,16 +809,53 @@ func marshalObject(buf *bytes.Buffer, obj PHPObject, cfg *marshalConfig, depth i
 	return nil
 }
 
+// unmarshalKey un-serializes an array key or property name, which like in
+// PHP must be an integer or a string.
+// Keys do not occupy a slot in PHP's var_hash.
+func unmarshalKey(r *stringReader, cfg *unmarshalConfig, depth int) (interface{}, error) {
+	typeChar, err := r.peek()
+	if err != nil {
+		return nil, err
+	}
+	if typeChar != 'i' && typeChar != 's' {
+		err := keyTypeError(r.pos, typeChar)
+		markValueStart(err, r.pos)
+		return nil, err
+	}
+	mark := len(r.vars)
+	key, err := unmarshalValue(r, cfg, depth)
+	r.vars = r.vars[:mark]
+	return key, err
+}
+
 // unmarshalValue un-serializes a single value
-func unmarshalValue(r *stringReader, cfg *unmarshalConfig, depth int) (interface{}, error) {
+func unmarshalValue(r *stringReader, cfg *unmarshalConfig, depth int) (value interface{}, err error) {
 	if cfg.maxDepth > 0 && depth >= cfg.maxDepth {
-		return nil, fmt.Errorf("exceeded max depth %d at position %d", cfg.maxDepth, r.pos)
+		return nil, maxDepthError(r.pos, cfg.maxDepth)
 	}
 
+	start, slot := r.pos, -1
+	defer func() {
+		if err != nil {
+			markValueStart(err, start)
+		} else if slot >= 0 {
+			r.vars[slot] = value
+		}
+	}()
+
 	typeChar, err := r.read()
 	if err != nil {
 		return nil, err
 	}
+	if !strings.ContainsRune("NbirRdsaOCE", rune(typeChar)) {
+		return nil, unknownTypeError(start, typeChar)
+	}
+
+	// Every value except R: is numbered, so it can be referenced later
+	if typeChar != 'R' {
+		slot = len(r.vars)
+		r.vars = append(r.vars, nil)
+	}
 
 	// Expect ':' after type (except for N)
 	if typeChar != 'N' {
@@ -373,7 +864,7 @@ func unmarshalValue(r *stringReader, cfg *unmarshalConfig, depth int) (interface
 			return nil, err
 		}
 		if colon != ':' {
-			return nil, fmt.Errorf("at position %d: expected ':' after type '%c', got '%c'", r.pos-1, typeChar, colon)
+			return nil, expectError(r.pos-1, "':'", fmt.Sprintf("after type '%c'", typeChar), colon)
 		}
 	}
 
@@ -384,7 +875,7 @@ func unmarshalValue(r *stringReader, cfg *unmarshalConfig, depth int) (interface
 			return nil, err
 		}
 		if semicolon != ';' {
-			return nil, fmt.Errorf("at position %d: expected ';' after NULL, got '%c'", r.pos-1, semicolon)
+			return nil, expectError(r.pos-1, "';'", "after NULL", semicolon)
 		}
 		return nil, nil
 
@@ -402,10 +893,32 @@ func unmarshalValue(r *stringReader, cfg *unmarshalConfig, depth int) (interface
 		}
 		val, err := strconv.ParseInt(valStr, 10, 64)
 		if err != nil {
-			return nil, fmt.Errorf("at position %d: invalid integer: %s", r.pos, valStr)
+			return nil, invalidError(r.pos, "integer", valStr)
 		}
 		return val, nil
 
+	case 'r', 'R': // Object reference / PHP reference
+		numStr, err := r.readUntil(';')
+		if err != nil {
+			return nil, err
+		}
+		n, err := strconv.Atoi(numStr)
+		if err != nil {
+			return nil, invalidError(r.pos, "reference", numStr)
+		}
+		// r: already took its own slot, which it cannot point to
+		limit := len(r.vars)
+		if slot >= 0 {
+			limit = slot
+		}
+		if n < 1 || n > limit {
+			return nil, syntaxError(r.pos, "reference %d out of range", n)
+		}
+		if _, isOpen := r.open[n-1]; isOpen {
+			r.open[n-1] = true
+		}
+		return r.vars[n-1], nil
+
 	case 'd': // Double/Float
 		valStr, err := r.readUntil(';')
 		if err != nil {
@@ -422,7 +935,7 @@ func unmarshalValue(r *stringReader, cfg *unmarshalConfig, depth int) (interface
 		}
 		val, err := strconv.ParseFloat(valStr, 64)
 		if err != nil {
-			return nil, fmt.Errorf("at position %d: invalid float: %s", r.pos, valStr)
+			return nil, invalidError(r.pos, "float", valStr)
 		}
 		return val, nil
 
@@ -433,12 +946,12 @@ func unmarshalValue(r *stringReader, cfg *unmarshalConfig, depth int) (interface
 		}
 		length, err := strconv.Atoi(lenStr)
 		if err != nil {
-			return nil, fmt.Errorf("at position %d: invalid string length: %s", r.pos, lenStr)
+			return nil, invalidError(r.pos, "string length", lenStr)
 		}
 
 		// Validate string length
 		if length < 0 {
-			return nil, fmt.Errorf("at position %d: negative string length: %d", r.pos, length)
+			return nil, syntaxError(r.pos, "negative string length: %d", length)
 		}
 
 		// Read opening quote
@@ -447,7 +960,7 @@ func unmarshalValue(r *stringReader, cfg *unmarshalConfig, depth int) (interface
 			return nil, err
 		}
 		if quote != '"' {
-			return nil, fmt.Errorf("at position %d: expected '\"' before string, got '%c'", r.pos-1, quote)
+			return nil, expectError(r.pos-1, "'\"'", "before string", quote)
 		}
 
 		// Read string bytes (not characters)
@@ -462,7 +975,7 @@ func unmarshalValue(r *stringReader, cfg *unmarshalConfig, depth int) (interface
 			return nil, err
 		}
 		if quote != '"' {
-			return nil, fmt.Errorf("at position %d: expected '\"' after string, got '%c'", r.pos-1, quote)
+			return nil, expectError(r.pos-1, "'\"'", "after string", quote)
 		}
 
 		// Read semicolon
@@ -471,43 +984,35 @@ func unmarshalValue(r *stringReader, cfg *unmarshalConfig, depth int) (interface
 			return nil, err
 		}
 		if semicolon != ';' {
-			return nil, fmt.Errorf("at position %d: expected ';' after string, got '%c'", r.pos-1, semicolon)
+			return nil, expectError(r.pos-1, "';'", "after string", semicolon)
 		}
 
 		return str, nil
 
 	case 'a': // Array
-		countStr, err := r.readUntil(':')
-		if err != nil {
-			return nil, err
-		}
-		count, err := strconv.Atoi(countStr)
-		if err != nil {
-			return nil, fmt.Errorf("at position %d: invalid array count: %s", r.pos, countStr)
-		}
-
-		// Validate array size
-		if count < 0 {
-			return nil, fmt.Errorf("at position %d: negative array count: %d", r.pos, count)
-		}
-
-		// Read opening brace
-		brace, err := r.read()
+		count, err := readCount(r, "array count", "array")
 		if err != nil {
 			return nil, err
 		}
-		if brace != '{' {
-			return nil, fmt.Errorf("at position %d: expected '{' for array, got '%c'", r.pos-1, brace)
+		if cfg.orderedArrays {
+			return unmarshalOrderedArray(r, cfg, depth, slot, count)
 		}
 
 		// Check if it's an indexed array (all keys are sequential integers starting from 0)
 		isIndexed := true
 		tempMap := make(map[string]interface{})
-		indices := make([]int, 0, count)
+		indices := make([]int, 0, r.maxEntries(count))
+
+		// Register the array before its elements so self-references resolve to it
+		r.vars[slot] = tempMap
+		if r.open == nil {
+			r.open = make(map[int]bool)
+		}
+		r.open[slot] = false
 
 		for i := 0; i < count; i++ {
 			// Read key with incremented depth
-			key, err := unmarshalValue(r, cfg, depth+1)
+			key, err := unmarshalKey(r, cfg, depth+1)
 			if err != nil {
 				return nil, err
 			}
@@ -515,7 +1020,7 @@ func unmarshalValue(r *stringReader, cfg *unmarshalConfig, depth int) (interface
 			// Read value with incremented depth
 			value, err := unmarshalValue(r, cfg, depth+1)
 			if err != nil {
-				return nil, err
+				return nil, prependPath(err, key)
 			}
 
 			// Check if key is an integer
@@ -526,20 +1031,23 @@ func unmarshalValue(r *stringReader, cfg *unmarshalConfig, depth int) (interface
 			case string:
 				isIndexed = false
 				tempMap[k] = value
-			default:
-				keyStr := fmt.Sprintf("%v", k)
-				tempMap[keyStr] = value
-				isIndexed = false
 			}
 		}
 
 		// Read closing brace
-		brace, err = r.read()
+		brace, err := r.read()
 		if err != nil {
 			return nil, err
 		}
 		if brace != '}' {
-			return nil, fmt.Errorf("at position %d: expected '}' for array, got '%c'", r.pos-1, brace)
+			return nil, expectError(r.pos-1, "'}'", "for array", brace)
+		}
+
+		// An array referenced from inside itself already escaped as a map
+		selfReferenced := r.open[slot]
+		delete(r.open, slot)
+		if selfReferenced {
+			return tempMap, nil
 		}
 
 		// If it's an indexed array with sequential keys, return a slice
@@ -569,128 +1077,284 @@ func unmarshalValue(r *stringReader, cfg *unmarshalConfig, depth int) (interface
 		return tempMap, nil
 
 	case 'O': // Object
-		classLenStr, err := r.readUntil(':')
+		className, err := readClassName(r, cfg, typeChar)
 		if err != nil {
 			return nil, err
 		}
-		classLen, err := strconv.Atoi(classLenStr)
+
+		// Read property count
+		propCount, err := readCount(r, "property count", "object properties")
 		if err != nil {
-			return nil, fmt.Errorf("at position %d: invalid class name length: %s", r.pos, classLenStr)
+			return nil, err
 		}
 
-		if classLen < 0 {
-			return nil, fmt.Errorf("at position %d: negative class name length: %d", r.pos, classLen)
+		properties := make(map[string]interface{})
+		order := make([]string, 0, r.maxEntries(propCount))
+		// Register the object before its properties so r: can point back to it
+		r.vars[slot] = PHPObject{
+			ClassName:  className,
+			Properties: properties,
 		}
+		for i := 0; i < propCount; i++ {
+			// Read property name with incremented depth
+			propName, err := unmarshalKey(r, cfg, depth+1)
+			if err != nil {
+				return nil, err
+			}
 
-		// Read opening quote
-		quote, err := r.read()
+			// Read property value with incremented depth
+			propValue, err := unmarshalValue(r, cfg, depth+1)
+			if err != nil {
+				return nil, prependPath(err, bareName(keyString(propName)))
+			}
+
+			// Names keep PHP's visibility mangling so private and protected
+			// properties survive a round trip, see PropertyName
+			name := keyString(propName)
+			if _, exists := properties[name]; !exists {
+				order = append(order, name)
+			}
+			properties[name] = propValue
+		}
+
+		// Read closing brace
+		brace, err := r.read()
 		if err != nil {
 			return nil, err
 		}
-		if quote != '"' {
-			return nil, fmt.Errorf("at position %d: expected '\"' before class name, got '%c'", r.pos-1, quote)
+		if brace != '}' {
+			return nil, expectError(r.pos-1, "'}'", "for object", brace)
 		}
 
-		// Read class name
-		className, err := r.readBytes(classLen)
+		return PHPObject{
+			ClassName:  className,
+			Properties: properties,
+			Order:      order,
+		}, nil
+
+	case 'C': // Custom-serialized object (Serializable interface)
+		className, err := readClassName(r, cfg, typeChar)
 		if err != nil {
 			return nil, err
 		}
-		if !cfg.allowAll {
-			if cfg.allowedClasses == nil || !cfg.allowedClasses[className] {
-				return nil, fmt.Errorf("at position %d: class %q not allowed", r.pos, className)
-			}
-		}
 
-		// Read closing quote
-		quote, err = r.read()
+		// Read payload length
+		dataLenStr, err := r.readUntil(':')
 		if err != nil {
 			return nil, err
 		}
-		if quote != '"' {
-			return nil, fmt.Errorf("at position %d: expected '\"' after class name, got '%c'", r.pos-1, quote)
+		dataLen, err := strconv.Atoi(dataLenStr)
+		if err != nil {
+			return nil, invalidError(r.pos, "payload length", dataLenStr)
+		}
+		if dataLen < 0 {
+			return nil, syntaxError(r.pos, "negative payload length: %d", dataLen)
 		}
 
-		// Read colon
-		colon, err := r.read()
+		// Read opening brace
+		brace, err := r.read()
 		if err != nil {
 			return nil, err
 		}
-		if colon != ':' {
-			return nil, fmt.Errorf("at position %d: expected ':' after class name, got '%c'", r.pos-1, colon)
+		if brace != '{' {
+			return nil, expectError(r.pos-1, "'{'", "for custom object payload", brace)
 		}
 
-		// Read property count
-		propCountStr, err := r.readUntil(':')
+		payloadPos := r.pos
+		payload, err := r.readBytes(dataLen)
 		if err != nil {
 			return nil, err
 		}
-		propCount, err := strconv.Atoi(propCountStr)
+
+		// Read closing brace
+		brace, err = r.read()
 		if err != nil {
-			return nil, fmt.Errorf("at position %d: invalid property count: %s", r.pos, propCountStr)
+			return nil, err
+		}
+		if brace != '}' {
+			return nil, expectError(r.pos-1, "'}'", "for custom object", brace)
 		}
 
-		// Validate property count
-		if propCount < 0 {
-			return nil, fmt.Errorf("at position %d: negative property count: %d", r.pos, propCount)
+		obj := PHPCustomObject{
+			ClassName: className,
+			Data:      payload,
 		}
+		if decode, ok := cfg.customDecoders[className]; ok {
+			decoded, err := decode(payload)
+			if err != nil {
+				return nil, customDecoderError(payloadPos, className, err)
+			}
+			obj.Value = decoded
+		}
+		return obj, nil
 
-		// Read opening brace
-		brace, err := r.read()
+	case 'E': // Enum case (PHP 8.1+)
+		lenStr, err := r.readUntil(':')
 		if err != nil {
 			return nil, err
 		}
-		if brace != '{' {
-			return nil, fmt.Errorf("at position %d: expected '{' for object properties, got '%c'", r.pos-1, brace)
+		length, err := strconv.Atoi(lenStr)
+		if err != nil {
+			return nil, invalidError(r.pos, "enum name length", lenStr)
+		}
+		if length < 0 {
+			return nil, syntaxError(r.pos, "negative enum name length: %d", length)
 		}
 
-		properties := make(map[string]interface{})
-		for i := 0; i < propCount; i++ {
-			// Read property name with incremented depth
-			propName, err := unmarshalValue(r, cfg, depth+1)
-			if err != nil {
-				return nil, err
-			}
+		// Read opening quote
+		quote, err := r.read()
+		if err != nil {
+			return nil, err
+		}
+		if quote != '"' {
+			return nil, expectError(r.pos-1, "'\"'", "before enum name", quote)
+		}
 
-			// Read property value with incremented depth
-			propValue, err := unmarshalValue(r, cfg, depth+1)
-			if err != nil {
-				return nil, err
-			}
+		namePos := r.pos
+		name, err := r.readBytes(length)
+		if err != nil {
+			return nil, err
+		}
 
-			if name, ok := propName.(string); ok {
-				// Remove visibility prefixes if present (PHP private/protected properties)
-				// Private: \0ClassName\0propertyName
-				// Protected: \0*\0propertyName
-				if strings.Contains(name, "\x00") {
-					parts := strings.Split(name, "\x00")
-					if len(parts) > 0 {
-						name = parts[len(parts)-1]
-					}
-				}
-				properties[name] = propValue
-			} else {
-				properties[fmt.Sprintf("%v", propName)] = propValue
-			}
+		// Read closing quote
+		quote, err = r.read()
+		if err != nil {
+			return nil, err
+		}
+		if quote != '"' {
+			return nil, expectError(r.pos-1, "'\"'", "after enum name", quote)
 		}
 
-		// Read closing brace
-		brace, err = r.read()
+		// Read semicolon
+		semicolon, err := r.read()
 		if err != nil {
 			return nil, err
 		}
-		if brace != '}' {
-			return nil, fmt.Errorf("at position %d: expected '}' for object, got '%c'", r.pos-1, brace)
+		if semicolon != ';' {
+			return nil, expectError(r.pos-1, "';'", "after enum", semicolon)
 		}
 
-		return PHPObject{
-			ClassName:  className,
-			Properties: properties,
-		}, nil
+		className, caseName, found := strings.Cut(name, ":")
+		if !found || className == "" || caseName == "" {
+			return nil, syntaxError(namePos, "invalid enum name %q", name)
+		}
+		if !cfg.isClassAllowed(className) {
+			return nil, classNotAllowedError(namePos, className)
+		}
+		if err := cfg.versionError(namePos, typeChar, className); err != nil {
+			return nil, err
+		}
+		if cases, ok := cfg.enums[className]; ok {
+			value, ok := cases[caseName]
+			if !ok {
+				return nil, syntaxError(namePos, "undefined case %s::%s", className, caseName)
+			}
+			return value, nil
+		}
+		return PHPEnum{ClassName: className, Case: caseName}, nil
 
 	default:
-		return nil, fmt.Errorf("at position %d: unknown type '%c'", r.pos-1, typeChar)
+		return nil, unknownTypeError(start, typeChar)
+	}
+}
+
+// readClassName reads the `len:"Name":` part shared by O: and C: values
+// and enforces the allowed-classes policy and the targeted PHP version
+func readClassName(r *stringReader, cfg *unmarshalConfig, typeChar byte) (string, error) {
+	classLenStr, err := r.readUntil(':')
+	if err != nil {
+		return "", err
+	}
+	classLen, err := strconv.Atoi(classLenStr)
+	if err != nil {
+		return "", invalidError(r.pos, "class name length", classLenStr)
+	}
+
+	if classLen < 0 {
+		return "", syntaxError(r.pos, "negative class name length: %d", classLen)
+	}
+
+	// Read opening quote
+	quote, err := r.read()
+	if err != nil {
+		return "", err
+	}
+	if quote != '"' {
+		return "", expectError(r.pos-1, "'\"'", "before class name", quote)
+	}
+
+	// Read class name
+	className, err := r.readBytes(classLen)
+	if err != nil {
+		return "", err
+	}
+	if !cfg.isClassAllowed(className) {
+		return "", classNotAllowedError(r.pos, className)
+	}
+	if err := cfg.versionError(r.pos, typeChar, className); err != nil {
+		return "", err
+	}
+
+	// Read closing quote
+	quote, err = r.read()
+	if err != nil {
+		return "", err
+	}
+	if quote != '"' {
+		return "", expectError(r.pos-1, "'\"'", "after class name", quote)
+	}
+
+	// Read colon
+	colon, err := r.read()
+	if err != nil {
+		return "", err
+	}
+	if colon != ':' {
+		return "", expectError(r.pos-1, "':'", "after class name", colon)
+	}
+
+	return className, nil
+}
+
+// readCount reads the `count:{` part that opens an array or an object body
+func readCount(r *stringReader, countName, body string) (int, error) {
+	countStr, err := r.readUntil(':')
+	if err != nil {
+		return 0, err
+	}
+	count, err := strconv.Atoi(countStr)
+	if err != nil {
+		return 0, invalidError(r.pos, countName, countStr)
+	}
+
+	// Validate count
+	if count < 0 {
+		return 0, syntaxError(r.pos, "negative %s: %d", countName, count)
+	}
+
+	// Read opening brace
+	brace, err := r.read()
+	if err != nil {
+		return 0, err
+	}
+	if brace != '{' {
+		return 0, expectError(r.pos-1, "'{'", "for "+body, brace)
+	}
+	return count, nil
+}
+
+// minEntrySize is the length of the shortest array entry, `i:0;N;`
+const minEntrySize = 6
+
+// maxEntries bounds a count read from the input by the number of entries the
+// rest of the input can hold, so that a forged count cannot make the decoder
+// allocate more than the input justifies. Streams are bounded by one chunk.
+func (r *stringReader) maxEntries(count int) int {
+	limit := (r.end() - r.pos) / minEntrySize
+	if r.stream {
+		limit = streamChunkSize / minEntrySize
 	}
+	return min(count, limit)
 }
 
 // Helper functions for common use cases
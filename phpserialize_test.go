@@ -1,8 +1,10 @@
 package phpserialize
 
 import (
+	"errors"
 	"fmt"
 	"math"
+	"reflect"
 	"strings"
 	"testing"
 )
@@ -477,13 +479,28 @@ func TestPHPPrivateProperties(t *testing.T) {
 		t.Fatalf("Expected PHPObject, got %T", result)
 	}
 
-	// Property names should have visibility markers stripped
-	if _, hasId := obj.Properties["id"]; !hasId {
-		t.Error("Expected 'id' property (stripped of \\x00User\\x00)")
+	// Properties can be read by bare name and keep their visibility
+	if id, ok := obj.Get("id"); !ok || id != int64(123) {
+		t.Errorf("Expected 'id' property, got %v", id)
+	}
+	if vis, class, _ := obj.PropertyVisibility("id"); vis != Private || class != "User" {
+		t.Errorf("Expected id to be private to User, got %v %q", vis, class)
+	}
+
+	if _, ok := obj.Get("password"); !ok {
+		t.Error("Expected 'password' property")
+	}
+	if vis, _, _ := obj.PropertyVisibility("password"); vis != Protected {
+		t.Errorf("Expected password to be protected, got %v", vis)
 	}
 
-	if _, hasPass := obj.Properties["password"]; !hasPass {
-		t.Error("Expected 'password' property (stripped of \\x00*\\x00)")
+	// Mangled names are written back unchanged
+	out, err := Marshal(obj)
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	if out != phpData {
+		t.Errorf("Expected %q, got %q", phpData, out)
 	}
 }
 
@@ -710,6 +727,14 @@ func TestEdgeCases(t *testing.T) {
 		}
 	})
 
+	t.Run("forged counts", func(t *testing.T) {
+		for _, data := range []string{`O:1:"A":999999999999999:{}`, `a:999999999999999:{}`, `a:100000000:{}`} {
+			if _, err := Unmarshal(data); err == nil {
+				t.Errorf("Expected error for %s", data)
+			}
+		}
+	})
+
 	t.Run("zero float", func(t *testing.T) {
 		data, _ := Marshal(0.0)
 		result, _ := Unmarshal(data)
@@ -827,3 +852,229 @@ func BenchmarkMapSerialization(b *testing.B) {
 		_, _ = Marshal(m)
 	}
 }
+
+// TestReferences tests r: and R: back-references in both directions
+func TestReferences(t *testing.T) {
+	t.Run("object reference round-trip", func(t *testing.T) {
+		data := `a:3:{i:0;O:1:"A":1:{s:1:"x";i:1;}i:1;i:5;i:2;r:2;}`
+		result, err := Unmarshal(data)
+		if err != nil {
+			t.Fatalf("Unmarshal failed: %v", err)
+		}
+		slice, ok := result.([]interface{})
+		if !ok || len(slice) != 3 {
+			t.Fatalf("Expected slice of 3, got %#v", result)
+		}
+		first := slice[0].(PHPObject)
+		second, ok := slice[2].(PHPObject)
+		if !ok {
+			t.Fatalf("Expected PHPObject for r:, got %T", slice[2])
+		}
+		first.Properties["x"] = int64(2)
+		if second.Properties["x"] != int64(2) {
+			t.Error("Expected r: to share the referenced object")
+		}
+
+		first.Properties["x"] = 1
+		out, err := Marshal(slice)
+		if err != nil {
+			t.Fatalf("Marshal failed: %v", err)
+		}
+		if out != data {
+			t.Errorf("Expected %q, got %q", data, out)
+		}
+	})
+
+	t.Run("array reference round-trip", func(t *testing.T) {
+		data := `a:2:{i:0;a:1:{i:0;i:1;}i:1;R:2;}`
+		result, err := Unmarshal(data)
+		if err != nil {
+			t.Fatalf("Unmarshal failed: %v", err)
+		}
+		out, err := Marshal(result)
+		if err != nil {
+			t.Fatalf("Marshal failed: %v", err)
+		}
+		if out != data {
+			t.Errorf("Expected %q, got %q", data, out)
+		}
+	})
+
+	t.Run("R does not take a slot", func(t *testing.T) {
+		result, err := Unmarshal(`a:4:{i:0;s:1:"a";i:1;R:2;i:2;s:1:"b";i:3;r:3;}`)
+		if err != nil {
+			t.Fatalf("Unmarshal failed: %v", err)
+		}
+		slice := result.([]interface{})
+		if slice[1] != "a" || slice[3] != "b" {
+			t.Errorf("Unexpected slot resolution: %#v", slice)
+		}
+	})
+
+	t.Run("self-referencing array", func(t *testing.T) {
+		result, err := Unmarshal(`a:1:{i:0;a:1:{i:0;R:2;}}`)
+		if err != nil {
+			t.Fatalf("Unmarshal failed: %v", err)
+		}
+		inner, ok := result.([]interface{})[0].(map[string]interface{})
+		if !ok {
+			t.Fatalf("Expected self-referenced array to stay a map, got %T", result.([]interface{})[0])
+		}
+		if reflect.ValueOf(inner["0"]).Pointer() != reflect.ValueOf(inner).Pointer() {
+			t.Error("Expected inner array to reference itself")
+		}
+	})
+
+	t.Run("cyclic map marshal", func(t *testing.T) {
+		m := map[string]interface{}{}
+		m["self"] = m
+		out, err := Marshal(m)
+		if err != nil {
+			t.Fatalf("Marshal failed: %v", err)
+		}
+		if out != `a:1:{s:4:"self";R:1;}` {
+			t.Errorf("Unexpected output %q", out)
+		}
+	})
+
+	t.Run("invalid references", func(t *testing.T) {
+		for _, data := range []string{`r:1;`, `R:1;`, `a:1:{i:0;R:0;}`, `a:1:{i:0;R:3;}`, `a:1:{i:0;r:x;}`} {
+			if _, err := Unmarshal(data); err == nil {
+				t.Errorf("Expected error for %q", data)
+			}
+		}
+	})
+}
+
+// TestCustomObject tests C: objects written by PHP's Serializable interface
+func TestCustomObject(t *testing.T) {
+	data := `a:2:{i:0;C:11:"ArrayObject":21:{x:i:0;a:0:{};m:a:0:{}}i:1;C:3:"Foo":5:{i:42;}}`
+
+	result, err := Unmarshal(data)
+	if err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	slice := result.([]interface{})
+	obj, ok := slice[0].(PHPCustomObject)
+	if !ok {
+		t.Fatalf("Expected PHPCustomObject, got %T", slice[0])
+	}
+	if obj.ClassName != "ArrayObject" || obj.Data != "x:i:0;a:0:{};m:a:0:{}" {
+		t.Errorf("Unexpected custom object: %#v", obj)
+	}
+
+	// Round-trip byte-for-byte
+	out, err := Marshal(result)
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	if out != data {
+		t.Errorf("Expected %q, got %q", data, out)
+	}
+
+	// Decoder hook for a known class
+	result, err = Unmarshal(data, WithCustomDecoder("Foo", func(payload string) (interface{}, error) {
+		return Unmarshal(payload)
+	}))
+	if err != nil {
+		t.Fatalf("Unmarshal with decoder failed: %v", err)
+	}
+	foo := result.([]interface{})[1].(PHPCustomObject)
+	if foo.Value != int64(42) {
+		t.Errorf("Expected decoded value 42, got %v", foo.Value)
+	}
+
+	// Decoder errors are reported as a SyntaxError at the payload
+	boom := errors.New("boom")
+	failing := WithCustomDecoder("Foo", func(string) (interface{}, error) {
+		return nil, boom
+	})
+	_, err = Unmarshal(data, failing)
+	var se *SyntaxError
+	if !errors.As(err, &se) || !errors.Is(err, boom) {
+		t.Fatalf("Expected a SyntaxError wrapping the decoder error, got %v", err)
+	}
+	if want := int64(strings.Index(data, "{i:42;}") + 1); se.Offset != want || se.Path != "1" {
+		t.Errorf("Expected offset %d at path 1, got %d at path %q", want, se.Offset, se.Path)
+	}
+	_, err = Unmarshal(data, failing, WithPHPErrors(true))
+	if want := fmt.Sprintf("Error at offset %d of %d bytes", strings.Index(data, `C:3:"Foo"`), len(data)); err == nil || err.Error() != want {
+		t.Errorf("Expected %q, got %v", want, err)
+	}
+
+	// Allowed classes apply to C: as well
+	if _, err := Unmarshal(data, WithAllowedClasses([]string{"Foo"})); err == nil {
+		t.Error("Expected error for disallowed class")
+	}
+
+	// Malformed payloads
+	for _, bad := range []string{`C:3:"Foo":9:{i:42;}`, `C:3:"Foo":-1:{}`, `C:3:"Foo":6:i:42;}`} {
+		if _, err := Unmarshal(bad); err == nil {
+			t.Errorf("Expected error for %q", bad)
+		}
+	}
+}
+
+type testSuit int
+
+const (
+	testHearts testSuit = iota + 1
+	testSpades
+)
+
+// TestEnums tests PHP 8.1 enum cases
+func TestEnums(t *testing.T) {
+	data := `a:2:{i:0;E:11:"Suit:Hearts";i:1;E:11:"Suit:Spades";}`
+
+	result, err := Unmarshal(data)
+	if err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	slice := result.([]interface{})
+	if slice[0] != (PHPEnum{ClassName: "Suit", Case: "Hearts"}) {
+		t.Errorf("Unexpected enum: %#v", slice[0])
+	}
+
+	out, err := Marshal(result)
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	if out != data {
+		t.Errorf("Expected %q, got %q", data, out)
+	}
+
+	// Mapping to Go constants
+	suits := WithEnum("Suit", map[string]testSuit{"Hearts": testHearts, "Spades": testSpades})
+	result, err = Unmarshal(data, suits)
+	if err != nil {
+		t.Fatalf("Unmarshal with enum failed: %v", err)
+	}
+	if slice := result.([]interface{}); slice[0] != testHearts || slice[1] != testSpades {
+		t.Errorf("Expected Go constants, got %#v", slice)
+	}
+	out, err = Marshal([]testSuit{testHearts, testSpades}, suits)
+	if err != nil {
+		t.Fatalf("Marshal with enum failed: %v", err)
+	}
+	if out != data {
+		t.Errorf("Expected %q, got %q", data, out)
+	}
+
+	if _, err := Marshal(testSuit(9), suits); err == nil {
+		t.Error("Expected error for value that is not a registered case")
+	}
+	if _, err := Unmarshal(`E:10:"Suit:Clubs";`, suits); err == nil {
+		t.Error("Expected error for undefined case")
+	}
+
+	// Allowed classes apply to enums
+	if _, err := Unmarshal(data, WithAllowedClasses([]string{"User"})); err == nil {
+		t.Error("Expected error for disallowed enum class")
+	}
+
+	for _, bad := range []string{`E:4:"Suit";`, `E:5:"Suit:";`, `E:11:"Suit:Hearts"`, `E:12:"Suit:Hearts";`} {
+		if _, err := Unmarshal(bad); err == nil {
+			t.Errorf("Expected error for %q", bad)
+		}
+	}
+}
@@ -0,0 +1,518 @@
+package phpserialize
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ErrAmbiguousRepair means Repair found several equally valid ways to fix the data
+var ErrAmbiguousRepair = errors.New("ambiguous repair")
+
+// Fix describes one string length corrected by Repair
+type Fix struct {
+	Offset   int // offset of the string's "s:" in the input
+	Declared int // length found in the input
+	Actual   int // length of the string as repaired
+}
+
+// repairCandidates is the number of terminators tried for each string
+const repairCandidates = 16
+
+// repairBudget bounds the number of tokens Repair may parse per input byte
+// while trying alternatives, so pathological input fails instead of hanging
+const repairBudget = 64
+
+// Repair fixes serialized data whose string lengths no longer match their
+// contents, typically after a search-and-replace on a database dump.
+// Each string whose declared length does not end at a `";` that lets the rest
+// of the data parse is re-measured by trying the other `";` terminators,
+// nearest first, and keeping the first one with which the whole input parses.
+// Strings that hold serialized data themselves, as WordPress options often
+// do, are repaired the same way, and their fixes are reported too.
+// Repair refuses with ErrAmbiguousRepair when a different terminator for one of
+// the strings would also produce valid data, and returns a *SyntaxError when
+// no choice does, at any level.
+// Valid data is returned unchanged with no fixes.
+func Repair(data string) (string, []Fix, error) {
+	p := &repairParser{data: data, budget: repairBudget*len(data) + 1024}
+	if !p.run() {
+		return "", nil, p.failure()
+	}
+	if len(p.fixes) > 0 {
+		if err := p.unambiguous(); err != nil {
+			return "", nil, err
+		}
+	}
+
+	// Every string taken by the parse is still a choice point; rewrite the
+	// ones whose length changed or whose content needs repairing in turn
+	outer := make(map[int]Fix, len(p.fixes))
+	for _, fix := range p.fixes {
+		outer[fix.Offset] = fix
+	}
+	var fixes []Fix
+	var out strings.Builder
+	out.Grow(len(data) + 8*len(p.fixes))
+	last := 0
+	for _, c := range p.choices {
+		end := c.contentStart + c.declared
+		if fix, ok := outer[c.start]; ok {
+			end = c.contentStart + fix.Actual
+		}
+		content := data[c.contentStart:end]
+		var inner []Fix
+		if looksSerialized(content) {
+			repaired, innerFixes, err := Repair(content)
+			if err != nil {
+				var se *SyntaxError
+				if errors.As(err, &se) {
+					se.Offset += int64(c.contentStart)
+					return "", nil, se
+				}
+				return "", nil, fmt.Errorf("in string at position %d: %w", c.start, err)
+			}
+			content, inner = repaired, innerFixes
+		}
+		if len(content) != c.declared {
+			fixes = append(fixes, Fix{Offset: c.start, Declared: c.declared, Actual: len(content)})
+		}
+		for _, fix := range inner {
+			fix.Offset += c.contentStart
+			fixes = append(fixes, fix)
+		}
+		if len(content) == c.declared && len(inner) == 0 {
+			continue
+		}
+		// Only the digits of the length and the content change
+		out.WriteString(data[last : c.start+2])
+		out.WriteString(strconv.Itoa(len(content)))
+		out.WriteString(`:"`)
+		out.WriteString(content)
+		last = end
+	}
+	if len(fixes) == 0 {
+		return data, nil, nil
+	}
+	out.WriteString(data[last:])
+	return out.String(), fixes, nil
+}
+
+// unambiguous checks that no other terminator of any string lets the data
+// parse, once run has found a solution
+func (p *repairParser) unambiguous() error {
+	data := p.data
+
+	// The repair is ambiguous when another terminator for any string also
+	// lets the rest of the data parse. Candidates nearer than the ones taken
+	// already failed above. Probes compare themselves with the solution at
+	// the start of each string, see repairParser.compare.
+	solution := make(map[int]repairState, len(p.choices))
+	for _, c := range p.choices {
+		solution[c.start] = c.state
+	}
+	for _, c := range p.choices {
+		for {
+			end, ok := c.next(data)
+			if !ok {
+				break
+			}
+			probe := &repairParser{data: data, state: c.state, budget: p.budget, greedy: true, solution: solution}
+			probe.state.stack = append([]repairFrame(nil), c.state.stack...)
+			probe.takeString(c.start, c.declared, c.contentStart, end)
+			ok = probe.run()
+			if p.budget = probe.budget; p.budget < 0 {
+				return fmt.Errorf("%w: too many alternatives to verify", ErrAmbiguousRepair)
+			}
+			if ok {
+				return fmt.Errorf("%w: string at position %d", ErrAmbiguousRepair, c.start)
+			}
+		}
+	}
+	return nil
+}
+
+// repairFrame is an array or object being parsed
+type repairFrame struct {
+	remaining int  // entries still to read
+	key       bool // the next token is a key
+}
+
+// repairState is everything needed to resume parsing from a choice point
+type repairState struct {
+	pos   int
+	stack []repairFrame
+	fixes int
+	done  bool
+}
+
+// repairChoice is a string whose terminator can be chosen among candidates,
+// which are the `";` around the declared end, nearest first
+type repairChoice struct {
+	state        repairState // state before the string
+	start        int         // offset of "s:"
+	declared     int
+	contentStart int
+	fwd          int // where to search for the next candidate after the declared end
+	bwd          int // end of the range to search for the next candidate before it
+	tried        int
+}
+
+func newRepairChoice(state repairState, start, declared, contentStart, size int) repairChoice {
+	want := contentStart + declared
+	c := repairChoice{state: state, start: start, declared: declared, contentStart: contentStart}
+	c.fwd, c.bwd = want+1, want+1
+	if want >= size {
+		c.fwd, c.bwd = size, size
+	}
+	return c
+}
+
+// next returns the next candidate end of the string's content
+func (c *repairChoice) next(data string) (int, bool) {
+	if c.tried >= repairCandidates {
+		return 0, false
+	}
+	after, before := -1, -1
+	if n := strings.Index(data[c.fwd:], `";`); n >= 0 {
+		after = c.fwd + n
+	}
+	if c.bwd > c.contentStart {
+		before = strings.LastIndex(data[c.contentStart:c.bwd], `";`)
+		if before >= 0 {
+			before += c.contentStart
+		}
+	}
+
+	want := c.contentStart + c.declared
+	switch {
+	case after < 0 && before < 0:
+		return 0, false
+	case before < 0 || (after >= 0 && after-want < want-before):
+		c.fwd = after + 1
+		c.tried++
+		return after, true
+	default:
+		c.bwd = before + 1
+		c.tried++
+		return before, true
+	}
+}
+
+// repairParser walks the serialized grammar with backtracking over string lengths
+type repairParser struct {
+	data    string
+	state   repairState
+	fixes   []Fix
+	choices []repairChoice
+	budget  int
+	greedy  bool // take each string's declared or nearest terminator without backtracking
+
+	// States of the first solution before each string, keyed by offset
+	solution map[int]repairState
+	err      *SyntaxError // furthest error seen, reported if nothing parses
+}
+
+// run parses until the input is complete, backtracking on errors.
+// It returns false when no alternative is left.
+func (p *repairParser) run() bool {
+	for {
+		if p.budget--; p.budget < 0 {
+			return false
+		}
+		if match, decided := p.compare(); decided {
+			return match
+		}
+		if p.state.done {
+			if p.state.pos == len(p.data) {
+				return true
+			}
+			p.fail(syntaxError(p.state.pos, "unexpected data after value"))
+		} else if err := p.step(); err != nil {
+			p.fail(err)
+		} else {
+			continue
+		}
+		if p.greedy || !p.backtrack() {
+			return false
+		}
+	}
+}
+
+// compare checks a probe against the first solution when both are about to
+// read the same string. The same state means the probe can finish exactly like
+// the solution; states differing only in entry counts mean it reads the same
+// tokens and fails where the solution closed an array. Otherwise the outcome
+// is not decided yet.
+func (p *repairParser) compare() (match bool, decided bool) {
+	want, ok := p.solution[p.state.pos]
+	if !ok || len(want.stack) != len(p.state.stack) {
+		return false, false
+	}
+	same := true
+	for i, f := range p.state.stack {
+		if f.key != want.stack[i].key {
+			return false, false
+		}
+		same = same && f.remaining == want.stack[i].remaining
+	}
+	return same, true
+}
+
+// fail records an error, keeping the one that got furthest into the input
+func (p *repairParser) fail(err *SyntaxError) {
+	if p.err == nil || err.Offset >= p.err.Offset {
+		p.err = err
+	}
+}
+
+func (p *repairParser) failure() error {
+	if p.budget < 0 {
+		return fmt.Errorf("%w: too many alternatives to try", ErrAmbiguousRepair)
+	}
+	return p.err
+}
+
+// backtrack resumes from the latest choice point with an untried candidate
+func (p *repairParser) backtrack() bool {
+	for len(p.choices) > 0 {
+		c := &p.choices[len(p.choices)-1]
+		end, ok := c.next(p.data)
+		if !ok {
+			p.choices = p.choices[:len(p.choices)-1]
+			continue
+		}
+
+		p.state = c.state
+		p.state.stack = append([]repairFrame(nil), c.state.stack...)
+		p.fixes = p.fixes[:c.state.fixes]
+		p.takeString(c.start, c.declared, c.contentStart, end)
+		return true
+	}
+	return false
+}
+
+// takeString consumes a string whose content ends at end
+func (p *repairParser) takeString(start, declared, contentStart, end int) {
+	if end-contentStart != declared {
+		p.fixes = append(p.fixes, Fix{Offset: start, Declared: declared, Actual: end - contentStart})
+	}
+	p.state.fixes = len(p.fixes)
+	p.state.pos = end + 2
+	p.complete()
+}
+
+// complete records that a key or value has been read
+func (p *repairParser) complete() {
+	stack := p.state.stack
+	if len(stack) == 0 {
+		p.state.done = true
+		return
+	}
+	top := &stack[len(stack)-1]
+	if top.key {
+		top.key = false
+	} else {
+		top.remaining--
+		top.key = true
+	}
+}
+
+// step reads the next token
+func (p *repairParser) step() *SyntaxError {
+	s := &p.state
+	inKey := false
+	if n := len(s.stack); n > 0 {
+		top := s.stack[n-1]
+		if top.key && top.remaining == 0 {
+			if err := p.expect('}', "for array"); err != nil {
+				return err
+			}
+			s.stack = s.stack[:n-1]
+			p.complete()
+			return nil
+		}
+		inKey = top.key
+	}
+
+	start := s.pos
+	if start >= len(p.data) {
+		return unexpectedEOF(start, "value")
+	}
+	typeChar := p.data[start]
+	if inKey && typeChar != 'i' && typeChar != 's' {
+		return keyTypeError(start, typeChar)
+	}
+	s.pos++
+
+	switch typeChar {
+	case 'N':
+		if err := p.expect(';', "after NULL"); err != nil {
+			return err
+		}
+	case 'b', 'i', 'd', 'r', 'R':
+		if err := p.expect(':', fmt.Sprintf("after type '%c'", typeChar)); err != nil {
+			return err
+		}
+		token, err := p.until(';')
+		if err != nil {
+			return err
+		}
+		if !validScalar(typeChar, token) {
+			return invalidError(s.pos, "value", token)
+		}
+	case 's':
+		declared, err := p.length()
+		if err != nil {
+			return err
+		}
+		if err := p.expect('"', "before string"); err != nil {
+			return err
+		}
+		contentStart := s.pos
+		end := contentStart + declared
+		state := repairState{pos: start, stack: append([]repairFrame(nil), s.stack...), fixes: len(p.fixes)}
+		choice := newRepairChoice(state, start, declared, contentStart, len(p.data))
+		if end+1 >= len(p.data) || p.data[end] != '"' || p.data[end+1] != ';' {
+			// The declared length is wrong, take the nearest terminator
+			var ok bool
+			if end, ok = choice.next(p.data); !ok {
+				return unexpectedEOF(len(p.data), `'";'`)
+			}
+		}
+		if !p.greedy {
+			p.choices = append(p.choices, choice)
+		}
+		p.takeString(start, declared, contentStart, end)
+		return nil
+	case 'a':
+		if err := p.expect(':', "after type 'a'"); err != nil {
+			return err
+		}
+		return p.open()
+	case 'O', 'C', 'E':
+		if err := p.className(); err != nil {
+			return err
+		}
+		if typeChar == 'E' {
+			if err := p.expect(';', "after enum"); err != nil {
+				return err
+			}
+			break
+		}
+		if err := p.expect(':', "after class name"); err != nil {
+			return err
+		}
+		if typeChar == 'O' {
+			return p.open()
+		}
+		n, err := p.count(':')
+		if err != nil {
+			return err
+		}
+		if err := p.expect('{', "for custom object payload"); err != nil {
+			return err
+		}
+		if s.pos+n >= len(p.data) {
+			return unexpectedEOF(len(p.data), fmt.Sprintf("%d bytes", n))
+		}
+		s.pos += n
+		if err := p.expect('}', "for custom object"); err != nil {
+			return err
+		}
+	default:
+		return unknownTypeError(start, typeChar)
+	}
+	p.complete()
+	return nil
+}
+
+// open reads "count:{" and starts an array or object
+func (p *repairParser) open() *SyntaxError {
+	n, err := p.count(':')
+	if err != nil {
+		return err
+	}
+	if err := p.expect('{', "for array"); err != nil {
+		return err
+	}
+	p.state.stack = append(p.state.stack, repairFrame{remaining: n, key: true})
+	return nil
+}
+
+// className reads `:len:"name"` for objects, custom objects and enums
+func (p *repairParser) className() *SyntaxError {
+	n, err := p.length()
+	if err != nil {
+		return err
+	}
+	if err := p.expect('"', "before class name"); err != nil {
+		return err
+	}
+	if p.state.pos+n > len(p.data) {
+		return unexpectedEOF(len(p.data), fmt.Sprintf("%d bytes", n))
+	}
+	p.state.pos += n
+	return p.expect('"', "after class name")
+}
+
+// length reads "n:" after a type character
+func (p *repairParser) length() (int, *SyntaxError) {
+	if err := p.expect(':', "after type"); err != nil {
+		return 0, err
+	}
+	return p.count(':')
+}
+
+// count reads a non-negative decimal number terminated by delim
+func (p *repairParser) count(delim byte) (int, *SyntaxError) {
+	token, err := p.until(delim)
+	if err != nil {
+		return 0, err
+	}
+	n, convErr := strconv.Atoi(token)
+	if convErr != nil || n < 0 {
+		return 0, invalidError(p.state.pos, "length", token)
+	}
+	return n, nil
+}
+
+func (p *repairParser) until(delim byte) (string, *SyntaxError) {
+	start := p.state.pos
+	n := strings.IndexByte(p.data[start:], delim)
+	if n < 0 {
+		return "", unexpectedEOF(len(p.data), fmt.Sprintf("'%c'", delim))
+	}
+	p.state.pos += n + 1
+	return p.data[start : start+n], nil
+}
+
+func (p *repairParser) expect(c byte, where string) *SyntaxError {
+	pos := p.state.pos
+	if pos >= len(p.data) {
+		return unexpectedEOF(pos, fmt.Sprintf("'%c'", c))
+	}
+	if p.data[pos] != c {
+		return expectError(pos, fmt.Sprintf("'%c'", c), where, p.data[pos])
+	}
+	p.state.pos++
+	return nil
+}
+
+// validScalar checks the text of a bool, integer, float or reference
+func validScalar(typeChar byte, token string) bool {
+	switch typeChar {
+	case 'b':
+		return token == "0" || token == "1"
+	case 'd':
+		switch token {
+		case "INF", "-INF", "NAN":
+			return true
+		}
+		_, err := strconv.ParseFloat(token, 64)
+		return err == nil
+	}
+	_, err := strconv.ParseInt(token, 10, 64)
+	return err == nil
+}
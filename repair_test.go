@@ -0,0 +1,125 @@
+package phpserialize
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestRepair tests fixing string lengths after a search-and-replace
+func TestRepair(t *testing.T) {
+	original := MustMarshal(map[string]interface{}{
+		"siteurl": "http://old.example",
+		"widgets": []interface{}{"<a href=\"http://old.example/\";>home</a>", int64(3)},
+	}, WithKeyOrder(KeyOrderSorted))
+	corrupted := strings.ReplaceAll(original, "old.example", "new-site.example.org")
+	want := strings.ReplaceAll(original, "old.example", "new-site.example.org")
+	want = strings.Replace(want, "s:18:", "s:27:", 1)
+	want = strings.Replace(want, "s:39:", "s:48:", 1)
+
+	if _, err := Unmarshal(corrupted); err == nil {
+		t.Fatal("Expected corrupted data to fail Unmarshal")
+	}
+
+	repaired, fixes, err := Repair(corrupted)
+	if err != nil {
+		t.Fatalf("Repair failed: %v", err)
+	}
+	if repaired != want {
+		t.Errorf("Expected %s, got %s", want, repaired)
+	}
+	wantFixes := []Fix{
+		{Offset: strings.Index(corrupted, "s:18:"), Declared: 18, Actual: 27},
+		{Offset: strings.Index(corrupted, "s:39:"), Declared: 39, Actual: 48},
+	}
+	if !reflect.DeepEqual(fixes, wantFixes) {
+		t.Errorf("Expected fixes %+v, got %+v", wantFixes, fixes)
+	}
+	if _, err := Unmarshal(repaired); err != nil {
+		t.Errorf("Repaired data does not unmarshal: %v", err)
+	}
+}
+
+// TestRepairCases tests valid input, nested serialized strings and failures
+func TestRepairCases(t *testing.T) {
+	tests := []struct {
+		name  string
+		data  string
+		want  string
+		fixes int
+	}{
+		{"valid", `a:2:{i:0;s:4:"a";b";i:1;O:1:"A":1:{s:1:"x";d:1.5;}}`, `a:2:{i:0;s:4:"a";b";i:1;O:1:"A":1:{s:1:"x";d:1.5;}}`, 0},
+		{"shorter", `s:10:"abc";`, `s:3:"abc";`, 1},
+		{"key", `a:1:{s:2:"name";i:1;}`, `a:1:{s:4:"name";i:1;}`, 1},
+		{"multibyte", `s:1:"héllo";`, `s:6:"héllo";`, 1},
+		{"nested serialized", `a:1:{s:3:"opt";s:20:"a:1:{s:3:"url";s:4:"https";}";}`, `a:1:{s:3:"opt";s:28:"a:1:{s:3:"url";s:5:"https";}";}`, 2},
+		{"nested length only", `a:1:{s:1:"u";s:5:"a:1:{i:0;s:3:"abcdef";}";}`, `a:1:{s:1:"u";s:23:"a:1:{i:0;s:6:"abcdef";}";}`, 2},
+		{"nested width", `s:20:"a:1:{i:0;s:9:"0123456789";}";`, `s:28:"a:1:{i:0;s:10:"0123456789";}";`, 2},
+		{"nested valid", `a:1:{i:0;s:22:"a:1:{i:0;s:5:"plain";}";}`, `a:1:{i:0;s:22:"a:1:{i:0;s:5:"plain";}";}`, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, fixes, err := Repair(tt.data)
+			if err != nil {
+				t.Fatalf("Repair failed: %v", err)
+			}
+			if got != tt.want || len(fixes) != tt.fixes {
+				t.Errorf("Expected %s with %d fixes, got %s with %+v", tt.want, tt.fixes, got, fixes)
+			}
+		})
+	}
+
+	// Fixes inside a serialized string are reported at their offset in data
+	data := `a:1:{s:1:"u";s:5:"a:1:{i:0;s:3:"abcdef";}";}`
+	repaired, fixes, err := Repair(data)
+	if err != nil {
+		t.Fatalf("Repair failed: %v", err)
+	}
+	wantFixes := []Fix{{Offset: 13, Declared: 5, Actual: 23}, {Offset: 27, Declared: 3, Actual: 6}}
+	if !reflect.DeepEqual(fixes, wantFixes) {
+		t.Errorf("Expected fixes %+v, got %+v", wantFixes, fixes)
+	}
+	inner, err := Get(repaired, "u")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Unmarshal(inner.(string)); err != nil {
+		t.Errorf("Repaired nested data does not unmarshal: %v", err)
+	}
+
+	// A string whose declared length ends at a `";` is still re-measured when
+	// the rest cannot parse otherwise. Here the only valid reading takes the
+	// second entry into the first string, as the array holds one entry.
+	repaired, fixes, err = Repair(`a:1:{i:0;s:1:"a";s:1:"b";}`)
+	if err != nil {
+		t.Fatalf("Repair failed: %v", err)
+	}
+	if want := `a:1:{i:0;s:9:"a";s:1:"b";}`; repaired != want {
+		t.Errorf("Expected %s, got %s", want, repaired)
+	}
+	if want := []Fix{{Offset: 9, Declared: 1, Actual: 9}}; !reflect.DeepEqual(fixes, want) {
+		t.Errorf("Expected fixes %+v, got %+v", want, fixes)
+	}
+
+	// A nested value that cannot be repaired fails the whole repair
+	_, _, err = Repair(`a:1:{i:0;s:9:"a:1:{i:0;";}`)
+	var nested *SyntaxError
+	if !errors.As(err, &nested) {
+		t.Errorf("Expected SyntaxError for broken nested data, got %v", err)
+	} else if nested.Offset < 14 {
+		t.Errorf("Expected the offset inside the string, got %d", nested.Offset)
+	}
+
+	// Both `";` could end the first string
+	_, _, err = Repair(`a:2:{i:0;s:1:"x";i:1;s:1:"y";i:1;s:1:"z";}`)
+	if !errors.Is(err, ErrAmbiguousRepair) {
+		t.Errorf("Expected ErrAmbiguousRepair, got %v", err)
+	}
+
+	_, _, err = Repair(`a:1:{i:0;s:3:"abc"}`)
+	var se *SyntaxError
+	if !errors.As(err, &se) {
+		t.Errorf("Expected SyntaxError, got %v", err)
+	}
+}
@@ -0,0 +1,456 @@
+package phpserialize
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// replaceKeysOption implements Option for rewriting array keys and property names
+type replaceKeysOption struct {
+	enabled bool
+}
+
+func (o replaceKeysOption) applyMarshal(*marshalConfig) {
+	// No effect on marshal
+}
+
+func (o replaceKeysOption) applyUnmarshal(cfg *unmarshalConfig) {
+	cfg.replaceKeys = o.enabled
+}
+
+// replaceClassNamesOption implements Option for rewriting class names
+type replaceClassNamesOption struct {
+	enabled bool
+}
+
+func (o replaceClassNamesOption) applyMarshal(*marshalConfig) {
+	// No effect on marshal
+}
+
+func (o replaceClassNamesOption) applyUnmarshal(cfg *unmarshalConfig) {
+	cfg.replaceClassNames = o.enabled
+}
+
+// WithReplaceKeys makes ReplaceStrings also rewrite string array keys and
+// property names. Integer keys are never changed.
+func WithReplaceKeys(enabled bool) Option {
+	return replaceKeysOption{enabled: enabled}
+}
+
+// WithReplaceClassNames makes ReplaceStrings also rewrite the class names of
+// objects, custom objects and enum cases, along with the class that private
+// property names are mangled with
+func WithReplaceClassNames(enabled bool) Option {
+	return replaceClassNamesOption{enabled: enabled}
+}
+
+// ReplaceStrings replaces every occurrence of old with new inside the string
+// values of serialized data, updating each `s:<length>:` prefix to match.
+// Strings that hold serialized data themselves, as WordPress options often
+// do, are rewritten recursively so their inner lengths stay correct too.
+// Structure, numbers and references are copied unchanged; keys and class names
+// are only rewritten with WithReplaceKeys and WithReplaceClassNames.
+// The payloads of C: objects are rewritten only when they hold a single
+// serialized value, since their format is otherwise defined by the class.
+// The data must be valid; use Repair first on data that was already damaged
+// by a plain search-and-replace.
+func ReplaceStrings(data string, old, new string, options ...Option) (string, error) {
+	if old == "" {
+		return data, nil
+	}
+	return ReplaceStringsFunc(data, func(s string) string {
+		return strings.ReplaceAll(s, old, new)
+	}, options...)
+}
+
+// ReplaceStringsRegexp is like ReplaceStrings, replacing the matches of re
+// with repl as regexp.Regexp.ReplaceAllString does, so repl may refer to
+// submatches with $1 or ${name}
+func ReplaceStringsRegexp(data string, re *regexp.Regexp, repl string, options ...Option) (string, error) {
+	return ReplaceStringsFunc(data, func(s string) string {
+		return re.ReplaceAllString(s, repl)
+	}, options...)
+}
+
+// ReplaceStringsFunc is like ReplaceStrings, replacing each string with the
+// result of calling replace on it. Nested serialized strings are walked
+// instead of being passed to replace whole.
+func ReplaceStringsFunc(data string, replace func(string) string, options ...Option) (string, error) {
+	config := newUnmarshalConfig(options)
+	if config.versionErr != nil {
+		return "", config.versionErr
+	}
+	rp := &stringReplacer{replace: replace, cfg: config}
+	out, err := rp.document(data, 0)
+	if err != nil {
+		return "", config.finishError(err, len(data))
+	}
+	return out, nil
+}
+
+// stringReplacer copies serialized data, passing the strings it holds through
+// replace
+type stringReplacer struct {
+	replace func(string) string
+	cfg     *unmarshalConfig
+}
+
+// document rewrites data, which must hold exactly one serialized value
+func (rp *stringReplacer) document(data string, depth int) (string, error) {
+	r := &stringReader{data: data, pos: 0}
+	var buf bytes.Buffer
+	buf.Grow(len(data))
+	if err := rp.value(r, &buf, depth); err != nil {
+		return "", err
+	}
+	if r.pos != len(data) {
+		return "", syntaxError(r.pos, "unexpected data after value")
+	}
+	return buf.String(), nil
+}
+
+// text returns the replacement for the contents of a string value
+func (rp *stringReplacer) text(s string, depth int) string {
+	out, _ := rp.parseText(s, depth)
+	return out
+}
+
+// parseText is like text, also returning the error that made it replace s as
+// plain text although it looked serialized
+func (rp *stringReplacer) parseText(s string, depth int) (string, error) {
+	if !looksSerialized(s) {
+		return rp.replace(s), nil
+	}
+	out, err := rp.document(s, depth+1)
+	if err != nil {
+		return rp.replace(s), err
+	}
+	return out, nil
+}
+
+// looksSerialized reports whether s could start a serialized value, which
+// keeps ordinary text from being parsed
+func looksSerialized(s string) bool {
+	if s == "N;" {
+		return true
+	}
+	if len(s) < 4 || strings.IndexByte("bidsaOCE", s[0]) < 0 || s[1] != ':' {
+		return false
+	}
+	last := s[len(s)-1]
+	return last == ';' || last == '}'
+}
+
+// value copies the next value from r to buf, rewriting the strings it holds
+func (rp *stringReplacer) value(r *stringReader, buf *bytes.Buffer, depth int) (err error) {
+	if rp.cfg.maxDepth > 0 && depth >= rp.cfg.maxDepth {
+		return maxDepthError(r.pos, rp.cfg.maxDepth)
+	}
+
+	start := r.pos
+	defer func() {
+		if err != nil {
+			markValueStart(err, start)
+		}
+	}()
+
+	typeChar, err := r.read()
+	if err != nil {
+		return err
+	}
+	if !strings.ContainsRune("NbirRdsaOCE", rune(typeChar)) {
+		return unknownTypeError(start, typeChar)
+	}
+	if typeChar == 'N' {
+		semicolon, err := r.read()
+		if err != nil {
+			return err
+		}
+		if semicolon != ';' {
+			return expectError(r.pos-1, "';'", "after NULL", semicolon)
+		}
+		buf.WriteString("N;")
+		return nil
+	}
+	colon, err := r.read()
+	if err != nil {
+		return err
+	}
+	if colon != ':' {
+		return expectError(r.pos-1, "':'", fmt.Sprintf("after type '%c'", typeChar), colon)
+	}
+
+	switch typeChar {
+	case 'b', 'i', 'd', 'r', 'R':
+		token, err := r.readUntil(';')
+		if err != nil {
+			return err
+		}
+		if !validScalar(typeChar, token) {
+			return invalidError(r.pos, "value", token)
+		}
+		buf.WriteString(r.slice(start, r.pos))
+		return nil
+
+	case 's':
+		str, err := readQuoted(r, "string", ';')
+		if err != nil {
+			return err
+		}
+		writeString(buf, rp.text(str, depth))
+		return nil
+
+	case 'a':
+		count, err := readCount(r, "array count", "array")
+		if err != nil {
+			return err
+		}
+		buf.WriteString(r.slice(start, r.pos))
+		return rp.entries(r, buf, depth, count, "array", false)
+
+	case 'O', 'C':
+		className, err := readClassName(r, rp.cfg, typeChar)
+		if err != nil {
+			return err
+		}
+		if rp.cfg.replaceClassNames {
+			className = rp.replace(className)
+		}
+		buf.WriteByte(typeChar)
+		buf.WriteByte(':')
+		writeQuoted(buf, className)
+		buf.WriteByte(':')
+
+		if typeChar == 'O' {
+			count, err := readCount(r, "property count", "object properties")
+			if err != nil {
+				return err
+			}
+			buf.WriteString(strconv.Itoa(count))
+			buf.WriteString(":{")
+			return rp.entries(r, buf, depth, count, "object", true)
+		}
+
+		payload, err := readPayload(r)
+		if err != nil {
+			return err
+		}
+		if looksSerialized(payload) {
+			if out, err := rp.document(payload, depth+1); err == nil {
+				payload = out
+			}
+		}
+		buf.WriteString(strconv.Itoa(len(payload)))
+		buf.WriteByte(':')
+		buf.WriteByte('{')
+		buf.WriteString(payload)
+		buf.WriteByte('}')
+		return nil
+
+	default: // 'E'
+		name, err := readQuoted(r, "enum name", ';')
+		if err != nil {
+			return err
+		}
+		className, caseName, found := strings.Cut(name, ":")
+		if !found || className == "" || caseName == "" {
+			return syntaxError(start, "invalid enum name %q", name)
+		}
+		if rp.cfg.replaceClassNames {
+			name = rp.replace(className) + ":" + caseName
+		}
+		buf.WriteString("E:")
+		writeQuoted(buf, name)
+		buf.WriteByte(';')
+		return nil
+	}
+}
+
+// entries copies the key/value pairs of an array or object and its closing brace
+func (rp *stringReplacer) entries(r *stringReader, buf *bytes.Buffer, depth, count int, body string, object bool) error {
+	for i := 0; i < count; i++ {
+		key, err := rp.key(r, buf, object)
+		if err != nil {
+			return err
+		}
+		if err := rp.value(r, buf, depth+1); err != nil {
+			if object {
+				return prependPath(err, bareName(keyString(key)))
+			}
+			return prependPath(err, key)
+		}
+	}
+	brace, err := r.read()
+	if err != nil {
+		return err
+	}
+	if brace != '}' {
+		return expectError(r.pos-1, "'}'", "for "+body, brace)
+	}
+	buf.WriteByte('}')
+	return nil
+}
+
+// key copies an array key or property name, returning it for error paths.
+// The declaring class of a private property is renamed with the class names,
+// so the property still belongs to the renamed class.
+func (rp *stringReplacer) key(r *stringReader, buf *bytes.Buffer, object bool) (interface{}, error) {
+	start := r.pos
+	key, err := readKey(r)
+	if err != nil {
+		return nil, err
+	}
+	str, ok := key.(string)
+	switch {
+	case !ok || !rp.cfg.replaceKeys && !(object && rp.cfg.replaceClassNames):
+		buf.WriteString(r.slice(start, r.pos))
+	case object:
+		name, visibility, class := ParsePropertyName(str)
+		if rp.cfg.replaceKeys {
+			name = rp.replace(name)
+		}
+		if visibility == Private && rp.cfg.replaceClassNames {
+			class = rp.replace(class)
+		}
+		writeString(buf, PropertyName(name, visibility, class))
+	default:
+		writeString(buf, rp.replace(str))
+	}
+	return key, nil
+}
+
+// readKey reads an array key or property name without numbering it
+func readKey(r *stringReader) (interface{}, error) {
+	n, str, isInt, err := scanKey(r)
+	if err != nil {
+		return nil, err
+	}
+	if isInt {
+		return n, nil
+	}
+	return str, nil
+}
+
+// scanKey is readKey without the allocation of an interface value
+func scanKey(r *stringReader) (n int64, str string, isInt bool, err error) {
+	start := r.pos
+	typeChar, err := r.read()
+	if err != nil {
+		return 0, "", false, err
+	}
+	if typeChar != 'i' && typeChar != 's' {
+		return 0, "", false, keyTypeError(start, typeChar)
+	}
+	colon, err := r.read()
+	if err != nil {
+		return 0, "", false, err
+	}
+	if colon != ':' {
+		return 0, "", false, expectError(r.pos-1, "':'", fmt.Sprintf("after type '%c'", typeChar), colon)
+	}
+
+	if typeChar == 'i' {
+		token, err := r.readUntil(';')
+		if err != nil {
+			return 0, "", false, err
+		}
+		n, err := strconv.ParseInt(token, 10, 64)
+		if err != nil {
+			return 0, "", false, invalidError(r.pos, "integer", token)
+		}
+		return n, "", true, nil
+	}
+	str, err = readQuoted(r, "string", ';')
+	return 0, str, false, err
+}
+
+// readQuoted reads the `len:"contents"` part of a string or enum name and the
+// terminator that follows it
+func readQuoted(r *stringReader, what string, terminator byte) (string, error) {
+	lenStr, err := r.readUntil(':')
+	if err != nil {
+		return "", err
+	}
+	length, err := strconv.Atoi(lenStr)
+	if err != nil {
+		return "", invalidError(r.pos, what+" length", lenStr)
+	}
+	if length < 0 {
+		return "", syntaxError(r.pos, "negative %s length: %d", what, length)
+	}
+	quote, err := r.read()
+	if err != nil {
+		return "", err
+	}
+	if quote != '"' {
+		return "", expectError(r.pos-1, "'\"'", "before "+what, quote)
+	}
+	str, err := r.readBytes(length)
+	if err != nil {
+		return "", err
+	}
+	quote, err = r.read()
+	if err != nil {
+		return "", err
+	}
+	if quote != '"' {
+		return "", expectError(r.pos-1, "'\"'", "after "+what, quote)
+	}
+	end, err := r.read()
+	if err != nil {
+		return "", err
+	}
+	if end != terminator {
+		return "", expectError(r.pos-1, fmt.Sprintf("'%c'", terminator), "after "+what, end)
+	}
+	return str, nil
+}
+
+// readPayload reads the `len:{payload}` part of a custom object
+func readPayload(r *stringReader) (string, error) {
+	dataLenStr, err := r.readUntil(':')
+	if err != nil {
+		return "", err
+	}
+	dataLen, err := strconv.Atoi(dataLenStr)
+	if err != nil || dataLen < 0 {
+		return "", invalidError(r.pos, "payload length", dataLenStr)
+	}
+	brace, err := r.read()
+	if err != nil {
+		return "", err
+	}
+	if brace != '{' {
+		return "", expectError(r.pos-1, "'{'", "for custom object payload", brace)
+	}
+	payload, err := r.readBytes(dataLen)
+	if err != nil {
+		return "", err
+	}
+	brace, err = r.read()
+	if err != nil {
+		return "", err
+	}
+	if brace != '}' {
+		return "", expectError(r.pos-1, "'}'", "for custom object", brace)
+	}
+	return payload, nil
+}
+
+// writeString writes a complete string value
+func writeString(buf *bytes.Buffer, s string) {
+	buf.WriteString("s:")
+	writeQuoted(buf, s)
+	buf.WriteByte(';')
+}
+
+// writeQuoted writes the `len:"contents"` form shared by strings and names
+func writeQuoted(buf *bytes.Buffer, s string) {
+	buf.WriteString(strconv.Itoa(len(s)))
+	buf.WriteString(`:"`)
+	buf.WriteString(s)
+	buf.WriteByte('"')
+}
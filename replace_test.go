@@ -0,0 +1,94 @@
+package phpserialize
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// TestReplaceStrings tests replacing inside strings with length fixing
+func TestReplaceStrings(t *testing.T) {
+	const url, newURL = "http://old.example", "https://new.example.org"
+	const host, newHost = "old.example", "new.example.org"
+	tests := []struct {
+		name     string
+		data     string
+		old, new string
+		options  []Option
+		want     string
+	}{
+		{"string", `s:18:"http://old.example";`, url, newURL, nil, `s:23:"https://new.example.org";`},
+		{"untouched", `a:2:{i:0;i:5;i:1;d:1.5;}`, "5", "6", nil, `a:2:{i:0;i:5;i:1;d:1.5;}`},
+		{"values only", `a:1:{s:11:"old.example";s:11:"old.example";}`, host, newHost, nil,
+			`a:1:{s:11:"old.example";s:15:"new.example.org";}`},
+		{"keys", `a:1:{s:11:"old.example";s:11:"old.example";}`, host, newHost, []Option{WithReplaceKeys(true)},
+			`a:1:{s:15:"new.example.org";s:15:"new.example.org";}`},
+		{"object", `O:11:"old.example":1:{s:3:"url";s:18:"http://old.example";}`, url, newURL, nil,
+			`O:11:"old.example":1:{s:3:"url";s:23:"https://new.example.org";}`},
+		{"class names", `a:2:{i:0;O:11:"old.example":0:{}i:1;E:15:"old.example:Foo";}`, host, newHost, []Option{WithReplaceClassNames(true)},
+			`a:2:{i:0;O:15:"new.example.org":0:{}i:1;E:19:"new.example.org:Foo";}`},
+		{"private property class", "O:11:\"old.example\":2:{s:15:\"\x00old.example\x00id\";i:1;s:5:\"\x00*\x00id\";i:2;}", host, newHost,
+			[]Option{WithReplaceClassNames(true)},
+			"O:15:\"new.example.org\":2:{s:19:\"\x00new.example.org\x00id\";i:1;s:5:\"\x00*\x00id\";i:2;}"},
+		{"private property name", "O:1:\"A\":1:{s:14:\"\x00A\x00old.example\";i:1;}", host, newHost,
+			[]Option{WithReplaceKeys(true)}, "O:1:\"A\":1:{s:18:\"\x00A\x00new.example.org\";i:1;}"},
+		{"nested serialized", `a:1:{s:3:"opt";s:42:"a:1:{s:3:"url";s:18:"http://old.example";}";}`, url, newURL, nil,
+			`a:1:{s:3:"opt";s:47:"a:1:{s:3:"url";s:23:"https://new.example.org";}";}`},
+		{"custom payload", `C:3:"Foo":26:{s:18:"http://old.example";}`, url, newURL, nil,
+			`C:3:"Foo":31:{s:23:"https://new.example.org";}`},
+		{"custom payload format", `C:3:"Foo":21:{x:s:11:"old.example";}`, host, newHost, nil, `C:3:"Foo":21:{x:s:11:"old.example";}`},
+		{"references", `a:2:{i:0;s:11:"old.example";i:1;R:2;}`, host, newHost, nil, `a:2:{i:0;s:15:"new.example.org";i:1;R:2;}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ReplaceStrings(tt.data, tt.old, tt.new, tt.options...)
+			if err != nil {
+				t.Fatalf("ReplaceStrings failed: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Expected %s, got %s", tt.want, got)
+			}
+			if _, err := Unmarshal(got); err != nil {
+				t.Errorf("Result does not unmarshal: %v", err)
+			}
+		})
+	}
+}
+
+// TestReplaceStringsVariants tests the regexp and callback variants
+func TestReplaceStringsVariants(t *testing.T) {
+	data := MustMarshal([]interface{}{"user-12", "user-345", int64(7)})
+
+	got, err := ReplaceStringsRegexp(data, regexp.MustCompile(`user-(\d+)`), "member:$1")
+	if err != nil {
+		t.Fatalf("ReplaceStringsRegexp failed: %v", err)
+	}
+	if want := `a:3:{i:0;s:9:"member:12";i:1;s:10:"member:345";i:2;i:7;}`; got != want {
+		t.Errorf("Expected %s, got %s", want, got)
+	}
+
+	got, err = ReplaceStringsFunc(data, strings.ToUpper)
+	if err != nil {
+		t.Fatalf("ReplaceStringsFunc failed: %v", err)
+	}
+	if want := `a:3:{i:0;s:7:"USER-12";i:1;s:8:"USER-345";i:2;i:7;}`; got != want {
+		t.Errorf("Expected %s, got %s", want, got)
+	}
+}
+
+// TestReplaceStringsInvalid tests that invalid data is rejected
+func TestReplaceStringsInvalid(t *testing.T) {
+	_, err := ReplaceStrings(`a:1:{s:3:"url";s:20:"http://old.example";}`, "old", "new")
+	var syntaxErr *SyntaxError
+	if !errors.As(err, &syntaxErr) {
+		t.Fatalf("Expected a SyntaxError, got %v", err)
+	}
+	if syntaxErr.Path != "url" {
+		t.Errorf("Expected path url, got %q", syntaxErr.Path)
+	}
+
+	if _, err := ReplaceStrings(`i:1;i:2;`, "1", "2"); err == nil {
+		t.Error("Expected error for trailing data")
+	}
+}
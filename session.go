@@ -0,0 +1,207 @@
+package phpserialize
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// SessionHandler names a PHP session.serialize_handler format
+type SessionHandler string
+
+const (
+	// SessionPHP is PHP's default format: name|<serialized>name2|<serialized>
+	SessionPHP SessionHandler = "php"
+	// SessionPHPBinary prefixes each name with its length as a single byte
+	SessionPHPBinary SessionHandler = "php_binary"
+	// SessionPHPSerialize stores $_SESSION as one serialized array
+	SessionPHPSerialize SessionHandler = "php_serialize"
+)
+
+const (
+	sessionUndefMarker = '!'  // php handler: "!name|" marks an undefined variable
+	sessionBinUndef    = 0x80 // php_binary handler: length byte flag for an undefined variable
+	sessionBinMaxName  = 0x7f // php_binary handler: longest variable name
+)
+
+// DecodeSession decodes PHP session data written with the given handler into
+// the session variables, in the order they were stored. Like PHP, variables
+// marked as undefined ("!name|" or the php_binary flag) are present with a nil value.
+// All variables share one reference table, so R: and r: may point across them.
+func DecodeSession(data string, handler SessionHandler, options ...Option) (PHPArray, error) {
+	config := newUnmarshalConfig(options)
+	if config.versionErr != nil {
+		return nil, config.versionErr
+	}
+	reader := &stringReader{data: data, pos: 0}
+
+	var session PHPArray
+	var err error
+	switch handler {
+	case SessionPHP:
+		session, err = decodeSessionPHP(reader, config)
+	case SessionPHPBinary:
+		session, err = decodeSessionBinary(reader, config)
+	case SessionPHPSerialize:
+		session, err = decodeSessionSerialize(reader, config)
+	default:
+		return nil, fmt.Errorf("unknown session handler %q", handler)
+	}
+	if err != nil {
+		return nil, config.finishError(err, len(data))
+	}
+	return session, nil
+}
+
+// decodeSessionPHP reads name|value pairs until the end of the data
+func decodeSessionPHP(r *stringReader, cfg *unmarshalConfig) (PHPArray, error) {
+	session := PHPArray{}
+	for r.pos < r.end() {
+		bar := strings.IndexByte(r.data[r.pos:], '|')
+		if bar < 0 {
+			return nil, unexpectedEOF(r.end(), "'|'")
+		}
+		name := r.data[r.pos : r.pos+bar]
+		r.pos += bar + 1
+
+		if len(name) > 0 && name[0] == sessionUndefMarker {
+			session = addSessionVar(session, name[1:])
+			continue
+		}
+		value, err := unmarshalValue(r, cfg, 0)
+		if err != nil {
+			return nil, prependPath(err, name)
+		}
+		session = setSessionVar(session, name, value)
+	}
+	return session, nil
+}
+
+// decodeSessionBinary reads length-prefixed names, each followed by a value
+func decodeSessionBinary(r *stringReader, cfg *unmarshalConfig) (PHPArray, error) {
+	session := PHPArray{}
+	for r.pos < r.end() {
+		prefix, _ := r.read()
+		length := int(prefix &^ sessionBinUndef)
+		name, err := r.readBytes(length)
+		if err != nil {
+			return nil, err
+		}
+
+		if prefix&sessionBinUndef != 0 {
+			session = addSessionVar(session, name)
+			continue
+		}
+		value, err := unmarshalValue(r, cfg, 0)
+		if err != nil {
+			return nil, prependPath(err, name)
+		}
+		session = setSessionVar(session, name, value)
+	}
+	return session, nil
+}
+
+// decodeSessionSerialize reads the single array holding all variables
+func decodeSessionSerialize(r *stringReader, cfg *unmarshalConfig) (PHPArray, error) {
+	if r.end() == 0 {
+		return PHPArray{}, nil
+	}
+
+	typeChar, err := r.read()
+	if err != nil {
+		return nil, err
+	}
+	if typeChar != 'a' {
+		return nil, expectError(0, "'a'", "for session array", typeChar)
+	}
+	colon, err := r.read()
+	if err != nil {
+		return nil, err
+	}
+	if colon != ':' {
+		return nil, expectError(r.pos-1, "':'", "after type 'a'", colon)
+	}
+	count, err := readCount(r, "array count", "array")
+	if err != nil {
+		return nil, err
+	}
+
+	r.vars = append(r.vars, nil)
+	value, err := unmarshalOrderedArray(r, cfg, 0, 0, count)
+	if err != nil {
+		return nil, err
+	}
+	if r.pos != r.end() {
+		return nil, syntaxError(r.pos, "unexpected data after session array")
+	}
+	return value.(PHPArray), nil
+}
+
+// setSessionVar stores a variable, replacing an earlier one with the same name
+func setSessionVar(session PHPArray, name string, value interface{}) PHPArray {
+	for i, e := range session {
+		if e.Key == name {
+			session[i].Value = value
+			return session
+		}
+	}
+	return append(session, PHPArrayEntry{Key: name, Value: value})
+}
+
+// addSessionVar registers an undefined variable as nil unless it is already set
+func addSessionVar(session PHPArray, name string) PHPArray {
+	for _, e := range session {
+		if e.Key == name {
+			return session
+		}
+	}
+	return append(session, PHPArrayEntry{Key: name, Value: nil})
+}
+
+// EncodeSession encodes session variables in the format of the given handler,
+// with the same options as Marshal. Variable names must be strings for the php
+// and php_binary handlers; PHP cannot store names containing '|' or '!' with
+// the php handler, nor names longer than 127 bytes with php_binary.
+// Undefined markers are never written: a variable DecodeSession read from one
+// holds nil and is written as NULL, which is what PHP 7 and later do too.
+func EncodeSession(session PHPArray, handler SessionHandler, options ...Option) (string, error) {
+	config := newMarshalConfig(options)
+	if config.versionErr != nil {
+		return "", config.versionErr
+	}
+
+	var buf bytes.Buffer
+	buf.Grow(256)
+	switch handler {
+	case SessionPHP, SessionPHPBinary:
+		for _, e := range session {
+			name, ok := e.Key.(string)
+			if !ok {
+				return "", fmt.Errorf("session variable name %v is not a string", e.Key)
+			}
+			if handler == SessionPHP {
+				if strings.ContainsAny(name, "|!") {
+					return "", fmt.Errorf("session variable name %q contains '|' or '!'", name)
+				}
+				buf.WriteString(name)
+				buf.WriteByte('|')
+			} else {
+				if len(name) > sessionBinMaxName {
+					return "", fmt.Errorf("session variable name %q exceeds %d bytes", name, sessionBinMaxName)
+				}
+				buf.WriteByte(byte(len(name)))
+				buf.WriteString(name)
+			}
+			if err := marshalValue(&buf, e.Value, config, 0); err != nil {
+				return "", err
+			}
+		}
+	case SessionPHPSerialize:
+		if err := marshalValue(&buf, session, config, 0); err != nil {
+			return "", err
+		}
+	default:
+		return "", fmt.Errorf("unknown session handler %q", handler)
+	}
+	return buf.String(), nil
+}
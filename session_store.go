@@ -0,0 +1,286 @@
+package phpserialize
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SessionStore reads and writes PHP session files the way ext/session's
+// "files" save handler does, so Go and PHP code can share sessions.
+type SessionStore struct {
+	Path       string         // directory holding the session files
+	Depth      int            // levels of subdirectories named after the first characters of the ID, which must exist
+	Mode       fs.FileMode    // permissions of new session files
+	Handler    SessionHandler // session.serialize_handler of the PHP side
+	CookieName string         // session cookie used by Middleware, PHPSESSID by default
+	ErrorLog   *log.Logger    // logs sessions Middleware fails to save; the log package's standard logger if nil
+
+	options []Option
+}
+
+// NewSessionStore returns a store for a session.save_path value, which is
+// either a directory or "N;[MODE;]/path" for a directory tree N levels deep.
+// An empty save path means the system temporary directory, like PHP.
+// The options are passed to DecodeSession and EncodeSession.
+func NewSessionStore(savePath string, handler SessionHandler, options ...Option) (*SessionStore, error) {
+	store := &SessionStore{
+		Path:       savePath,
+		Mode:       0600,
+		Handler:    handler,
+		CookieName: "PHPSESSID",
+		options:    options,
+	}
+
+	parts := strings.Split(savePath, ";")
+	if len(parts) > 3 {
+		return nil, fmt.Errorf("invalid session save path %q", savePath)
+	}
+	if len(parts) > 1 {
+		depth, err := strconv.Atoi(parts[0])
+		if err != nil || depth < 0 {
+			return nil, fmt.Errorf("invalid session save path depth %q", parts[0])
+		}
+		store.Depth = depth
+		store.Path = parts[len(parts)-1]
+	}
+	if len(parts) == 3 {
+		mode, err := strconv.ParseUint(parts[1], 8, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid session save path mode %q", parts[1])
+		}
+		store.Mode = fs.FileMode(mode)
+	}
+	if store.Path == "" {
+		store.Path = os.TempDir()
+	}
+	return store, nil
+}
+
+// Session is an open session file. It is locked against other readers and
+// writers, PHP included, until Close is called.
+type Session struct {
+	ID   string
+	Vars PHPArray
+
+	store *SessionStore
+	file  *os.File
+	data  string // file contents when opened or last saved
+}
+
+// Open locks and reads the session file for id, creating an empty session if
+// the file does not exist. The caller must Close the session.
+func (s *SessionStore) Open(id string) (*Session, error) {
+	path, err := s.filename(id)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, s.Mode)
+	if err != nil {
+		return nil, err
+	}
+	if err := lockFile(file); err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		s.release(file)
+		return nil, err
+	}
+	vars, err := DecodeSession(string(data), s.Handler, s.options...)
+	if err != nil {
+		s.release(file)
+		return nil, fmt.Errorf("session %s: %w", id, err)
+	}
+	return &Session{ID: id, Vars: vars, store: s, file: file, data: string(data)}, nil
+}
+
+// Load returns the variables of the session with the given id
+func (s *SessionStore) Load(id string) (PHPArray, error) {
+	session, err := s.Open(id)
+	if err != nil {
+		return nil, err
+	}
+	return session.Vars, session.Close()
+}
+
+// Save replaces the variables of the session with the given id
+func (s *SessionStore) Save(id string, vars PHPArray) error {
+	session, err := s.Open(id)
+	if err != nil {
+		return err
+	}
+	session.Vars = vars
+	if err := session.Save(); err != nil {
+		session.Close()
+		return err
+	}
+	return session.Close()
+}
+
+// Exists reports whether a session file exists for id
+func (s *SessionStore) Exists(id string) bool {
+	path, err := s.filename(id)
+	if err != nil {
+		return false
+	}
+	_, err = os.Stat(path)
+	return err == nil
+}
+
+// Destroy removes the session file for id
+func (s *SessionStore) Destroy(id string) error {
+	path, err := s.filename(id)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// filename returns the path of the session file, validating id like PHP does
+// so that it cannot escape the save path
+func (s *SessionStore) filename(id string) (string, error) {
+	if id == "" || len(id) > 256 {
+		return "", fmt.Errorf("invalid session id %q", id)
+	}
+	for i := 0; i < len(id); i++ {
+		c := id[i]
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == ',' || c == '-') {
+			return "", fmt.Errorf("invalid session id %q", id)
+		}
+	}
+	if len(id) <= s.Depth {
+		return "", fmt.Errorf("session id %q is too short for save path depth %d", id, s.Depth)
+	}
+
+	dir := s.Path
+	for i := 0; i < s.Depth; i++ {
+		dir = filepath.Join(dir, id[i:i+1])
+	}
+	return filepath.Join(dir, "sess_"+id), nil
+}
+
+// release unlocks and closes a session file
+func (s *SessionStore) release(file *os.File) error {
+	unlockErr := unlockFile(file)
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return unlockErr
+}
+
+// Save writes the session variables back to the file. Like PHP's lazy_write,
+// unchanged data only updates the modification time, which PHP's garbage
+// collector uses to expire sessions.
+func (sess *Session) Save() error {
+	if sess.file == nil {
+		return fmt.Errorf("session %s is closed", sess.ID)
+	}
+	data, err := EncodeSession(sess.Vars, sess.store.Handler, sess.store.options...)
+	if err != nil {
+		return fmt.Errorf("session %s: %w", sess.ID, err)
+	}
+	if data == sess.data {
+		now := time.Now()
+		return os.Chtimes(sess.file.Name(), now, now)
+	}
+
+	if err := sess.file.Truncate(0); err != nil {
+		return err
+	}
+	if _, err := sess.file.WriteAt([]byte(data), 0); err != nil {
+		return err
+	}
+	sess.data = data
+	return nil
+}
+
+// Close unlocks the session file without saving
+func (sess *Session) Close() error {
+	if sess.file == nil {
+		return nil
+	}
+	file := sess.file
+	sess.file = nil
+	return sess.store.release(file)
+}
+
+type sessionContextKey struct{}
+
+// SessionFromContext returns the session opened by SessionStore.Middleware
+func SessionFromContext(ctx context.Context) *Session {
+	session, _ := ctx.Value(sessionContextKey{}).(*Session)
+	return session
+}
+
+// Middleware opens the session named by the session cookie for each request,
+// makes it available through SessionFromContext, and saves it after next
+// returns. Like PHP's session.use_strict_mode, an ID without a session file
+// is replaced by a new one, which is sent back in the cookie.
+// The session stays locked while next runs.
+func (s *SessionStore) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		var id string
+		if cookie, err := req.Cookie(s.CookieName); err == nil && s.Exists(cookie.Value) {
+			id = cookie.Value
+		} else {
+			var err error
+			if id, err = newSessionID(); err != nil {
+				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+				return
+			}
+			http.SetCookie(w, &http.Cookie{Name: s.CookieName, Value: id, Path: "/", HttpOnly: true})
+		}
+
+		session, err := s.Open(id)
+		if err != nil {
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		defer session.Close()
+
+		next.ServeHTTP(w, req.WithContext(context.WithValue(req.Context(), sessionContextKey{}, session)))
+
+		// The response is already written, so a failed save cannot be reported
+		// to the client; the lock still keeps the next request from reading
+		// a half-written file
+		if err := session.Save(); err != nil {
+			s.logf("phpserialize: saving session: %v", err)
+		}
+	})
+}
+
+// logf writes to ErrorLog, or to the standard logger if it is nil
+func (s *SessionStore) logf(format string, args ...interface{}) {
+	if s.ErrorLog != nil {
+		s.ErrorLog.Printf(format, args...)
+	} else {
+		log.Printf(format, args...)
+	}
+}
+
+// newSessionID returns a random ID of 32 hexadecimal characters, PHP's default
+// for session.sid_length and session.sid_bits_per_character
+func newSessionID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,167 @@
+package phpserialize
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestSessionStore tests reading and writing session files
+func TestSessionStore(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "a", "b"), 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	store, err := NewSessionStore("2;0640;"+dir, SessionPHP)
+	if err != nil {
+		t.Fatalf("NewSessionStore failed: %v", err)
+	}
+	if store.Depth != 2 || store.Mode != 0640 || store.Path != dir {
+		t.Errorf("Unexpected store %+v", store)
+	}
+
+	// A file written by PHP
+	path := filepath.Join(dir, "a", "b", "sess_ab12")
+	if err := os.WriteFile(path, []byte(`user_id|i:42;`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	vars, err := store.Load("ab12")
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if v, _ := vars.Get("user_id"); v != int64(42) {
+		t.Errorf("Expected user_id 42, got %#v", vars)
+	}
+
+	vars.Set("name", "Alice")
+	if err := store.Save("ab12", vars); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	data, _ := os.ReadFile(path)
+	if string(data) != `user_id|i:42;name|s:5:"Alice";` {
+		t.Errorf("Unexpected file contents %q", data)
+	}
+
+	// Shorter data truncates the file
+	if err := store.Save("ab12", PHPArray{}); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	if data, _ := os.ReadFile(path); len(data) != 0 {
+		t.Errorf("Expected empty file, got %q", data)
+	}
+
+	if err := store.Destroy("ab12"); err != nil || store.Exists("ab12") {
+		t.Errorf("Destroy failed: %v", err)
+	}
+
+	for _, id := range []string{"", "../etc", "ab/cd", "a"} {
+		if _, err := store.Open(id); err == nil {
+			t.Errorf("Expected error for session id %q", id)
+		}
+	}
+	if _, err := NewSessionStore("x;"+dir, SessionPHP); err == nil {
+		t.Error("Expected error for invalid depth")
+	}
+}
+
+// TestSessionStoreLocking tests that an open session blocks other openers
+func TestSessionStoreLocking(t *testing.T) {
+	store, _ := NewSessionStore(t.TempDir(), SessionPHPSerialize)
+
+	first, err := store.Open("locked")
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+
+	opened := make(chan *Session)
+	go func() {
+		second, err := store.Open("locked")
+		if err != nil {
+			t.Error(err)
+		}
+		opened <- second
+	}()
+
+	select {
+	case <-opened:
+		t.Fatal("Second Open did not wait for the lock")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	first.Vars.Set("count", 1)
+	if err := first.Save(); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	first.Close()
+
+	second := <-opened
+	defer second.Close()
+	if v, _ := second.Vars.Get("count"); v != int64(1) {
+		t.Errorf("Expected the second opener to see the saved data, got %#v", second.Vars)
+	}
+}
+
+// TestSessionMiddleware tests loading and saving sessions over HTTP
+func TestSessionMiddleware(t *testing.T) {
+	store, _ := NewSessionStore(t.TempDir(), SessionPHP)
+	handler := store.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		session := SessionFromContext(r.Context())
+		visits, _ := session.Vars.Get("visits")
+		n, _ := visits.(int64)
+		session.Vars.Set("visits", n+1)
+	}))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	cookies := rec.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != "PHPSESSID" || len(cookies[0].Value) != 32 {
+		t.Fatalf("Expected a new session cookie, got %v", cookies)
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.AddCookie(cookies[0])
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if len(rec.Result().Cookies()) != 0 {
+		t.Error("Expected the existing session to be reused")
+	}
+
+	vars, err := store.Load(cookies[0].Value)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if v, _ := vars.Get("visits"); v != int64(2) {
+		t.Errorf("Expected 2 visits, got %#v", vars)
+	}
+
+	// Unknown IDs are replaced, like session.use_strict_mode
+	req = httptest.NewRequest("GET", "/", nil)
+	req.AddCookie(&http.Cookie{Name: "PHPSESSID", Value: "forged"})
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if c := rec.Result().Cookies(); len(c) != 1 || c[0].Value == "forged" {
+		t.Errorf("Expected a new session ID, got %v", c)
+	}
+}
+
+// TestSessionMiddlewareSaveError tests that a session that cannot be saved is logged
+func TestSessionMiddlewareSaveError(t *testing.T) {
+	store, _ := NewSessionStore(t.TempDir(), SessionPHP)
+	var logged bytes.Buffer
+	store.ErrorLog = log.New(&logged, "", 0)
+	handler := store.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		SessionFromContext(r.Context()).Vars.Set("c", make(chan int))
+	}))
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	if !strings.Contains(logged.String(), "saving session") {
+		t.Errorf("Expected the save error to be logged, got %q", logged.String())
+	}
+}
@@ -0,0 +1,115 @@
+package phpserialize
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// TestSessionHandlers tests decoding and encoding all session formats
+func TestSessionHandlers(t *testing.T) {
+	want := PHPArray{
+		{Key: "user_id", Value: int64(42)},
+		{Key: "cart", Value: []interface{}{"apple", "pear"}},
+		{Key: "flash", Value: nil},
+	}
+
+	tests := []struct {
+		handler SessionHandler
+		data    string
+	}{
+		{SessionPHP, `user_id|i:42;cart|a:2:{i:0;s:5:"apple";i:1;s:4:"pear";}flash|N;`},
+		{SessionPHPBinary, "\x07user_idi:42;\x04carta:2:{i:0;s:5:\"apple\";i:1;s:4:\"pear\";}\x05flashN;"},
+		{SessionPHPSerialize, `a:3:{s:7:"user_id";i:42;s:4:"cart";a:2:{i:0;s:5:"apple";i:1;s:4:"pear";}s:5:"flash";N;}`},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.handler), func(t *testing.T) {
+			session, err := DecodeSession(tt.data, tt.handler)
+			if err != nil {
+				t.Fatalf("DecodeSession failed: %v", err)
+			}
+			if !reflect.DeepEqual(session, want) {
+				t.Errorf("Expected %#v, got %#v", want, session)
+			}
+
+			encoded, err := EncodeSession(session, tt.handler)
+			if err != nil {
+				t.Fatalf("EncodeSession failed: %v", err)
+			}
+			if encoded != tt.data {
+				t.Errorf("Expected %q, got %q", tt.data, encoded)
+			}
+		})
+	}
+}
+
+// TestSessionUndefined tests the undefined variable markers
+func TestSessionUndefined(t *testing.T) {
+	session, err := DecodeSession(`!gone|count|i:1;`, SessionPHP)
+	if err != nil {
+		t.Fatalf("DecodeSession failed: %v", err)
+	}
+	want := PHPArray{{Key: "gone", Value: nil}, {Key: "count", Value: int64(1)}}
+	if !reflect.DeepEqual(session, want) {
+		t.Errorf("Expected %#v, got %#v", want, session)
+	}
+
+	session, err = DecodeSession("\x84gone\x05counti:1;", SessionPHPBinary)
+	if err != nil || !reflect.DeepEqual(session, want) {
+		t.Errorf("Expected %#v, got %#v (%v)", want, session, err)
+	}
+
+	// The marker is lost on the way back, as in PHP
+	session, _ = DecodeSession(`a|N;!b|c|i:1;`, SessionPHP)
+	if encoded, _ := EncodeSession(session, SessionPHP); encoded != `a|N;b|N;c|i:1;` {
+		t.Errorf("Expected a|N;b|N;c|i:1;, got %q", encoded)
+	}
+}
+
+// TestSessionReferences tests references spanning session variables
+func TestSessionReferences(t *testing.T) {
+	session, err := DecodeSession(`a|O:4:"User":0:{}b|r:1;c|i:5;d|R:3;`, SessionPHP)
+	if err != nil {
+		t.Fatalf("DecodeSession failed: %v", err)
+	}
+	if b, _ := session.Get("b"); b.(PHPObject).ClassName != "User" {
+		t.Errorf("Expected b to reference the object, got %#v", b)
+	}
+	if d, _ := session.Get("d"); d != int64(5) {
+		t.Errorf("Expected d to reference c, got %#v", d)
+	}
+}
+
+// TestSessionErrors tests malformed session data and unencodable names
+func TestSessionErrors(t *testing.T) {
+	_, err := DecodeSession(`ok|i:1;bad|i:x;`, SessionPHP)
+	var se *SyntaxError
+	if !errors.As(err, &se) || se.Path != "bad" {
+		t.Errorf("Expected SyntaxError at path bad, got %v", err)
+	}
+	if _, err := DecodeSession(`ok|i:1;junk`, SessionPHP); !errors.Is(err, ErrUnexpectedEOF) {
+		t.Errorf("Expected ErrUnexpectedEOF, got %v", err)
+	}
+	if _, err := DecodeSession("\x09short", SessionPHPBinary); !errors.Is(err, ErrUnexpectedEOF) {
+		t.Errorf("Expected ErrUnexpectedEOF, got %v", err)
+	}
+	if _, err := DecodeSession(`s:1:"x";`, SessionPHPSerialize); err == nil {
+		t.Error("Expected error for non-array php_serialize data")
+	}
+	if _, err := DecodeSession(`a:0:{}junk`, SessionPHPSerialize); !errors.As(err, &se) || se.Offset != 6 {
+		t.Errorf("Expected SyntaxError at position 6 for trailing data, got %v", err)
+	}
+	if _, err := DecodeSession(``, "wddx"); err == nil {
+		t.Error("Expected error for unknown handler")
+	}
+
+	if _, err := EncodeSession(PHPArray{{Key: "a|b", Value: 1}}, SessionPHP); err == nil {
+		t.Error("Expected error for name containing '|'")
+	}
+	if _, err := EncodeSession(PHPArray{{Key: int64(1), Value: 1}}, SessionPHPBinary); err == nil {
+		t.Error("Expected error for numeric name")
+	}
+	if s, err := EncodeSession(PHPArray{{Key: int64(1), Value: 1}}, SessionPHPSerialize); err != nil || s != `a:1:{i:1;i:1;}` {
+		t.Errorf("Unexpected php_serialize output %q (%v)", s, err)
+	}
+}
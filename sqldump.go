@@ -0,0 +1,240 @@
+package phpserialize
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// SQLFallback describes a literal that looked like serialized data but did not
+// parse, so ReplaceSQLDump replaced it as plain text without fixing lengths
+type SQLFallback struct {
+	Offset int64 // offset of the literal's opening quote in the dump
+	Err    error // why the literal did not parse
+}
+
+// ReplaceSQLDump copies a MySQL dump from r to w, replacing old with new in
+// every quoted string literal. Literals holding serialized data are rewritten
+// with ReplaceStrings so their lengths stay correct; other literals are
+// replaced as plain text, and SQL outside literals is copied unchanged.
+// The dump is streamed, so only the literal being rewritten is held in memory.
+// It returns the number of literals that changed, and the changed literals
+// that looked serialized but were replaced as plain text.
+func ReplaceSQLDump(w io.Writer, r io.Reader, old, new string, options ...Option) (int, []SQLFallback, error) {
+	if old == "" {
+		_, err := io.Copy(w, r)
+		return 0, nil, err
+	}
+	return ReplaceSQLDumpFunc(w, r, func(s string) string {
+		return strings.ReplaceAll(s, old, new)
+	}, options...)
+}
+
+// ReplaceSQLDumpFunc is like ReplaceSQLDump, replacing strings with the result
+// of calling replace on them as ReplaceStringsFunc does
+func ReplaceSQLDumpFunc(w io.Writer, r io.Reader, replace func(string) string, options ...Option) (int, []SQLFallback, error) {
+	cfg := newUnmarshalConfig(options)
+	if cfg.versionErr != nil {
+		return 0, nil, cfg.versionErr
+	}
+	d := &sqlDumpRewriter{
+		in:  bufio.NewReaderSize(r, streamChunkSize),
+		out: bufio.NewWriterSize(w, streamChunkSize),
+		rp:  &stringReplacer{replace: replace, cfg: cfg},
+	}
+	if err := d.run(); err != nil {
+		return d.changed, d.fallbacks, err
+	}
+	return d.changed, d.fallbacks, d.out.Flush()
+}
+
+// sqlDumpRewriter scans SQL text for string literals, following MySQL's
+// quoting and comment rules
+type sqlDumpRewriter struct {
+	in        *bufio.Reader
+	out       *bufio.Writer
+	rp        *stringReplacer
+	offset    int64 // offset in the input of the next byte read
+	changed   int
+	fallbacks []SQLFallback
+
+	raw  bytes.Buffer // literal as it appears in the dump, without quotes
+	text bytes.Buffer // literal with escapes resolved
+}
+
+// next reads a byte, copying it to the output unless it belongs to a literal
+func (d *sqlDumpRewriter) next(copyOut bool) (byte, error) {
+	b, err := d.in.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	d.offset++
+	if copyOut {
+		d.out.WriteByte(b)
+	}
+	return b, nil
+}
+
+// run copies the dump, rewriting each string literal
+func (d *sqlDumpRewriter) run() error {
+	for {
+		b, err := d.next(true)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		switch b {
+		case '\'', '"':
+			err = d.literal(b)
+		case '`':
+			err = d.skipUntil("`")
+		case '#':
+			err = d.skipUntil("\n")
+		case '-':
+			// "-- " starts a comment only when followed by whitespace
+			if p, _ := d.in.Peek(2); len(p) == 2 && p[0] == '-' && (p[1] == ' ' || p[1] == '\t' || p[1] == '\n' || p[1] == '\r') {
+				err = d.skipUntil("\n")
+			}
+		case '/':
+			if p, _ := d.in.Peek(1); len(p) == 1 && p[0] == '*' {
+				err = d.skipUntil("*/")
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// skipUntil copies input up to and including end, which may be missing at EOF
+func (d *sqlDumpRewriter) skipUntil(end string) error {
+	matched := 0
+	for matched < len(end) {
+		b, err := d.next(true)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if b == end[matched] {
+			matched++
+		} else if b == end[0] {
+			matched = 1
+		} else {
+			matched = 0
+		}
+	}
+	return nil
+}
+
+// literal reads a string literal whose opening quote was just copied,
+// and writes it back with the replacement applied
+func (d *sqlDumpRewriter) literal(quote byte) error {
+	start := d.offset - 1
+	d.raw.Reset()
+	d.text.Reset()
+	for {
+		b, err := d.next(false)
+		if err == io.EOF {
+			return fmt.Errorf("unterminated string literal at offset %d", start)
+		}
+		if err != nil {
+			return err
+		}
+		d.raw.WriteByte(b)
+
+		switch {
+		case b == '\\':
+			c, err := d.next(false)
+			if err == io.EOF {
+				return fmt.Errorf("unterminated string literal at offset %d", start)
+			}
+			if err != nil {
+				return err
+			}
+			d.raw.WriteByte(c)
+			if c == '%' || c == '_' {
+				// Only special in LIKE patterns, elsewhere the backslash stays
+				d.text.WriteByte('\\')
+			}
+			d.text.WriteByte(sqlUnescape(c))
+		case b == quote:
+			// A doubled quote stands for one quote character
+			if p, _ := d.in.Peek(1); len(p) == 1 && p[0] == quote {
+				c, _ := d.next(false)
+				d.raw.WriteByte(c)
+				d.text.WriteByte(quote)
+				continue
+			}
+			d.raw.Truncate(d.raw.Len() - 1)
+			d.writeLiteral(quote, start)
+			return nil
+		default:
+			d.text.WriteByte(b)
+		}
+	}
+}
+
+// writeLiteral writes the current literal and its closing quote, keeping the
+// original bytes when the replacement leaves it unchanged
+func (d *sqlDumpRewriter) writeLiteral(quote byte, start int64) {
+	text := d.text.String()
+	replaced, err := d.rp.parseText(text, 0)
+	if replaced == text {
+		d.out.Write(d.raw.Bytes())
+	} else {
+		d.changed++
+		if err != nil {
+			d.fallbacks = append(d.fallbacks, SQLFallback{Offset: start, Err: err})
+		}
+		sqlEscape(d.out, replaced)
+	}
+	d.out.WriteByte(quote)
+}
+
+// sqlUnescape returns the character a backslash escape in a MySQL literal stands for
+func sqlUnescape(c byte) byte {
+	switch c {
+	case '0':
+		return 0
+	case 'b':
+		return '\b'
+	case 'n':
+		return '\n'
+	case 'r':
+		return '\r'
+	case 't':
+		return '\t'
+	case 'Z':
+		return 0x1a
+	}
+	// \\, \', \" and unknown escapes stand for the character itself
+	return c
+}
+
+// sqlEscape writes s escaped the way mysqldump does
+func sqlEscape(w *bufio.Writer, s string) {
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case 0:
+			w.WriteString(`\0`)
+		case '\n':
+			w.WriteString(`\n`)
+		case '\r':
+			w.WriteString(`\r`)
+		case 0x1a:
+			w.WriteString(`\Z`)
+		case '\\', '\'', '"':
+			w.WriteByte('\\')
+			w.WriteByte(c)
+		default:
+			w.WriteByte(c)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package phpserialize
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// TestReplaceSQLDump tests rewriting serialized values inside SQL literals
+func TestReplaceSQLDump(t *testing.T) {
+	dump := "-- Dump of 'wp_options' from http://old.example\n" +
+		"/*!40101 SET NAMES utf8mb4 */;\n" +
+		"INSERT INTO `wp_options` VALUES (1,'siteurl','http://old.example','yes')," +
+		"(2,'widget','a:2:{s:5:\\\"title\\\";s:10:\\\"It\\'s \\\"new\\\"\";s:3:\\\"url\\\";s:18:\\\"http://old.example\\\";}','yes')," +
+		"(3,'untouched','don''t\\nchange','no');\n"
+	want := "-- Dump of 'wp_options' from http://old.example\n" +
+		"/*!40101 SET NAMES utf8mb4 */;\n" +
+		"INSERT INTO `wp_options` VALUES (1,'siteurl','https://new.example.org','yes')," +
+		"(2,'widget','a:2:{s:5:\\\"title\\\";s:10:\\\"It\\'s \\\"new\\\"\\\";s:3:\\\"url\\\";s:23:\\\"https://new.example.org\\\";}','yes')," +
+		"(3,'untouched','don''t\\nchange','no');\n"
+
+	var out bytes.Buffer
+	changed, fallbacks, err := ReplaceSQLDump(&out, strings.NewReader(dump), "http://old.example", "https://new.example.org")
+	if err != nil {
+		t.Fatalf("ReplaceSQLDump failed: %v", err)
+	}
+	if out.String() != want {
+		t.Errorf("Expected\n%s\ngot\n%s", want, out.String())
+	}
+	if changed != 2 {
+		t.Errorf("Expected 2 changed literals, got %d", changed)
+	}
+	if len(fallbacks) != 0 {
+		t.Errorf("Expected no fallbacks, got %v", fallbacks)
+	}
+}
+
+// TestReplaceSQLDumpFallbacks tests that literals which look serialized but do
+// not parse are reported
+func TestReplaceSQLDumpFallbacks(t *testing.T) {
+	dump := `('a:1:{i:0;s:5:\"old\";}','s:3:\"old\";','a:1:{i:0;s:1:\"x\";}')`
+	want := `('a:1:{i:0;s:5:\"new\";}','s:3:\"new\";','a:1:{i:0;s:1:\"x\";}')`
+
+	var out bytes.Buffer
+	changed, fallbacks, err := ReplaceSQLDump(&out, strings.NewReader(dump), "old", "new")
+	if err != nil {
+		t.Fatalf("ReplaceSQLDump failed: %v", err)
+	}
+	if out.String() != want {
+		t.Errorf("Expected %s, got %s", want, out.String())
+	}
+	if changed != 2 {
+		t.Errorf("Expected 2 changed literals, got %d", changed)
+	}
+	if len(fallbacks) != 1 {
+		t.Fatalf("Expected 1 fallback, got %v", fallbacks)
+	}
+	if fallbacks[0].Offset != 1 {
+		t.Errorf("Expected offset 1, got %d", fallbacks[0].Offset)
+	}
+	var syntaxErr *SyntaxError
+	if !errors.As(fallbacks[0].Err, &syntaxErr) {
+		t.Errorf("Expected a SyntaxError, got %v", fallbacks[0].Err)
+	}
+}
+
+// TestReplaceSQLDumpEscapes tests that escapes survive a rewrite
+func TestReplaceSQLDumpEscapes(t *testing.T) {
+	var out bytes.Buffer
+	_, _, err := ReplaceSQLDump(&out, strings.NewReader(`('old\0\r\n\Z\\\%\_')`), "old", "new")
+	if err != nil {
+		t.Fatalf("ReplaceSQLDump failed: %v", err)
+	}
+	if want := `('new\0\r\n\Z\\\\%\\_')`; out.String() != want {
+		t.Errorf("Expected %s, got %s", want, out.String())
+	}
+
+	if _, _, err := ReplaceSQLDump(&out, strings.NewReader(`INSERT INTO t VALUES ('old`), "old", "new"); err == nil {
+		t.Error("Expected error for unterminated literal")
+	}
+}
@@ -0,0 +1,106 @@
+package phpserialize
+
+import (
+	"bytes"
+	"io"
+)
+
+// Decoder reads PHP serialized values from an input stream.
+// It buffers only a bounded window of the input (plus the bytes of any single
+// string being decoded), so large exports can be processed without loading
+// them into memory. Several values written one after another, optionally
+// separated by whitespace, are decoded by successive calls to Decode.
+type Decoder struct {
+	r   stringReader
+	cfg *unmarshalConfig
+}
+
+// NewDecoder returns a Decoder reading from r with the given options
+func NewDecoder(r io.Reader, options ...Option) *Decoder {
+	return &Decoder{
+		r:   stringReader{src: r, stream: true},
+		cfg: newUnmarshalConfig(options),
+	}
+}
+
+// Decode reads the next serialized value from the stream.
+// It returns io.EOF when the stream holds no more values.
+// Error positions are byte offsets from the start of the stream.
+func (d *Decoder) Decode() (interface{}, error) {
+	if d.cfg.versionErr != nil {
+		return nil, d.cfg.versionErr
+	}
+	if err := d.skipSpace(); err != nil {
+		return nil, err
+	}
+
+	// Each value has its own reference table, like separate unserialize() calls
+	d.r.vars = nil
+	d.r.open = nil
+	value, err := unmarshalValue(&d.r, d.cfg, 0)
+	return value, d.cfg.finishError(err, -1)
+}
+
+// More reports whether another value is available in the stream
+func (d *Decoder) More() bool {
+	return d.skipSpace() == nil
+}
+
+// InputOffset returns the stream offset just past the last decoded value
+func (d *Decoder) InputOffset() int64 {
+	return int64(d.r.pos)
+}
+
+// skipSpace skips whitespace between values, returning io.EOF at the end of the stream
+func (d *Decoder) skipSpace() error {
+	for {
+		b, err := d.r.peek()
+		if err != nil {
+			if d.r.err != nil {
+				return d.r.err
+			}
+			return io.EOF
+		}
+		switch b {
+		case ' ', '\t', '\r', '\n':
+			d.r.pos++
+		default:
+			return nil
+		}
+	}
+}
+
+// Encoder writes PHP serialized values to an output stream.
+// Output is handed to the writer in chunks as it is produced, through an
+// internal buffer that is reused across calls, so large values never exist
+// as a single string in memory.
+type Encoder struct {
+	w   io.Writer
+	cfg *marshalConfig
+	buf bytes.Buffer
+}
+
+// NewEncoder returns an Encoder writing to w with the same options as Marshal
+func NewEncoder(w io.Writer, options ...Option) *Encoder {
+	return &Encoder{w: w, cfg: newMarshalConfig(options)}
+}
+
+// Encode writes the serialized form of v to the stream.
+// Values written by successive calls are concatenated without a separator.
+// If an error occurs, part of the value may already have been written.
+func (e *Encoder) Encode(v interface{}) error {
+	if e.cfg.versionErr != nil {
+		return e.cfg.versionErr
+	}
+	// Each value has its own reference table, like separate serialize() calls
+	cfg := *e.cfg
+	cfg.out = e.w
+
+	e.buf.Reset()
+	if err := marshalValue(&e.buf, v, &cfg, 0); err != nil {
+		return err
+	}
+	_, err := e.w.Write(e.buf.Bytes())
+	e.buf.Reset()
+	return err
+}
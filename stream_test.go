@@ -0,0 +1,212 @@
+package phpserialize
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+// TestDecoder tests decoding concatenated values from a stream
+func TestDecoder(t *testing.T) {
+	input := `i:1;s:5:"hello";` + "\n" + `a:1:{i:0;O:1:"A":0:{}}a:2:{i:0;a:0:{}i:1;R:2;}N;`
+
+	// One byte at a time exercises every refill path
+	dec := NewDecoder(iotest.OneByteReader(strings.NewReader(input)))
+
+	var values []interface{}
+	for {
+		v, err := dec.Decode()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Decode failed: %v", err)
+		}
+		values = append(values, v)
+	}
+
+	if len(values) != 5 {
+		t.Fatalf("Expected 5 values, got %d: %#v", len(values), values)
+	}
+	if values[0] != int64(1) || values[1] != "hello" || values[4] != nil {
+		t.Errorf("Unexpected values: %#v", values)
+	}
+	if _, ok := values[2].([]interface{})[0].(PHPObject); !ok {
+		t.Errorf("Expected object, got %#v", values[2])
+	}
+	if dec.InputOffset() != int64(len(input)) {
+		t.Errorf("Expected offset %d, got %d", len(input), dec.InputOffset())
+	}
+	if dec.More() {
+		t.Error("Expected no more values")
+	}
+}
+
+// TestDecoderLargeString tests strings larger than the stream window
+func TestDecoderLargeString(t *testing.T) {
+	big := strings.Repeat("x", 3*streamChunkSize+17)
+	input := MustMarshal([]interface{}{big, "tail"}) + MustMarshal(big)
+
+	dec := NewDecoder(strings.NewReader(input))
+	v, err := dec.Decode()
+	if err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+	if s := v.([]interface{}); s[0] != big || s[1] != "tail" {
+		t.Error("Large string corrupted")
+	}
+	v, err = dec.Decode()
+	if err != nil || v != big {
+		t.Fatalf("Second Decode failed: %v", err)
+	}
+	if _, err := dec.Decode(); err != io.EOF {
+		t.Errorf("Expected io.EOF, got %v", err)
+	}
+}
+
+// TestDecoderErrors tests stream-relative offsets and read errors
+func TestDecoderErrors(t *testing.T) {
+	dec := NewDecoder(strings.NewReader(`i:1;i:2;s:9:"short";`))
+	_, _ = dec.Decode()
+	_, _ = dec.Decode()
+	_, err := dec.Decode()
+	if err == nil || !strings.Contains(err.Error(), "position 13") {
+		t.Errorf("Expected error at stream position 13, got %v", err)
+	}
+
+	dec = NewDecoder(strings.NewReader(`a:1:{i:0;`))
+	if _, err := dec.Decode(); err == nil || err == io.EOF {
+		t.Errorf("Expected truncation error, got %v", err)
+	}
+
+	boom := errors.New("boom")
+	dec = NewDecoder(io.MultiReader(strings.NewReader(`s:10:"abc`), iotest.ErrReader(boom)))
+	if _, err := dec.Decode(); !errors.Is(err, boom) {
+		t.Errorf("Expected read error, got %v", err)
+	}
+}
+
+// digitReader yields an endless number
+type digitReader struct{}
+
+func (digitReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = '1'
+	}
+	return len(p), nil
+}
+
+// TestDecoderLongToken tests that a number missing its delimiter fails
+// instead of being buffered without bound
+func TestDecoderLongToken(t *testing.T) {
+	dec := NewDecoder(io.MultiReader(strings.NewReader("i:"), digitReader{}))
+	_, err := dec.Decode()
+	var syntaxErr *SyntaxError
+	if !errors.As(err, &syntaxErr) {
+		t.Fatalf("Expected a SyntaxError, got %v", err)
+	}
+	if syntaxErr.Offset != 2 || syntaxErr.Expected != "';'" {
+		t.Errorf("Expected ';' at position 2, got %v", err)
+	}
+
+	if _, err := Unmarshal("i:" + strings.Repeat("1", maxTokenLength) + ";"); !errors.As(err, &syntaxErr) {
+		t.Errorf("Expected a SyntaxError for a long integer, got %v", err)
+	}
+
+	// Tokens split across reads are joined in the window
+	values := make([]interface{}, 0, 3*streamChunkSize)
+	for i := 0; i < cap(values); i++ {
+		values = append(values, int64(i)*1e9)
+	}
+	data := MustMarshal(values)
+	got, err := NewDecoder(iotest.HalfReader(strings.NewReader(data))).Decode()
+	if err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+	if MustMarshal(got) != data {
+		t.Error("Expected the decoded array to match the input")
+	}
+}
+
+// countingWriter records the size of every write
+type countingWriter struct {
+	bytes.Buffer
+	writes []int
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.writes = append(w.writes, len(p))
+	return w.Buffer.Write(p)
+}
+
+// TestEncoder tests that encoded values match Marshal and concatenate
+func TestEncoder(t *testing.T) {
+	shared := &[]int{1}
+	values := []interface{}{
+		int64(1),
+		map[string]interface{}{"b": 2, "a": 1},
+		[]interface{}{shared, shared},
+		nil,
+	}
+
+	var w countingWriter
+	enc := NewEncoder(&w, WithKeyOrder(KeyOrderSorted))
+	var want string
+	for _, v := range values {
+		if err := enc.Encode(v); err != nil {
+			t.Fatalf("Encode failed: %v", err)
+		}
+		want += MustMarshal(v, WithKeyOrder(KeyOrderSorted))
+	}
+	if w.String() != want {
+		t.Errorf("Expected %s, got %s", want, w.String())
+	}
+
+	// The output decodes back value by value
+	dec := NewDecoder(strings.NewReader(w.String()))
+	for range values {
+		if _, err := dec.Decode(); err != nil {
+			t.Fatalf("Decode failed: %v", err)
+		}
+	}
+}
+
+// TestEncoderIncremental tests that large values are written in chunks
+func TestEncoderIncremental(t *testing.T) {
+	items := make([]string, 4*streamChunkSize/100)
+	for i := range items {
+		items[i] = strings.Repeat("y", 100)
+	}
+
+	var w countingWriter
+	if err := NewEncoder(&w).Encode(items); err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+	if w.String() != MustMarshal(items) {
+		t.Error("Incremental output differs from Marshal")
+	}
+	if len(w.writes) < 2 {
+		t.Errorf("Expected several writes, got %d", len(w.writes))
+	}
+	for _, n := range w.writes {
+		if n > 2*streamChunkSize {
+			t.Errorf("Write of %d bytes exceeds the buffer bound", n)
+		}
+	}
+
+	if err := NewEncoder(errWriter{}).Encode(items); err == nil || err.Error() != "disk full" {
+		t.Errorf("Expected write error, got %v", err)
+	}
+	if err := NewEncoder(&w, WithMaxDepth(1)).Encode([]interface{}{[]interface{}{}}); err == nil {
+		t.Error("Expected max depth error")
+	}
+}
+
+type errWriter struct{}
+
+func (errWriter) Write([]byte) (int, error) {
+	return 0, errors.New("disk full")
+}
@@ -0,0 +1,286 @@
+package phpserialize
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// ClassNamer is implemented by Go structs that serialize as a PHP object.
+// Structs without a class name (from this method or a `php:"Name,class"` tag
+// on a blank field) are serialized as PHP arrays instead.
+type ClassNamer interface {
+	PHPClassName() string
+}
+
+// structField describes one serialized field of a Go struct
+type structField struct {
+	name       string
+	index      []int
+	omitEmpty  bool
+	tagged     bool
+	visibility Visibility // from the "protected" or "private" tag option, used for objects
+}
+
+// structInfo is the cached serialization layout of a struct type
+type structInfo struct {
+	className string // from a `php:"Name,class"` tag, empty if none
+	fields    []structField
+}
+
+var structCache sync.Map // map[reflect.Type]*structInfo
+
+var classNamerType = reflect.TypeOf((*ClassNamer)(nil)).Elem()
+
+// cachedStructInfo returns the field layout of a struct type, computing it once
+func cachedStructInfo(t reflect.Type) *structInfo {
+	if info, ok := structCache.Load(t); ok {
+		return info.(*structInfo)
+	}
+	info, _ := structCache.LoadOrStore(t, typeStructInfo(t))
+	return info.(*structInfo)
+}
+
+// typeStructInfo walks a struct type following encoding/json rules:
+// `php:"name,omitempty"` renames a field, `php:"-"` skips it, and embedded
+// structs without a name in their tag have their fields flattened.
+// The "protected" and "private" options set the property visibility used
+// when the struct is serialized as an object.
+func typeStructInfo(t reflect.Type) *structInfo {
+	info := &structInfo{}
+
+	type candidate struct {
+		typ   reflect.Type
+		index []int
+	}
+	current := []candidate{}
+	next := []candidate{{typ: t}}
+	visited := map[reflect.Type]bool{}
+
+	// Fields found at the shallowest depth win; two fields with the same name
+	// at the same depth cancel each other unless exactly one of them is tagged.
+	byName := map[string][]structField{}
+	var order []string
+
+	for len(next) > 0 {
+		current, next = next, current[:0]
+		found := map[string][]structField{}
+
+		for _, c := range current {
+			if visited[c.typ] {
+				continue
+			}
+			visited[c.typ] = true
+
+			for i := 0; i < c.typ.NumField(); i++ {
+				f := c.typ.Field(i)
+				tag := f.Tag.Get("php")
+
+				index := make([]int, len(c.index)+1)
+				copy(index, c.index)
+				index[len(c.index)] = i
+
+				name, opts, _ := strings.Cut(tag, ",")
+
+				// Class name marker: _ struct{} `php:"User,class"`
+				if f.Name == "_" {
+					if hasTagOption(opts, "class") && len(c.index) == 0 {
+						info.className = name
+					}
+					continue
+				}
+				if tag == "-" {
+					continue
+				}
+
+				if f.Anonymous {
+					ft := f.Type
+					if ft.Kind() == reflect.Ptr {
+						ft = ft.Elem()
+					}
+					if name == "" && ft.Kind() == reflect.Struct {
+						next = append(next, candidate{typ: ft, index: index})
+						continue
+					}
+				}
+				if !f.IsExported() {
+					continue
+				}
+
+				field := structField{
+					name:      name,
+					index:     index,
+					omitEmpty: hasTagOption(opts, "omitempty"),
+					tagged:    name != "",
+				}
+				switch {
+				case hasTagOption(opts, "protected"):
+					field.visibility = Protected
+				case hasTagOption(opts, "private"):
+					field.visibility = Private
+				}
+				if field.name == "" {
+					field.name = f.Name
+				}
+				found[field.name] = append(found[field.name], field)
+			}
+		}
+
+		for name, fields := range found {
+			if _, taken := byName[name]; taken {
+				continue
+			}
+			byName[name] = fields
+			order = append(order, name)
+		}
+	}
+
+	for _, name := range order {
+		if field, ok := dominantField(byName[name]); ok {
+			info.fields = append(info.fields, field)
+		}
+	}
+
+	// Keep declaration order, like encoding/json
+	sortFieldsByIndex(info.fields)
+	return info
+}
+
+// dominantField picks the field that wins among fields sharing a name at one depth
+func dominantField(fields []structField) (structField, bool) {
+	if len(fields) == 1 {
+		return fields[0], true
+	}
+	var winner *structField
+	for i := range fields {
+		if fields[i].tagged {
+			if winner != nil {
+				return structField{}, false
+			}
+			winner = &fields[i]
+		}
+	}
+	if winner == nil {
+		return structField{}, false
+	}
+	return *winner, true
+}
+
+// sortFieldsByIndex orders fields by their position in the struct
+func sortFieldsByIndex(fields []structField) {
+	for i := 1; i < len(fields); i++ {
+		for j := i; j > 0 && indexLess(fields[j].index, fields[j-1].index); j-- {
+			fields[j], fields[j-1] = fields[j-1], fields[j]
+		}
+	}
+}
+
+func indexLess(a, b []int) bool {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i] != b[i] {
+			return a[i] < b[i]
+		}
+	}
+	return len(a) < len(b)
+}
+
+func hasTagOption(opts, option string) bool {
+	for opts != "" {
+		var opt string
+		opt, opts, _ = strings.Cut(opts, ",")
+		if opt == option {
+			return true
+		}
+	}
+	return false
+}
+
+// structClassName returns the PHP class name of a struct value, or "" if it
+// should be serialized as an array
+func structClassName(v reflect.Value) string {
+	if v.Type().Implements(classNamerType) {
+		return v.Interface().(ClassNamer).PHPClassName()
+	}
+	if reflect.PointerTo(v.Type()).Implements(classNamerType) {
+		if v.CanAddr() {
+			return v.Addr().Interface().(ClassNamer).PHPClassName()
+		}
+		ptr := reflect.New(v.Type())
+		ptr.Elem().Set(v)
+		return ptr.Interface().(ClassNamer).PHPClassName()
+	}
+	return cachedStructInfo(v.Type()).className
+}
+
+// structFieldValue returns the value of a field, reporting false when it is
+// promoted through a nil embedded pointer
+func structFieldValue(v reflect.Value, index []int) (reflect.Value, bool) {
+	for i, x := range index {
+		if i > 0 {
+			if v.Kind() == reflect.Ptr {
+				if v.IsNil() {
+					return reflect.Value{}, false
+				}
+				v = v.Elem()
+			}
+		}
+		v = v.Field(x)
+	}
+	return v, true
+}
+
+// isEmptyValue reports whether a value is empty for the omitempty option
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Interface, reflect.Ptr:
+		return v.IsNil()
+	}
+	return false
+}
+
+// marshalStruct serializes a Go struct as a PHP array, or as an object when it has a class name
+func marshalStruct(buf *bytes.Buffer, v reflect.Value, cfg *marshalConfig, depth int) error {
+	info := cachedStructInfo(v.Type())
+	className := structClassName(v)
+
+	fields := make([]reflect.Value, 0, len(info.fields))
+	names := make([]string, 0, len(info.fields))
+	for _, f := range info.fields {
+		fv, ok := structFieldValue(v, f.index)
+		if !ok || (f.omitEmpty && isEmptyValue(fv)) {
+			continue
+		}
+		fields = append(fields, fv)
+		if className != "" {
+			names = append(names, PropertyName(f.name, f.visibility, className))
+		} else {
+			names = append(names, f.name)
+		}
+	}
+
+	if className != "" {
+		buf.WriteString(fmt.Sprintf("O:%d:\"%s\":%d:{", len(className), className, len(fields)))
+	} else {
+		buf.WriteString(fmt.Sprintf("a:%d:{", len(fields)))
+	}
+	for i, fv := range fields {
+		buf.WriteString(fmt.Sprintf("s:%d:\"%s\";", len(names[i]), names[i]))
+		if err := marshalValue(buf, fv.Interface(), cfg, depth+1); err != nil {
+			return err
+		}
+	}
+	buf.WriteString("}")
+	return nil
+}
@@ -0,0 +1,117 @@
+package phpserialize
+
+import (
+	"testing"
+)
+
+type testAddress struct {
+	City string `php:"city"`
+	Zip  string `php:"zip,omitempty"`
+}
+
+type testAudit struct {
+	CreatedBy string `php:"created_by"`
+	ID        int    `php:"audit_id"`
+}
+
+type testUser struct {
+	_       struct{} `php:"User,class"`
+	ID      int      `php:"id"`
+	Name    string   `php:"name"`
+	Email   string   `php:"email,omitempty"`
+	Secret  string   `php:"-"`
+	Address testAddress
+	hidden  int
+	testAudit
+}
+
+type testProduct struct {
+	SKU   string  `php:"sku"`
+	Price float64 `php:"price"`
+}
+
+func (testProduct) PHPClassName() string { return `App\Product` }
+
+// TestMarshalStruct tests struct serialization with php tags
+func TestMarshalStruct(t *testing.T) {
+	t.Run("object with class tag", func(t *testing.T) {
+		u := testUser{ID: 1, Name: "John", Secret: "x", Address: testAddress{City: "Oslo"}, hidden: 5,
+			testAudit: testAudit{CreatedBy: "admin", ID: 9}}
+		result, err := Marshal(u)
+		if err != nil {
+			t.Fatalf("Marshal failed: %v", err)
+		}
+		expected := `O:4:"User":5:{s:2:"id";i:1;s:4:"name";s:4:"John";` +
+			`s:7:"Address";a:1:{s:4:"city";s:4:"Oslo";}` +
+			`s:10:"created_by";s:5:"admin";s:8:"audit_id";i:9;}`
+		if result != expected {
+			t.Errorf("Expected %q, got %q", expected, result)
+		}
+	})
+
+	t.Run("array without class", func(t *testing.T) {
+		result, err := Marshal(testAddress{City: "Oslo", Zip: "0150"})
+		if err != nil {
+			t.Fatalf("Marshal failed: %v", err)
+		}
+		expected := `a:2:{s:4:"city";s:4:"Oslo";s:3:"zip";s:4:"0150";}`
+		if result != expected {
+			t.Errorf("Expected %q, got %q", expected, result)
+		}
+	})
+
+	t.Run("class from method", func(t *testing.T) {
+		result, err := Marshal(&testProduct{SKU: "A1", Price: 9.5})
+		if err != nil {
+			t.Fatalf("Marshal failed: %v", err)
+		}
+		expected := `O:11:"App\Product":2:{s:3:"sku";s:2:"A1";s:5:"price";d:9.5;}`
+		if result != expected {
+			t.Errorf("Expected %q, got %q", expected, result)
+		}
+	})
+
+	t.Run("shared struct pointer", func(t *testing.T) {
+		p := &testProduct{SKU: "A1"}
+		result, err := Marshal([]interface{}{p, p})
+		if err != nil {
+			t.Fatalf("Marshal failed: %v", err)
+		}
+		expected := `a:2:{i:0;O:11:"App\Product":2:{s:3:"sku";s:2:"A1";s:5:"price";d:0;}i:1;r:2;}`
+		if result != expected {
+			t.Errorf("Expected %q, got %q", expected, result)
+		}
+	})
+
+	t.Run("conflicting embedded fields are dropped", func(t *testing.T) {
+		type a struct{ Name string }
+		type b struct{ Name string }
+		type both struct {
+			a
+			b
+			Age int
+		}
+		result, err := Marshal(both{a{"x"}, b{"y"}, 3})
+		if err != nil {
+			t.Fatalf("Marshal failed: %v", err)
+		}
+		if result != `a:1:{s:3:"Age";i:3;}` {
+			t.Errorf("Unexpected output %q", result)
+		}
+	})
+
+	t.Run("nil embedded pointer", func(t *testing.T) {
+		type inner struct{ X int }
+		type outer struct {
+			*inner
+			Y int
+		}
+		result, err := Marshal(outer{Y: 1})
+		if err != nil {
+			t.Fatalf("Marshal failed: %v", err)
+		}
+		if result != `a:1:{s:1:"Y";i:1;}` {
+			t.Errorf("Unexpected output %q", result)
+		}
+	})
+}
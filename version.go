@@ -0,0 +1,395 @@
+package phpserialize
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// phpVersion is a PHP version as major*100+minor, e.g. 704 for PHP 7.4.
+// The zero value targets no version in particular.
+type phpVersion int
+
+func (v phpVersion) String() string {
+	return strconv.Itoa(int(v)/100) + "." + strconv.Itoa(int(v)%100)
+}
+
+// before reports whether a version is targeted and it is older than major.minor
+func (v phpVersion) before(major, minor int) bool {
+	return v != 0 && int(v) < major*100+minor
+}
+
+// since reports whether a version is targeted and it is major.minor or newer
+func (v phpVersion) since(major, minor int) bool {
+	return v != 0 && int(v) >= major*100+minor
+}
+
+// floatPrecision returns the default serialize_precision of the version:
+// 17 digits before PHP 7.1, the shortest exact representation since
+func (v phpVersion) floatPrecision() int {
+	if v.before(7, 1) {
+		return 17
+	}
+	return -1
+}
+
+// parsePHPVersion parses "major.minor", optionally followed by a release
+// number, or a bare major version
+func parsePHPVersion(version string) (phpVersion, bool) {
+	parts := strings.SplitN(version, ".", 3)
+	major, err := strconv.Atoi(parts[0])
+	if err != nil || major < 4 {
+		return 0, false
+	}
+	minor := 0
+	if len(parts) > 1 {
+		minor, err = strconv.Atoi(parts[1])
+		if err != nil || minor < 0 || minor > 99 {
+			return 0, false
+		}
+	}
+	if len(parts) > 2 {
+		if _, err := strconv.Atoi(parts[2]); err != nil {
+			return 0, false
+		}
+	}
+	return phpVersion(major*100 + minor), true
+}
+
+// phpVersionOption implements Option for targeting a PHP version
+type phpVersionOption struct {
+	version phpVersion
+	err     error
+}
+
+func (o phpVersionOption) applyMarshal(cfg *marshalConfig) {
+	cfg.version, cfg.versionErr = o.version, o.err
+}
+
+func (o phpVersionOption) applyUnmarshal(cfg *unmarshalConfig) {
+	cfg.version, cfg.versionErr = o.version, o.err
+}
+
+// WithPHPVersion targets the serialize format of a PHP version such as "7.4".
+// Marshal writes values the way that version's serialize() does, including
+// float precision and the form of SPL classes, and fails with ErrPHPVersion on
+// values it cannot read, such as enums before PHP 8.1. Unmarshal rejects those
+// values with a SyntaxError wrapping ErrPHPVersion.
+// If version is not of the form major.minor, every call made with the option
+// fails with an error wrapping ErrPHPVersion.
+func WithPHPVersion(version string) Option {
+	v, ok := parsePHPVersion(version)
+	if !ok {
+		return phpVersionOption{err: fmt.Errorf("%w: invalid version %q", ErrPHPVersion, version)}
+	}
+	return phpVersionOption{version: v}
+}
+
+// versionError returns the error for a value that the targeted PHP version
+// cannot read, given its type and its class or enum name, or nil
+func (cfg *unmarshalConfig) versionError(offset int, typeChar byte, className string) error {
+	v := cfg.version
+	switch {
+	case typeChar == 'E' && v.before(8, 1):
+		return phpVersionError(offset, "enum %s needs PHP 8.1, target is PHP %s", className, v)
+	case typeChar == 'C' && v.before(5, 1):
+		return phpVersionError(offset, "custom serialized object %s needs PHP 5.1, target is PHP %s", className, v)
+	case typeChar == 'O' && v.before(7, 4) && splFormats[className] != 0:
+		return phpVersionError(offset, "%s in the O: form needs PHP 7.4, target is PHP %s", className, v)
+	}
+	return nil
+}
+
+// splFormat is the layout of an SPL class that PHP 7.4 moved from
+// Serializable (C:) to __serialize (O:)
+type splFormat int
+
+const (
+	splArray         splFormat = iota + 1 // flags, storage, members and iterator class
+	splList                               // flags, elements and members
+	splObjectStorage                      // objects with their data, and members
+)
+
+var splFormats = map[string]splFormat{
+	"ArrayObject":            splArray,
+	"ArrayIterator":          splArray,
+	"RecursiveArrayIterator": splArray,
+	"SplDoublyLinkedList":    splList,
+	"SplQueue":               splList,
+	"SplStack":               splList,
+	"SplObjectStorage":       splObjectStorage,
+}
+
+// splToObject converts the payload of an SPL class written by PHP before 7.4
+// to the O: form of later versions
+func splToObject(obj PHPCustomObject) (string, error) {
+	p := newSPLReader(obj.Data)
+	var parts []string
+	switch splFormats[obj.ClassName] {
+	case splArray:
+		// x:<flags><storage>;m:<members>, without storage for an object
+		// that stores its own properties
+		if err := p.expect("x:"); err != nil {
+			return "", err
+		}
+		flags, err := p.value()
+		if err != nil {
+			return "", err
+		}
+		storage := "N;"
+		if !p.literal("m:") {
+			if storage, err = p.value(); err != nil {
+				return "", err
+			}
+			if err := p.expect(";m:"); err != nil {
+				return "", err
+			}
+		}
+		members, err := p.value()
+		if err != nil {
+			return "", err
+		}
+		parts = []string{flags, storage, members, "N;"}
+
+	case splList:
+		// <flags> followed by :<element> for each element
+		flags, err := p.value()
+		if err != nil {
+			return "", err
+		}
+		var elements []string
+		for p.literal(":") {
+			element, err := p.value()
+			if err != nil {
+				return "", err
+			}
+			elements = append(elements, element)
+		}
+		parts = []string{flags, serializedList(elements), "a:0:{}"}
+
+	case splObjectStorage:
+		// x:i:<count>; then <object>,<data>; for each entry, then m:<members>
+		if err := p.expect("x:"); err != nil {
+			return "", err
+		}
+		countValue, err := p.value()
+		if err != nil {
+			return "", err
+		}
+		count, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(countValue, "i:"), ";"))
+		if err != nil || count < 0 {
+			return "", fmt.Errorf("invalid entry count %s", countValue)
+		}
+		var entries []string
+		for i := 0; i < count; i++ {
+			object, err := p.value()
+			if err != nil {
+				return "", err
+			}
+			if err := p.expect(","); err != nil {
+				return "", err
+			}
+			data, err := p.value()
+			if err != nil {
+				return "", err
+			}
+			if err := p.expect(";"); err != nil {
+				return "", err
+			}
+			entries = append(entries, object, data)
+		}
+		if err := p.expect("m:"); err != nil {
+			return "", err
+		}
+		members, err := p.value()
+		if err != nil {
+			return "", err
+		}
+		parts = []string{serializedList(entries), members}
+	}
+	if err := p.end(); err != nil {
+		return "", err
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("O:")
+	writeQuoted(&buf, obj.ClassName)
+	buf.WriteString(":" + strconv.Itoa(len(parts)) + ":{")
+	for i, part := range parts {
+		buf.WriteString("i:" + strconv.Itoa(i) + ";" + part)
+	}
+	buf.WriteString("}")
+	return buf.String(), nil
+}
+
+// splToCustom converts an SPL object in the O: form of PHP 7.4 and later to
+// the C: form of earlier versions
+func splToCustom(obj PHPObject, cfg *marshalConfig, depth int) (string, error) {
+	format := splFormats[obj.ClassName]
+	n := map[splFormat]int{splArray: 4, splList: 3, splObjectStorage: 2}[format]
+	if len(obj.Properties) != n {
+		return "", fmt.Errorf("expected %d elements, got %d", n, len(obj.Properties))
+	}
+
+	// The payload is a string of its own, so shared values are not written as
+	// references into the enclosing data
+	sub := *cfg
+	sub.slot, sub.seen, sub.out = 0, nil, nil
+	parts := make([]string, n)
+	for i := range parts {
+		value, ok := obj.Properties[strconv.Itoa(i)]
+		if !ok {
+			return "", fmt.Errorf("missing element %d", i)
+		}
+		var buf bytes.Buffer
+		if err := marshalValue(&buf, value, &sub, depth+1); err != nil {
+			return "", err
+		}
+		if _, err := newSPLReader(buf.String()).value(); err != nil {
+			return "", err
+		}
+		parts[i] = buf.String()
+	}
+
+	var payload strings.Builder
+	switch format {
+	case splArray:
+		if parts[3] != "N;" {
+			return "", errors.New("a custom iterator class needs PHP 7.4")
+		}
+		payload.WriteString("x:" + parts[0])
+		if parts[1] != "N;" {
+			payload.WriteString(parts[1] + ";")
+		}
+		payload.WriteString("m:" + parts[2])
+
+	case splList:
+		if parts[2] != "a:0:{}" {
+			return "", errors.New("properties need PHP 7.4")
+		}
+		elements, err := newSPLReader(parts[1]).list()
+		if err != nil {
+			return "", err
+		}
+		payload.WriteString(parts[0])
+		for _, element := range elements {
+			payload.WriteString(":" + element)
+		}
+
+	case splObjectStorage:
+		entries, err := newSPLReader(parts[0]).list()
+		if err != nil {
+			return "", err
+		}
+		if len(entries)%2 != 0 {
+			return "", fmt.Errorf("expected objects paired with data, got %d values", len(entries))
+		}
+		payload.WriteString("x:i:" + strconv.Itoa(len(entries)/2) + ";")
+		for i := 0; i < len(entries); i += 2 {
+			payload.WriteString(entries[i] + "," + entries[i+1] + ";")
+		}
+		payload.WriteString("m:" + parts[1])
+	}
+
+	text := payload.String()
+	var buf bytes.Buffer
+	buf.WriteString("C:")
+	writeQuoted(&buf, obj.ClassName)
+	buf.WriteString(":" + strconv.Itoa(len(text)) + ":{" + text + "}")
+	return buf.String(), nil
+}
+
+// serializedList writes values as a list
+func serializedList(values []string) string {
+	var buf strings.Builder
+	buf.WriteString("a:" + strconv.Itoa(len(values)) + ":{")
+	for i, value := range values {
+		buf.WriteString("i:" + strconv.Itoa(i) + ";" + value)
+	}
+	buf.WriteString("}")
+	return buf.String()
+}
+
+// splReader reads the parts of an SPL payload
+type splReader struct {
+	s *pathScanner
+}
+
+func newSPLReader(data string) *splReader {
+	// References in a payload may point into the enclosing data, so any
+	// number is accepted here for value to reject
+	return &splReader{s: &pathScanner{
+		r:     &stringReader{data: data, pos: 0},
+		cfg:   newUnmarshalConfig(nil),
+		count: math.MaxInt32,
+	}}
+}
+
+// literal moves past text if the payload continues with it
+func (p *splReader) literal(text string) bool {
+	r := p.s.r
+	if !strings.HasPrefix(r.data[r.pos:], text) {
+		return false
+	}
+	r.pos += len(text)
+	return true
+}
+
+// expect moves past text, which the payload must continue with
+func (p *splReader) expect(text string) error {
+	if !p.literal(text) {
+		return fmt.Errorf("expected %q at position %d", text, p.s.r.pos)
+	}
+	return nil
+}
+
+// value returns the next serialized value. It may not hold references, as
+// PHP numbers the values of the two forms differently.
+func (p *splReader) value() (string, error) {
+	start := p.s.r.pos
+	p.s.refs = false
+	if err := p.s.skip(0); err != nil {
+		return "", err
+	}
+	if p.s.refs {
+		return "", fmt.Errorf("value at position %d holds references", start)
+	}
+	return p.s.r.data[start:p.s.r.pos], nil
+}
+
+// list returns the values of the array at the current position
+func (p *splReader) list() ([]string, error) {
+	if err := p.expect("a:"); err != nil {
+		return nil, err
+	}
+	count, err := readCount(p.s.r, "array count", "array")
+	if err != nil {
+		return nil, err
+	}
+	values := make([]string, 0, count)
+	for i := 0; i < count; i++ {
+		if _, _, _, err := scanKey(p.s.r); err != nil {
+			return nil, err
+		}
+		value, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+	if err := p.expect("}"); err != nil {
+		return nil, err
+	}
+	return values, p.end()
+}
+
+// end checks that the whole payload was read
+func (p *splReader) end() error {
+	if r := p.s.r; r.pos != len(r.data) {
+		return fmt.Errorf("unexpected data at position %d", r.pos)
+	}
+	return nil
+}
@@ -0,0 +1,264 @@
+package phpserialize
+
+import (
+	"errors"
+	"math"
+	"strings"
+	"testing"
+)
+
+// TestParsePHPVersion tests the accepted version strings
+func TestParsePHPVersion(t *testing.T) {
+	tests := []struct {
+		version string
+		want    phpVersion
+		ok      bool
+	}{
+		{"7.4", 704, true},
+		{"8", 800, true},
+		{"8.1.2", 801, true},
+		{"5.6", 506, true},
+		{"", 0, false},
+		{"3.0", 0, false},
+		{"7.x", 0, false},
+		{"8.1.x", 0, false},
+		{"7.100", 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := parsePHPVersion(tt.version)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("parsePHPVersion(%q): expected %d, %v, got %d, %v", tt.version, tt.want, tt.ok, got, ok)
+		}
+	}
+}
+
+// TestInvalidPHPVersion tests that an invalid version fails every call made
+// with the option
+func TestInvalidPHPVersion(t *testing.T) {
+	option := WithPHPVersion("latest")
+	calls := map[string]func() error{
+		"Marshal": func() error {
+			_, err := Marshal(1, option)
+			return err
+		},
+		"Unmarshal": func() error {
+			_, err := Unmarshal("i:1;", option)
+			return err
+		},
+		"UnmarshalTo": func() error {
+			var n int
+			return UnmarshalTo("i:1;", &n, option)
+		},
+		"Get": func() error {
+			_, err := Get("a:1:{i:0;i:1;}", "0", option)
+			return err
+		},
+		"ReplaceStrings": func() error {
+			_, err := ReplaceStrings(`s:1:"a";`, "a", "b", option)
+			return err
+		},
+		"DecodeSession": func() error {
+			_, err := DecodeSession("a|i:1;", SessionPHP, option)
+			return err
+		},
+		"Decoder": func() error {
+			_, err := NewDecoder(strings.NewReader("i:1;"), option).Decode()
+			return err
+		},
+		"Encoder": func() error {
+			return NewEncoder(&strings.Builder{}, option).Encode(1)
+		},
+	}
+	for name, call := range calls {
+		err := call()
+		if !errors.Is(err, ErrPHPVersion) {
+			t.Errorf("%s: expected ErrPHPVersion, got %v", name, err)
+		} else if !strings.Contains(err.Error(), `invalid version "latest"`) {
+			t.Errorf("%s: expected the version in the error, got %v", name, err)
+		}
+	}
+
+	// A later valid version replaces the invalid one
+	if _, err := Marshal(1, option, WithPHPVersion("8.1")); err != nil {
+		t.Errorf("Expected the later version to apply, got %v", err)
+	}
+}
+
+// TestMarshalPHPVersion tests the output written for a PHP version
+func TestMarshalPHPVersion(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   interface{}
+		version string
+		want    string
+	}{
+		{"float before 7.1", 0.1, "7.0", "d:0.10000000000000001;"},
+		{"float since 7.1", 0.1, "7.1", "d:0.1;"},
+		{"large float", 1e25, "8.2", "d:1.0E+25;"},
+		{"negative exponent", -1.5e-7, "8.2", "d:-1.5E-7;"},
+		{"enum", PHPEnum{ClassName: "Suit", Case: "H"}, "8.1", `E:6:"Suit:H";`},
+		{"custom object", PHPCustomObject{ClassName: "Money", Data: "5"}, "7.4", `C:5:"Money":1:{5}`},
+		{"ArrayObject", PHPCustomObject{ClassName: "ArrayObject", Data: "x:i:0;a:1:{i:0;i:1;};m:a:0:{}"}, "7.4",
+			`O:11:"ArrayObject":4:{i:0;i:0;i:1;a:1:{i:0;i:1;}i:2;a:0:{}i:3;N;}`},
+		{"ArrayObject of itself", PHPCustomObject{ClassName: "ArrayObject", Data: "x:i:16777216;m:a:0:{}"}, "8.0",
+			`O:11:"ArrayObject":4:{i:0;i:16777216;i:1;N;i:2;a:0:{}i:3;N;}`},
+		{"SplQueue", PHPCustomObject{ClassName: "SplQueue", Data: "i:4;:i:1;:s:1:\"x\";"}, "7.4",
+			`O:8:"SplQueue":3:{i:0;i:4;i:1;a:2:{i:0;i:1;i:1;s:1:"x";}i:2;a:0:{}}`},
+		{"SplObjectStorage", PHPCustomObject{ClassName: "SplObjectStorage", Data: `x:i:1;O:8:"stdClass":0:{},N;;m:a:0:{}`}, "7.4",
+			`O:16:"SplObjectStorage":2:{i:0;a:2:{i:0;O:8:"stdClass":0:{}i:1;N;}i:1;a:0:{}}`},
+		{"SPL before 7.4", PHPCustomObject{ClassName: "ArrayObject", Data: "x:i:0;a:0:{};m:a:0:{}"}, "7.3",
+			`C:11:"ArrayObject":21:{x:i:0;a:0:{};m:a:0:{}}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Marshal(tt.value, WithPHPVersion(tt.version))
+			if err != nil {
+				t.Fatalf("Marshal failed: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Expected %s, got %s", tt.want, got)
+			}
+		})
+	}
+}
+
+// TestMarshalSPLBefore74 tests that SPL objects decoded from the O: form are
+// written back in the C: form for older versions
+func TestMarshalSPLBefore74(t *testing.T) {
+	tests := []struct {
+		object string
+		want   string
+	}{
+		{`O:11:"ArrayObject":4:{i:0;i:0;i:1;a:1:{i:0;i:1;}i:2;a:0:{}i:3;N;}`,
+			`C:11:"ArrayObject":29:{x:i:0;a:1:{i:0;i:1;};m:a:0:{}}`},
+		{`O:13:"ArrayIterator":4:{i:0;i:16777216;i:1;N;i:2;a:0:{}i:3;N;}`,
+			`C:13:"ArrayIterator":21:{x:i:16777216;m:a:0:{}}`},
+		{`O:8:"SplStack":3:{i:0;i:6;i:1;a:2:{i:0;i:1;i:1;i:2;}i:2;a:0:{}}`,
+			`C:8:"SplStack":14:{i:6;:i:1;:i:2;}`},
+		{`O:16:"SplObjectStorage":2:{i:0;a:2:{i:0;O:8:"stdClass":0:{}i:1;N;}i:1;a:0:{}}`,
+			`C:16:"SplObjectStorage":37:{x:i:1;O:8:"stdClass":0:{},N;;m:a:0:{}}`},
+	}
+	for _, tt := range tests {
+		value, err := Unmarshal(tt.object)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := Marshal(value, WithPHPVersion("7.3"))
+		if err != nil {
+			t.Errorf("Marshal failed: %v", err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Expected %s, got %s", tt.want, got)
+		}
+	}
+}
+
+// TestMarshalPHPVersionReferences tests that the values of a converted SPL
+// object are counted by later references
+func TestMarshalPHPVersionReferences(t *testing.T) {
+	shared := PHPObject{ClassName: "A", Properties: map[string]interface{}{}}
+	value := []interface{}{
+		PHPCustomObject{ClassName: "ArrayObject", Data: "x:i:0;a:0:{};m:a:0:{}"},
+		shared,
+		shared,
+	}
+	got, err := Marshal(value, WithPHPVersion("8.0"))
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	want := `a:3:{i:0;O:11:"ArrayObject":4:{i:0;i:0;i:1;a:0:{}i:2;a:0:{}i:3;N;}i:1;O:1:"A":0:{}i:2;r:7;}`
+	if got != want {
+		t.Errorf("Expected %s, got %s", want, got)
+	}
+}
+
+// TestMarshalPHPVersionErrors tests values the target version cannot read
+func TestMarshalPHPVersionErrors(t *testing.T) {
+	type Suit int
+	tests := []struct {
+		name     string
+		value    interface{}
+		options  []Option
+		sentinel error
+	}{
+		{"enum", PHPEnum{ClassName: "Suit", Case: "H"}, []Option{WithPHPVersion("8.0")}, ErrPHPVersion},
+		{"registered enum", Suit(1), []Option{WithEnum("Suit", map[string]Suit{"H": 1}), WithPHPVersion("7.4")}, ErrPHPVersion},
+		{"custom object", PHPCustomObject{ClassName: "Money", Data: "5"}, []Option{WithPHPVersion("5.0")}, ErrPHPVersion},
+		{"Marshaler", phpTestEnum{}, []Option{WithPHPVersion("7.4")}, ErrPHPVersion},
+		{"uint64", uint64(math.MaxUint64), []Option{WithStrictPHP(false), WithPHPVersion("8.3")}, nil},
+		{"references in payload", PHPCustomObject{ClassName: "ArrayObject", Data: "x:i:0;a:1:{i:0;R:1;};m:a:0:{}"},
+			[]Option{WithPHPVersion("7.4")}, nil},
+		{"iterator class", PHPObject{ClassName: "ArrayObject", Properties: map[string]interface{}{
+			"0": int64(0), "1": []interface{}{}, "2": []interface{}{}, "3": "MyIterator"}},
+			[]Option{WithPHPVersion("7.3")}, nil},
+		{"missing element", PHPObject{ClassName: "SplQueue", Properties: map[string]interface{}{"0": int64(4)}},
+			[]Option{WithPHPVersion("7.3")}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Marshal(tt.value, tt.options...)
+			if err == nil {
+				t.Fatal("Expected error, got nil")
+			}
+			if tt.sentinel != nil && !errors.Is(err, tt.sentinel) {
+				t.Errorf("Expected %v, got %v", tt.sentinel, err)
+			}
+		})
+	}
+
+	// Without a version, uints are still written as is
+	if got, _ := Marshal(uint64(5), WithStrictPHP(false)); got != "u:5;" {
+		t.Errorf("Expected u:5;, got %s", got)
+	}
+	if got, _ := Marshal(uint64(5), WithStrictPHP(false), WithPHPVersion("8.3")); got != "i:5;" {
+		t.Errorf("Expected i:5;, got %s", got)
+	}
+}
+
+// phpTestEnum is a Marshaler that writes an enum case
+type phpTestEnum struct{}
+
+func (phpTestEnum) MarshalPHP() ([]byte, error) {
+	return []byte(`E:6:"Suit:H";`), nil
+}
+
+// TestUnmarshalPHPVersion tests data the target version cannot read
+func TestUnmarshalPHPVersion(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		version string
+		msg     string
+	}{
+		{"enum", `a:1:{i:0;E:6:"Suit:H";}`, "8.0", "enum Suit needs PHP 8.1, target is PHP 8.0"},
+		{"custom object", `C:5:"Money":1:{5}`, "5.0", "custom serialized object Money needs PHP 5.1"},
+		{"SPL object form", `O:11:"ArrayObject":4:{i:0;i:0;i:1;a:0:{}i:2;a:0:{}i:3;N;}`, "7.3", "ArrayObject in the O: form needs PHP 7.4"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Unmarshal(tt.data, WithPHPVersion(tt.version))
+			if !errors.Is(err, ErrPHPVersion) {
+				t.Fatalf("Expected ErrPHPVersion, got %v", err)
+			}
+			var se *SyntaxError
+			if !errors.As(err, &se) {
+				t.Errorf("Expected *SyntaxError, got %T", err)
+			}
+			if !strings.Contains(err.Error(), tt.msg) {
+				t.Errorf("Expected error containing %q, got %v", tt.msg, err)
+			}
+		})
+	}
+
+	// The same data is read by versions that support it
+	for _, tt := range tests {
+		if _, err := Unmarshal(tt.data, WithPHPVersion("8.1")); err != nil {
+			t.Errorf("%s: unexpected error for PHP 8.1: %v", tt.name, err)
+		}
+	}
+	// Skipped values are checked too
+	if _, err := Get(`a:2:{i:0;E:6:"Suit:H";i:1;b:1;}`, "1", WithPHPVersion("7.4")); !errors.Is(err, ErrPHPVersion) {
+		t.Errorf("Expected ErrPHPVersion from Get, got %v", err)
+	}
+}